@@ -6,6 +6,7 @@ require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/kr/text v0.2.0 // indirect
 	github.com/leboncoin/dialogflow-go-webhook v1.1.0
+	github.com/mattermost/go-i18n v1.11.0
 	github.com/mattermost/mattermost-server/v5 v5.26.2
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
 	github.com/pkg/errors v0.9.1
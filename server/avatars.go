@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	avatarKeyKey   = "avatar_key"
+	avatarsPath    = "/avatars/"
+	avatarCacheAge = "max-age=3600"
+)
+
+// siteURL returns the Mattermost site URL without its trailing slash, or "" if it is not set.
+func (p *Plugin) siteURL() string {
+	config := p.API.GetConfig()
+	if config == nil || config.ServiceSettings.SiteURL == nil {
+		return ""
+	}
+	return strings.TrimSuffix(*config.ServiceSettings.SiteURL, "/")
+}
+
+// getAvatarKey returns the key signing avatar URLs, creating it on first use.
+func (p *Plugin) getAvatarKey() ([]byte, error) {
+	key, appErr := p.API.KVGet(avatarKeyKey)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get avatar key")
+	}
+	if key != nil {
+		return key, nil
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	// Another request may have created the key meanwhile, in which case it wins.
+	ok, appErr := p.API.KVSetWithOptions(avatarKeyKey, []byte(token), model.PluginKVSetOptions{Atomic: true})
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to set avatar key")
+	}
+	if !ok {
+		return p.getAvatarKey()
+	}
+	return []byte(token), nil
+}
+
+func signAvatar(key []byte, userID string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// avatarURL returns a URL Google can fetch the user's profile image from without logging in to
+// Mattermost. The URL is signed so that only the images the plugin handed out can be fetched.
+func (p *Plugin) avatarURL(userID string) (string, error) {
+	siteURL := p.siteURL()
+	if siteURL == "" {
+		return "", errors.New("no site URL configured")
+	}
+	key, err := p.getAvatarKey()
+	if err != nil {
+		return "", err
+	}
+	return siteURL + "/plugins/" + manifest.Id + avatarsPath + userID + "?" +
+		url.Values{"sig": {signAvatar(key, userID)}}.Encode(), nil
+}
+
+// handleAvatar serves the profile image of a user from a URL built by avatarURL.
+func (p *Plugin) handleAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := strings.TrimPrefix(r.URL.Path, avatarsPath)
+	if r.Method != http.MethodGet || !model.IsValidId(userID) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	key, err := p.getAvatarKey()
+	if err != nil {
+		p.API.LogError("Cannot get avatar key", "err", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !hmac.Equal([]byte(r.URL.Query().Get("sig")), []byte(signAvatar(key, userID))) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	image, appErr := p.API.GetProfileImage(userID)
+	if appErr != nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(image))
+	w.Header().Set("Cache-Control", avatarCacheAge)
+	_, _ = w.Write(image)
+}
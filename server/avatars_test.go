@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvatars(t *testing.T) {
+	userID := model.NewId()
+	image := []byte("\x89PNG\r\n\x1a\n")
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewString("https://mm.example.com")}})
+	api.On("GetProfileImage", userID).Return(image, nil)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	avatar, err := p.avatarURL(userID)
+	require.NoError(t, err)
+	u, err := url.Parse(avatar)
+	require.NoError(t, err)
+	assert.Equal(t, "mm.example.com", u.Host)
+
+	// The key is created once and reused.
+	again, err := p.avatarURL(userID)
+	require.NoError(t, err)
+	assert.Equal(t, avatar, again)
+
+	get := func(path string) *http.Response {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Result()
+	}
+
+	t.Run("signed", func(t *testing.T) {
+		resp := get(avatarsPath + userID + "?" + u.RawQuery)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("forged", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get(avatarsPath+userID+"?sig=deadbeef").StatusCode)
+		assert.Equal(t, http.StatusNotFound, get(avatarsPath+model.NewId()+"?"+u.RawQuery).StatusCode)
+	})
+}
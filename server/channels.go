@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// findChannels matches a spoken channel name against the display and URL names of the public
+// and private channels the user is a member of, across all teams. Channels sharing a display
+// name are told apart by their team.
+func (p *Plugin) findChannels(ctx *IntentContext, spoken string) ([]match, bool, error) {
+	userID := ctx.UserID
+	memberships, err := p.getMemberships(userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var candidates []match
+	channels := make(map[string]*model.Channel)
+	for _, m := range memberships {
+		channel := m.Channel
+		if channel.Type != model.CHANNEL_OPEN && channel.Type != model.CHANNEL_PRIVATE {
+			continue
+		}
+
+		score := matchScore(spoken, channel.DisplayName)
+		if s := matchScore(spoken, channel.Name); s > score {
+			score = s
+		}
+		candidates = append(candidates, match{ID: channel.Id, Name: channel.DisplayName, Score: score})
+		channels[channel.Id] = channel
+	}
+
+	matches, confident := rankMatches(candidates)
+	if confident {
+		return matches, true, nil
+	}
+
+	names := make(map[string]int)
+	for _, m := range matches {
+		names[strings.ToLower(m.Name)]++
+	}
+	teams := make(map[string]*model.Team)
+	for i, m := range matches {
+		if names[strings.ToLower(m.Name)] < 2 {
+			continue
+		}
+		teamID := channels[m.ID].TeamId
+		team, ok := teams[teamID]
+		if !ok {
+			var appErr *model.AppError
+			if team, appErr = p.API.GetTeam(teamID); appErr != nil {
+				return nil, false, errors.Wrap(appErr, "failed to get team")
+			}
+			teams[teamID] = team
+		}
+		matches[i].Name = ctx.T("channel.in_team", vars{"Channel": m.Name, "Team": team.DisplayName})
+	}
+	return matches, false, nil
+}
+
+// resolveChannelParam finds the channel named by a parameter of the intent. When the name is
+// ambiguous, it returns the question asking which channel was meant instead.
+func (p *Plugin) resolveChannelParam(ctx *IntentContext, intentName, param string) (string, *OutgoingResponse, error) {
+	if id, ok := ctx.Choice(param); ok {
+		return id, nil, nil
+	}
+
+	matches, confident, err := p.findChannels(ctx, ctx.Param(param))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(matches) == 0 {
+		return "", nil, newIntentError("channel.not_found", nil)
+	}
+	if !confident {
+		return "", ctx.askChoice(intentName, param, matches), nil
+	}
+	return matches[0].ID, nil, nil
+}
+
+// handleSendChannelMessage posts a message as the user in a channel named by voice, asking which
+// channel was meant when the name is ambiguous.
+func (p *Plugin) handleSendChannelMessage(ctx *IntentContext) (*OutgoingResponse, error) {
+	channelID, question, err := p.resolveChannelParam(ctx, "send_channel_message", "channel")
+	if err != nil || question != nil {
+		return question, err
+	}
+
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get channel")
+	}
+	if !p.API.HasPermissionToChannel(ctx.UserID, channel.Id, model.PERMISSION_CREATE_POST) {
+		return nil, newIntentError("channel.no_permission", nil, vars{"Channel": channel.DisplayName})
+	}
+	message := ctx.Param("message")
+	if question := ctx.confirm(ctx.T("channel.confirm", vars{"Message": message, "Channel": channel.DisplayName})); question != nil {
+		return question, nil
+	}
+	if err := p.createUserPost(ctx.UserID, channel.Id, "", message); err != nil {
+		return nil, err
+	}
+	return getResponseWithText(ctx.T("channel.sent", vars{"Channel": channel.DisplayName})), nil
+}
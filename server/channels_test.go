@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleSendChannelMessage(t *testing.T) {
+	me := model.NewId()
+	acme := &model.Team{Id: model.NewId(), DisplayName: "Acme"}
+	globex := &model.Team{Id: model.NewId(), DisplayName: "Globex"}
+	acmeTown := &model.Channel{Id: model.NewId(), TeamId: acme.Id, Type: model.CHANNEL_OPEN, Name: "town-square", DisplayName: "Town Square"}
+	globexTown := &model.Channel{Id: model.NewId(), TeamId: globex.Id, Type: model.CHANNEL_OPEN, Name: "town-square", DisplayName: "Town Square"}
+	release := &model.Channel{Id: model.NewId(), TeamId: acme.Id, Type: model.CHANNEL_PRIVATE, Name: "rel-plan", DisplayName: "Release Planning"}
+	announcements := &model.Channel{Id: model.NewId(), TeamId: acme.Id, Type: model.CHANNEL_OPEN, Name: "announcements", DisplayName: "Announcements"}
+	dm := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_DIRECT, Name: "release-planning"}
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetTeamsForUser", me).Return([]*model.Team{acme, globex}, nil)
+	api.On("GetChannelMembersForUser", acme.Id, me, 0, channelMembersPerPage).Return([]*model.ChannelMember{
+		{ChannelId: acmeTown.Id}, {ChannelId: release.Id}, {ChannelId: announcements.Id}, {ChannelId: dm.Id},
+	}, nil)
+	api.On("GetChannelMembersForUser", globex.Id, me, 0, channelMembersPerPage).Return([]*model.ChannelMember{
+		{ChannelId: globexTown.Id}, {ChannelId: dm.Id},
+	}, nil)
+	api.On("GetChannelsForTeamForUser", acme.Id, me, false).Return([]*model.Channel{acmeTown, release, announcements, dm}, nil)
+	api.On("GetChannelsForTeamForUser", globex.Id, me, false).Return([]*model.Channel{globexTown, dm}, nil)
+	for _, c := range []*model.Channel{release, globexTown, announcements} {
+		api.On("GetChannel", c.Id).Return(c, nil)
+	}
+	for _, team := range []*model.Team{acme, globex} {
+		api.On("GetTeam", team.Id).Return(team, nil)
+	}
+	api.On("HasPermissionToChannel", me, mock.Anything, model.PERMISSION_CREATE_POST).Return(func(userID, channelID string, permission *model.Permission) bool {
+		return channelID != announcements.Id
+	})
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	require.NoError(t, p.registerIntents())
+
+	send := func(c *conversation, channel string) (*OutgoingResponse, error) {
+		return p.handleSendChannelMessage(&IntentContext{
+			Request:      newIntentRequest("send_channel_message", map[string]interface{}{"channel": channel, "message": "hello"}),
+			UserID:       me,
+			Conversation: c,
+		})
+	}
+
+	t.Run("confident match", func(t *testing.T) {
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.ChannelId == release.Id && post.UserId == me && post.Message == "hello"
+		})).Return(&model.Post{}, nil).Once()
+
+		response, err := send(&conversation{UserID: me}, "release planing")
+		require.NoError(t, err)
+		assert.Equal(t, "Message sent to Release Planning!", speech(t, response))
+	})
+
+	t.Run("unknown channel", func(t *testing.T) {
+		_, err := send(&conversation{UserID: me}, "marketing")
+		require.IsType(t, &intentError{}, err)
+	})
+
+	t.Run("no permission", func(t *testing.T) {
+		_, err := send(&conversation{UserID: me}, "announcements")
+		require.IsType(t, &intentError{}, err)
+		assert.Equal(t, "Sorry, you can't post in Announcements.", translateError(err))
+	})
+
+	t.Run("ambiguous name", func(t *testing.T) {
+		c := &conversation{UserID: me}
+		response, err := send(c, "town square")
+		require.NoError(t, err)
+		assert.Equal(t, "Did you mean Town Square in Acme or Town Square in Globex?", speech(t, response))
+		require.NotNil(t, c.Choice)
+
+		response, err = p.handleChoose(&IntentContext{
+			Request:      newIntentRequest("choose", map[string]interface{}{"choice": "banana"}),
+			UserID:       me,
+			Conversation: c,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Sorry, which one? Town Square in Acme or Town Square in Globex?", speech(t, response))
+
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.ChannelId == globexTown.Id && post.Message == "hello"
+		})).Return(&model.Post{}, nil).Once()
+
+		response, err = p.handleChoose(&IntentContext{
+			Request:      newIntentRequest("choose", map[string]interface{}{"choice": "globex"}),
+			UserID:       me,
+			Conversation: c,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "I'll send 'hello' to Town Square, shall I?", speech(t, response))
+		assert.Nil(t, c.Choice)
+		require.NotNil(t, c.PendingAction)
+
+		response, err = p.handleConfirm(&IntentContext{
+			Request:      newIntentRequest("confirm", nil),
+			UserID:       me,
+			Conversation: c,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Message sent to Town Square!", speech(t, response))
+		assert.Nil(t, c.PendingAction)
+	})
+
+	api.AssertExpectations(t)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/go-i18n/i18n/bundle"
+)
+
+// pendingChoice is a question asked to resolve an ambiguous parameter. Once the user picks one
+// of the options, the intent is handled again with the same parameters.
+type pendingChoice struct {
+	Intent  string         `json:"intent"`
+	Param   string         `json:"param"`
+	Options []choiceOption `json:"options"`
+
+	// Params are the parameters of the request that asked, and Chosen the options picked for
+	// other parameters before.
+	Params map[string]string `json:"params,omitempty"`
+	Chosen map[string]string `json:"chosen,omitempty"`
+}
+
+type choiceOption struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ordinalIDs are the catalog entries listing the words that pick an option by its position, in
+// that order. The words of the last entry pick the last option.
+var ordinalIDs = []string{"choice.first", "choice.second", "choice.third", "choice.last"}
+
+// ordinals maps the words used in the locale of T to pick an option by its position to that
+// position, -1 standing for the last.
+func ordinals(T bundle.TranslateFunc) map[string]int {
+	positions := make(map[string]int)
+	for i, id := range ordinalIDs {
+		if i == len(ordinalIDs)-1 {
+			i = -1
+		}
+		for _, word := range strings.Fields(normalizeName(T(id))) {
+			positions[word] = i
+		}
+	}
+	return positions
+}
+
+// Choice returns the ID of the option the user picked for an ambiguous parameter, if any.
+func (ctx *IntentContext) Choice(param string) (string, bool) {
+	id, ok := ctx.chosen[param]
+	return id, ok
+}
+
+// askChoice asks the user which of the matches they meant for the parameter of the intent being
+// handled, and remembers the question so that the answer resumes the intent.
+func (ctx *IntentContext) askChoice(intentName, param string, matches []match) *OutgoingResponse {
+	choice := &pendingChoice{
+		Intent: intentName,
+		Param:  param,
+		Params: ctx.params(),
+		Chosen: ctx.chosen,
+	}
+	for _, m := range matches {
+		choice.Options = append(choice.Options, choiceOption{ID: m.ID, Name: m.Name})
+	}
+	ctx.Conversation.Choice = choice
+
+	return choicePrompt(ctx, "choice.ask", choice)
+}
+
+func choicePrompt(ctx *IntentContext, id string, choice *pendingChoice) *OutgoingResponse {
+	names := make([]string, len(choice.Options))
+	for i, option := range choice.Options {
+		names[i] = option.Name
+	}
+	spoken := spokenList(ctx.T, "choice.or", names)
+	return newPrompt().Say(ctx.T(id, vars{"Options": spoken})).Expect(names...).Suggest(names...).Response()
+}
+
+// pickOption finds the option the user named, either by its name or by its position in the
+// locale of T.
+func pickOption(T bundle.TranslateFunc, spoken string, options []choiceOption) (choiceOption, bool) {
+	candidates := make([]match, len(options))
+	for i, option := range options {
+		candidates[i] = match{ID: option.ID, Name: option.Name, Score: matchScore(spoken, option.Name)}
+	}
+	// The options are already known to be close, so any clear lead is enough.
+	matches, _ := rankMatches(candidates)
+	if len(matches) == 1 || (len(matches) > 1 && matches[0].Score-matches[1].Score >= confidentMatchMargin) {
+		return choiceOption{ID: matches[0].ID, Name: matches[0].Name}, true
+	}
+
+	positions := ordinals(T)
+	for _, word := range strings.Fields(normalizeName(spoken)) {
+		if i, ok := positions[word]; ok {
+			if i < 0 {
+				i = len(options) - 1
+			}
+			if i < len(options) {
+				return options[i], true
+			}
+		}
+	}
+	return choiceOption{}, false
+}
+
+// handleChoose resumes the intent that asked the user to pick between several matches.
+func (p *Plugin) handleChoose(ctx *IntentContext) (*OutgoingResponse, error) {
+	choice := ctx.Conversation.Choice
+	if choice == nil {
+		return nil, newIntentError("choice.nothing", nil)
+	}
+	option, ok := pickOption(ctx.T, ctx.Param("choice"), choice.Options)
+	if !ok {
+		return choicePrompt(ctx, "choice.ask_again", choice), nil
+	}
+	ctx.Conversation.Choice = nil
+
+	chosen := make(map[string]string)
+	for param, id := range choice.Chosen {
+		chosen[param] = id
+	}
+	chosen[choice.Param] = option.ID
+	return p.resumeIntent(ctx, choice.Intent, choice.Params, chosen, false)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// errNoAccessToken is returned when an action needs the REST API but no access token is set.
+var errNoAccessToken = errors.New("no access token configured")
+
+// newRESTClient returns a client of the Mattermost REST API, for the few actions the plugin API
+// does not offer. It authenticates with the access token from the plugin configuration.
+func (p *Plugin) newRESTClient() (*model.Client4, error) {
+	token := p.getConfiguration().AccessToken
+	if token == "" {
+		return nil, errNoAccessToken
+	}
+
+	config := p.API.GetConfig()
+	if config == nil || config.ServiceSettings.SiteURL == nil || *config.ServiceSettings.SiteURL == "" {
+		return nil, errors.New("no site URL configured")
+	}
+
+	client := model.NewAPIv4Client(*config.ServiceSettings.SiteURL)
+	client.SetToken(token)
+	return client, nil
+}
+
+// responseError converts a failed REST API response into an error.
+func responseError(resp *model.Response, action string) error {
+	if resp.Error != nil {
+		return errors.Wrap(resp.Error, action)
+	}
+	return nil
+}
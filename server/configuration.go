@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/rsa"
 	"reflect"
 
 	"github.com/pkg/errors"
@@ -18,6 +19,33 @@ import (
 // If you add non-reference types to your configuration struct, be sure to rewrite Clone as a deep
 // copy appropriate for your types.
 type configuration struct {
+	// ProjectID is the Actions on Google project ID, used as the expected audience of
+	// fulfillment request signatures.
+	ProjectID string
+
+	// JWKSURL is the location of the JSON Web Key Set used to verify fulfillment requests.
+	JWKSURL string
+
+	// JWKS optionally holds a JSON Web Key Set that is used instead of fetching JWKSURL.
+	JWKS string
+
+	// OAuthClientID and OAuthClientSecret are the credentials Google uses for account linking.
+	OAuthClientID     string
+	OAuthClientSecret string
+
+	// MaxPostsPerChannel and MaxPostsTotal cap how many unread posts are read out at once.
+	MaxPostsPerChannel int
+	MaxPostsTotal      int
+
+	// PostsPerTurn is how many posts are read before waiting for the user to say "next".
+	PostsPerTurn int
+
+	// AccessToken is a system admin's personal access token, used for the actions the plugin API
+	// does not offer, such as marking posts as read.
+	AccessToken string
+
+	// signingKeys are the keys parsed from JWKS, if any.
+	signingKeys map[string]*rsa.PublicKey
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -77,6 +105,14 @@ func (p *Plugin) OnConfigurationChange() error {
 		return errors.Wrap(err, "failed to load plugin configuration")
 	}
 
+	if configuration.JWKS != "" {
+		keys, err := parseKeySet([]byte(configuration.JWKS))
+		if err != nil {
+			return errors.Wrap(err, "failed to parse signing keys")
+		}
+		configuration.signingKeys = keys
+	}
+
 	p.setConfiguration(configuration)
 
 	return nil
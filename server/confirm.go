@@ -0,0 +1,100 @@
+package main
+
+import (
+	"time"
+)
+
+// confirmationTTL bounds how long a pending action waits for the user to say yes.
+const confirmationTTL = 2 * time.Minute
+
+// pendingAction is a write intent waiting for the user to confirm it. Once they do, the intent
+// is handled again with the same parameters and choices.
+type pendingAction struct {
+	Intent string            `json:"intent"`
+	Params map[string]string `json:"params,omitempty"`
+	Chosen map[string]string `json:"chosen,omitempty"`
+
+	// ExpiresAt is when the action is discarded, in milliseconds since the epoch.
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// errNoPendingAction is answered when a confirmation arrives without an action to confirm.
+var errNoPendingAction = newIntentError("confirm.nothing", nil)
+
+// confirm asks the user whether the write intent being handled should go ahead, unless they
+// already said yes or turned confirmations off for it. It returns nil when the intent may
+// proceed, and otherwise the question, remembering the action so that "yes" resumes it.
+func (ctx *IntentContext) confirm(speech string) *OutgoingResponse {
+	if !ctx.needsConfirmation {
+		return nil
+	}
+
+	action := &pendingAction{
+		Intent:    ctx.intentName,
+		Params:    ctx.params(),
+		Chosen:    ctx.chosen,
+		ExpiresAt: time.Now().Add(confirmationTTL).UnixNano() / int64(time.Millisecond),
+	}
+	ctx.Conversation.PendingAction = action
+
+	return newPrompt().Say(speech).
+		Expect(ctx.T("confirm.expect_yes"), ctx.T("confirm.expect_no")).
+		Suggest(ctx.T("confirm.suggest_yes"), ctx.T("confirm.suggest_no")).
+		Response()
+}
+
+// confirmWrites decides whether write intents must be confirmed, and discards the pending action
+// once the user moved on to something else or took too long to answer.
+func (p *Plugin) confirmWrites(h IntentHandler, next intentFunc) intentFunc {
+	return func(ctx *IntentContext) (*OutgoingResponse, error) {
+		if !h.RequiresUser() {
+			return next(ctx)
+		}
+
+		ctx.intentName = h.Name()
+		if action := ctx.Conversation.PendingAction; action != nil {
+			expired := action.ExpiresAt < time.Now().UnixNano()/int64(time.Millisecond)
+			if expired || (h.Name() != "confirm" && h.Name() != "cancel") {
+				ctx.Conversation.PendingAction = nil
+			}
+		}
+
+		if err := p.requireConfirmation(ctx, h); err != nil {
+			return nil, err
+		}
+		return next(ctx)
+	}
+}
+
+// requireConfirmation makes write intents ask the user first, unless they turned that off.
+func (p *Plugin) requireConfirmation(ctx *IntentContext, h IntentHandler) error {
+	ctx.needsConfirmation = false
+	if !h.Writes() {
+		return nil
+	}
+	settings, err := p.getUserSettings(ctx.UserID)
+	if err != nil {
+		return err
+	}
+	ctx.needsConfirmation = settings.confirms(h.Name())
+	return nil
+}
+
+// handleConfirm runs the action the user was asked to confirm.
+func (p *Plugin) handleConfirm(ctx *IntentContext) (*OutgoingResponse, error) {
+	action := ctx.Conversation.PendingAction
+	if action == nil {
+		return nil, errNoPendingAction
+	}
+	ctx.Conversation.PendingAction = nil
+	return p.resumeIntent(ctx, action.Intent, action.Params, action.Chosen, true)
+}
+
+// handleCancel discards the action the user was asked to confirm.
+func (p *Plugin) handleCancel(ctx *IntentContext) (*OutgoingResponse, error) {
+	if ctx.Conversation.PendingAction == nil {
+		return nil, errNoPendingAction
+	}
+	ctx.Conversation.PendingAction = nil
+	return getResponseWithText(ctx.T("confirm.cancelled")), nil
+}
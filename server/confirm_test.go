@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmWrites(t *testing.T) {
+	userID := model.NewId()
+	api := &plugintest.API{}
+	newMemKV(api)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.intents = newIntentRegistry(p.confirmWrites)
+
+	var written []string
+	for _, h := range []IntentHandler{
+		&intent{name: "write", requiresUser: true, writes: true, handle: func(ctx *IntentContext) (*OutgoingResponse, error) {
+			if question := ctx.confirm("I'll write " + ctx.Param("text") + ", shall I?"); question != nil {
+				return question, nil
+			}
+			written = append(written, ctx.Param("text"))
+			return getResponseWithText("Done!"), nil
+		}},
+		&intent{name: "read", requiresUser: true, handle: func(ctx *IntentContext) (*OutgoingResponse, error) {
+			return getResponseWithText("Nothing new."), nil
+		}},
+		&intent{name: "confirm", requiresUser: true, handle: p.handleConfirm},
+		&intent{name: "cancel", requiresUser: true, handle: p.handleCancel},
+	} {
+		require.NoError(t, p.intents.Register(h))
+	}
+
+	dispatch := func(c *conversation, name string, params map[string]interface{}) string {
+		response, err := p.intents.Dispatch(&IntentContext{Request: newIntentRequest(name, params), UserID: userID, Conversation: c})
+		if iErr, ok := err.(*intentError); ok {
+			return translateError(iErr)
+		}
+		require.NoError(t, err)
+		return speech(t, response)
+	}
+
+	t.Run("yes runs the action", func(t *testing.T) {
+		written = nil
+		c := &conversation{UserID: userID}
+		assert.Equal(t, "I'll write hello, shall I?", dispatch(c, "write", map[string]interface{}{"text": "hello"}))
+		assert.Empty(t, written)
+		assert.Equal(t, "Done!", dispatch(c, "confirm", nil))
+		assert.Equal(t, []string{"hello"}, written)
+		assert.Nil(t, c.PendingAction)
+	})
+
+	t.Run("no discards the action", func(t *testing.T) {
+		written = nil
+		c := &conversation{UserID: userID}
+		dispatch(c, "write", map[string]interface{}{"text": "hello"})
+		assert.Equal(t, "OK, I won't do it.", dispatch(c, "cancel", nil))
+		assert.Equal(t, "There is nothing waiting to be confirmed.", dispatch(c, "confirm", nil))
+		assert.Empty(t, written)
+	})
+
+	t.Run("other intents discard the action", func(t *testing.T) {
+		c := &conversation{UserID: userID}
+		dispatch(c, "write", map[string]interface{}{"text": "hello"})
+		dispatch(c, "read", nil)
+		assert.Nil(t, c.PendingAction)
+	})
+
+	t.Run("expired actions are discarded", func(t *testing.T) {
+		written = nil
+		c := &conversation{UserID: userID}
+		dispatch(c, "write", map[string]interface{}{"text": "hello"})
+		c.PendingAction.ExpiresAt = time.Now().Add(-time.Second).UnixNano() / int64(time.Millisecond)
+		assert.Equal(t, "There is nothing waiting to be confirmed.", dispatch(c, "confirm", nil))
+		assert.Empty(t, written)
+	})
+
+	t.Run("confirmations turned off", func(t *testing.T) {
+		written = nil
+		settings := &userSettings{}
+		require.NoError(t, updateSetting(settings, p.intents.WriteIntents(), "confirm-write", "off"))
+		assert.False(t, settings.confirms("write"))
+		require.NoError(t, p.saveUserSettings(userID, settings))
+		defer p.saveUserSettings(userID, &userSettings{})
+
+		c := &conversation{UserID: userID}
+		assert.Equal(t, "Done!", dispatch(c, "write", map[string]interface{}{"text": "now"}))
+		assert.Equal(t, []string{"now"}, written)
+
+		require.NoError(t, updateSetting(settings, p.intents.WriteIntents(), "confirm-write", "on"))
+		assert.True(t, settings.confirms("write"))
+		assert.Error(t, updateSetting(settings, p.intents.WriteIntents(), "confirm-read", "off"))
+	})
+
+	api.AssertNotCalled(t, "CreatePost", mock.Anything)
+}
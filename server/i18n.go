@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/mattermost/go-i18n/i18n/bundle"
+	"github.com/pkg/errors"
+)
+
+// defaultLocale is spoken when neither the Assistant nor Mattermost ask for a supported locale.
+const defaultLocale = "en"
+
+// catalog holds the translations of everything the plugin says, one bundle per locale, loaded
+// from server/i18n in OnActivate.
+var catalog = bundle.New()
+
+// vars are the values filled into a translation.
+type vars = map[string]interface{}
+
+// loadCatalog loads every translation bundle of the directory.
+func loadCatalog(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return errors.Wrap(err, "failed to list translations")
+	}
+	if len(files) == 0 {
+		return errors.Errorf("no translations found in %s", dir)
+	}
+	for _, file := range files {
+		if err := catalog.LoadTranslationFile(file); err != nil {
+			return errors.Wrapf(err, "failed to load translations from %s", file)
+		}
+	}
+	return nil
+}
+
+// localePreferences lists the locales to try for a locale tag such as "de-DE": the tag itself,
+// then its language, as bundles are usually shared by all the regions of a language.
+func localePreferences(locales ...string) []string {
+	var prefs []string
+	for _, locale := range locales {
+		if locale == "" {
+			continue
+		}
+		prefs = append(prefs, locale)
+		if i := strings.IndexAny(locale, "-_"); i > 0 {
+			prefs = append(prefs, locale[:i])
+		}
+	}
+	return prefs
+}
+
+// supportsLocale reports whether the catalog has a bundle for the locale or its language.
+func supportsLocale(locale string) bool {
+	prefs := localePreferences(locale)
+	if len(prefs) == 0 {
+		return false
+	}
+	_, err := catalog.Tfunc(prefs[0], prefs[1:]...)
+	return err == nil
+}
+
+// spokenList joins items the way they are spoken, such as "a, b or c" for the "choice.or"
+// conjunction, which fills in the Items and the Last item.
+func spokenList(T bundle.TranslateFunc, conjunction string, items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return T(conjunction, vars{"Items": strings.Join(items[:len(items)-1], ", "), "Last": items[len(items)-1]})
+}
+
+// translator returns a function translating into the first of the locales the catalog supports,
+// or into English if it supports none of them. Translations take an optional count, choosing
+// the plural form, and the vars to fill in:
+//
+//	T("reading.remaining", 3)
+//	T("status.changed", vars{"Old": "online", "New": "away"})
+func translator(locales ...string) bundle.TranslateFunc {
+	prefs := append(localePreferences(locales...), defaultLocale)
+	T, _ := catalog.Tfunc(prefs[0], prefs[1:]...)
+	return T
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	if err := loadCatalog("i18n"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// translateError returns the English answer to an intentError.
+func translateError(err error) string {
+	iErr := err.(*intentError)
+	return translator()(iErr.id, iErr.args...)
+}
+
+func TestCatalogs(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("i18n", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	ids := func(locale string) []string {
+		ids := catalog.LanguageTranslationIDs(locale)
+		sort.Strings(ids)
+		return ids
+	}
+	english := ids(defaultLocale)
+	for _, locale := range catalog.LanguageTags() {
+		assert.Equal(t, english, ids(locale), "translations of %s", locale)
+	}
+}
+
+func TestTranslator(t *testing.T) {
+	t.Run("region falls back to its language", func(t *testing.T) {
+		assert.Equal(t, "Nachricht gesendet!", translator("de-DE")("dm.sent"))
+	})
+
+	t.Run("unsupported locales fall back to English", func(t *testing.T) {
+		assert.Equal(t, "Message sent!", translator("xx-XX", "")("dm.sent"))
+	})
+
+	t.Run("first supported locale wins", func(t *testing.T) {
+		assert.Equal(t, "Nachricht gesendet!", translator("xx", "de", "en")("dm.sent"))
+	})
+
+	t.Run("plurals", func(t *testing.T) {
+		T := translator("en-US")
+		assert.Equal(t, "You have 1 more unread message.", T("reading.remaining", 1))
+		assert.Equal(t, "You have 3 more unread messages.", T("reading.remaining", 3))
+		T = translator("de")
+		assert.Equal(t, "1 Kanal als gelesen markiert.", T("mark_read.done", 1))
+		assert.Equal(t, "2 Kanäle als gelesen markiert.", T("mark_read.done", 2))
+	})
+}
+
+func TestLocalize(t *testing.T) {
+	userID := model.NewId()
+	api := &plugintest.API{}
+	api.On("GetUser", userID).Return(&model.User{Id: userID, Locale: "de"}, nil)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	h := &intent{name: "test", requiresUser: true}
+	next := func(ctx *IntentContext) (*OutgoingResponse, error) {
+		return getResponseWithText(ctx.T("dm.sent")), nil
+	}
+
+	for locale, expected := range map[string]string{
+		"en-GB": "Message sent!",
+		"de-AT": "Nachricht gesendet!",
+		"fr-FR": "Nachricht gesendet!",
+	} {
+		req := newIntentRequest("test", nil)
+		req.User.Locale = model.NewString(locale)
+		response, err := p.localize(h, next)(&IntentContext{Request: req, UserID: userID})
+		require.NoError(t, err)
+		assert.Equal(t, expected, speech(t, response), locale)
+	}
+}
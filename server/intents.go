@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mattermost/go-i18n/i18n/bundle"
+	"github.com/pkg/errors"
+)
+
+// IntentContext carries a fulfillment request to the intent handling it.
+type IntentContext struct {
+	Request *IncomingRequest
+
+	// UserID is the Mattermost user behind the request. It is only set for intents that
+	// require an authenticated user.
+	UserID string
+
+	// Conversation is the state of the Assistant session, also only set for intents that
+	// require an authenticated user. Changes are stored once the intent is handled.
+	Conversation *conversation
+
+	// chosen holds the options the user picked for ambiguous parameters, see Choice.
+	chosen map[string]string
+
+	// intentName is the intent being handled, and needsConfirmation whether it has to ask the
+	// user before writing anything, see confirm.
+	intentName        string
+	needsConfirmation bool
+
+	// translate speaks the locale of the request, see T.
+	translate bundle.TranslateFunc
+}
+
+// T translates a message into the locale the Assistant speaks, or the one chosen by localize.
+func (ctx *IntentContext) T(id string, args ...interface{}) string {
+	if ctx.translate == nil {
+		ctx.translate = translator(ctx.requestLocales()...)
+	}
+	return ctx.translate(id, args...)
+}
+
+// requestLocales returns the locales the Assistant asks for, most specific first.
+func (ctx *IntentContext) requestLocales() []string {
+	var locales []string
+	if ctx.Request.User.Locale != nil {
+		locales = append(locales, *ctx.Request.User.Locale)
+	}
+	return append(locales, ctx.Request.Session.LanguageCode)
+}
+
+// Param returns the value of an intent parameter or, failing that, of a scene slot with the
+// given name. Values that are not strings are formatted with fmt.
+func (ctx *IntentContext) Param(name string) string {
+	if v, ok := ctx.Request.Intent.Params[name]; ok && v.Resolved != nil {
+		return formatParam(v.Resolved)
+	}
+	if v, ok := ctx.Request.Scene.Slots[name]; ok && v.Value != nil {
+		return formatParam(v.Value)
+	}
+	return ""
+}
+
+// HasParam reports whether the request carries a non empty parameter or slot with the given name.
+func (ctx *IntentContext) HasParam(name string) bool {
+	return ctx.Param(name) != ""
+}
+
+// params returns the values of every parameter and slot of the request.
+func (ctx *IntentContext) params() map[string]string {
+	params := make(map[string]string)
+	for name := range ctx.Request.Scene.Slots {
+		params[name] = ctx.Param(name)
+	}
+	for name := range ctx.Request.Intent.Params {
+		params[name] = ctx.Param(name)
+	}
+	return params
+}
+
+// HasScreen reports whether the device the request comes from can show rich responses.
+func (ctx *IntentContext) HasScreen() bool {
+	if ctx.Request.Device.Capabilities == nil {
+		return false
+	}
+	for _, capability := range *ctx.Request.Device.Capabilities {
+		if capability == capabilityRichResponse {
+			return true
+		}
+	}
+	return false
+}
+
+func formatParam(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return fmt.Sprintf("%.0f", value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// IntentHandler handles one of the webhook handlers configured in the Actions console.
+type IntentHandler interface {
+	// Name is the webhook handler name the intent is registered under.
+	Name() string
+
+	// RequiresUser reports whether the request must come from a linked Mattermost user.
+	RequiresUser() bool
+
+	// Writes reports whether the intent changes anything, in which case the user is asked to
+	// confirm it first.
+	Writes() bool
+
+	// RequiredParams lists the intent parameters or scene slots that must be present.
+	RequiredParams() []string
+
+	// Handle answers the request.
+	Handle(ctx *IntentContext) (*OutgoingResponse, error)
+}
+
+// intent is an IntentHandler backed by a function.
+type intent struct {
+	name         string
+	requiresUser bool
+	writes       bool
+	params       []string
+	handle       intentFunc
+}
+
+func (i *intent) Name() string                                         { return i.name }
+func (i *intent) RequiresUser() bool                                   { return i.requiresUser }
+func (i *intent) Writes() bool                                         { return i.writes }
+func (i *intent) RequiredParams() []string                             { return i.params }
+func (i *intent) Handle(ctx *IntentContext) (*OutgoingResponse, error) { return i.handle(ctx) }
+
+type intentFunc func(ctx *IntentContext) (*OutgoingResponse, error)
+
+// intentMiddleware wraps the handling of an intent.
+type intentMiddleware func(h IntentHandler, next intentFunc) intentFunc
+
+// intentError is an error with a message that is safe to speak back to the user.
+type intentError struct {
+	id   string
+	args []interface{}
+	err  error
+}
+
+func (e *intentError) Error() string {
+	if e.err == nil {
+		return e.id
+	}
+	return e.err.Error()
+}
+
+// newIntentError returns an error that is answered with the translation of id, filled with
+// args. err may be nil when the failure is expected, such as an unknown user name.
+func newIntentError(id string, err error, args ...interface{}) error {
+	return &intentError{id: id, args: args, err: err}
+}
+
+// intentRegistry dispatches fulfillment requests to the intent registered for their handler.
+type intentRegistry struct {
+	handlers   map[string]IntentHandler
+	middleware []intentMiddleware
+}
+
+// newIntentRegistry creates a registry wrapping every intent in the given middleware, the first
+// middleware being the outermost.
+func newIntentRegistry(middleware ...intentMiddleware) *intentRegistry {
+	return &intentRegistry{
+		handlers:   make(map[string]IntentHandler),
+		middleware: middleware,
+	}
+}
+
+// Register adds an intent to the registry. Names must be unique.
+func (r *intentRegistry) Register(h IntentHandler) error {
+	if _, ok := r.handlers[h.Name()]; ok {
+		return errors.Errorf("intent %q is already registered", h.Name())
+	}
+	r.handlers[h.Name()] = h
+	return nil
+}
+
+// Get returns the intent registered under name, if any.
+func (r *intentRegistry) Get(name string) (IntentHandler, bool) {
+	h, ok := r.handlers[name]
+	return h, ok
+}
+
+// WriteIntents returns the names of the intents that change anything, sorted.
+func (r *intentRegistry) WriteIntents() []string {
+	var names []string
+	for name, h := range r.handlers {
+		if h.Writes() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dispatch runs the intent matching the request's handler through the middleware.
+func (r *intentRegistry) Dispatch(ctx *IntentContext) (*OutgoingResponse, error) {
+	name := ""
+	if ctx.Request.Handler != nil && ctx.Request.Handler.Name != nil {
+		name = *ctx.Request.Handler.Name
+	}
+	h, ok := r.handlers[name]
+	if !ok {
+		return getResponseWithText(ctx.T("intent.unknown")), nil
+	}
+
+	next := h.Handle
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		next = r.middleware[i](h, next)
+	}
+	return next(ctx)
+}
+
+// resumeIntent handles an intent again with the parameters and choices of an earlier request,
+// once the user answered a question it asked. confirmed skips the confirmation of writes.
+func (p *Plugin) resumeIntent(ctx *IntentContext, name string, params, chosen map[string]string, confirmed bool) (*OutgoingResponse, error) {
+	h, ok := p.intents.Get(name)
+	if !ok {
+		return getResponseWithText(ctx.T("intent.unknown")), nil
+	}
+
+	intentParams := gIntentParams{}
+	for name, value := range params {
+		value := value
+		intentParams[name] = gIntentParameterValue{Original: &value, Resolved: value}
+	}
+	ctx.Request.Intent.Params = intentParams
+	ctx.Request.Scene.Slots = nil
+	ctx.chosen = chosen
+	ctx.intentName = name
+	if confirmed {
+		ctx.needsConfirmation = false
+	} else if err := p.requireConfirmation(ctx, h); err != nil {
+		return nil, err
+	}
+	return h.Handle(ctx)
+}
+
+// speakErrors turns errors returned by intents into spoken apologies.
+func (p *Plugin) speakErrors(h IntentHandler, next intentFunc) intentFunc {
+	return func(ctx *IntentContext) (*OutgoingResponse, error) {
+		response, err := next(ctx)
+		if err == nil {
+			return response, nil
+		}
+
+		if iErr, ok := err.(*intentError); ok {
+			if iErr.err != nil {
+				p.API.LogError("Intent failed", "intent", h.Name(), "err", iErr.err.Error())
+			}
+			return getResponseWithText(ctx.T(iErr.id, iErr.args...)), nil
+		}
+
+		p.API.LogError("Intent failed", "intent", h.Name(), "err", err.Error())
+		return getResponseWithText(ctx.T("error.generic")), nil
+	}
+}
+
+// logIntents logs every handled intent along with how long it took.
+func (p *Plugin) logIntents(h IntentHandler, next intentFunc) intentFunc {
+	return func(ctx *IntentContext) (*OutgoingResponse, error) {
+		start := time.Now()
+		response, err := next(ctx)
+		p.API.LogDebug("Handled intent", "intent", h.Name(), "user_id", ctx.UserID, "duration", time.Since(start).String())
+		return response, err
+	}
+}
+
+// authenticate resolves the Mattermost user of intents that require one.
+func (p *Plugin) authenticate(h IntentHandler, next intentFunc) intentFunc {
+	return func(ctx *IntentContext) (*OutgoingResponse, error) {
+		if !h.RequiresUser() {
+			return next(ctx)
+		}
+
+		userID, err := p.resolveUserID(ctx.Request)
+		if err == errInvalidToken {
+			return nil, newIntentError("error.not_connected", nil)
+		}
+		if err != nil {
+			return nil, newIntentError("error.unreachable", err)
+		}
+
+		ctx.UserID = userID
+		return next(ctx)
+	}
+}
+
+// localize speaks the Mattermost locale of the user when the plugin has no translations for the
+// locale of the Assistant.
+func (p *Plugin) localize(h IntentHandler, next intentFunc) intentFunc {
+	return func(ctx *IntentContext) (*OutgoingResponse, error) {
+		if ctx.UserID == "" {
+			return next(ctx)
+		}
+		locales := ctx.requestLocales()
+		for _, locale := range locales {
+			if supportsLocale(locale) {
+				return next(ctx)
+			}
+		}
+
+		u, appErr := p.API.GetUser(ctx.UserID)
+		if appErr != nil {
+			p.API.LogWarn("Cannot get user locale", "user_id", ctx.UserID, "err", appErr.Error())
+			return next(ctx)
+		}
+		ctx.translate = translator(append(locales, u.Locale)...)
+		return next(ctx)
+	}
+}
+
+// validateParams rejects requests that lack one of the intent's required parameters.
+func validateParams(h IntentHandler, next intentFunc) intentFunc {
+	return func(ctx *IntentContext) (*OutgoingResponse, error) {
+		for _, name := range h.RequiredParams() {
+			if !ctx.HasParam(name) {
+				return nil, newIntentError("error.missing_param", nil, vars{"Param": ctx.T("param." + name)})
+			}
+		}
+		return next(ctx)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIntentRequest(handler string, params map[string]interface{}) *IncomingRequest {
+	req := &IncomingRequest{
+		Handler: &gHandler{Name: model.NewString(handler)},
+		Intent:  gIntent{Params: gIntentParams{}},
+		User:    gUser{Locale: model.NewString("en-US")},
+	}
+	for name, value := range params {
+		req.Intent.Params[name] = gIntentParameterValue{Resolved: value}
+	}
+	return req
+}
+
+func speech(t *testing.T, response *OutgoingResponse) string {
+	require.NotNil(t, response)
+	require.NotNil(t, response.Prompt)
+	require.NotNil(t, response.Prompt.LastSimple)
+	return *response.Prompt.LastSimple.Speech
+}
+
+func displayText(t *testing.T, response *OutgoingResponse) string {
+	require.NotNil(t, response)
+	require.NotNil(t, response.Prompt)
+	require.NotNil(t, response.Prompt.LastSimple)
+	return response.Prompt.LastSimple.Text
+}
+
+func TestIntentRegistry(t *testing.T) {
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("LogDebug", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	registry := newIntentRegistry(p.speakErrors, p.logIntents, p.authenticate, validateParams)
+
+	var handled *IntentContext
+	require.NoError(t, registry.Register(&intent{
+		name:   "echo",
+		params: []string{"message"},
+		handle: func(ctx *IntentContext) (*OutgoingResponse, error) {
+			handled = ctx
+			return getResponseWithText(ctx.Param("message")), nil
+		},
+	}))
+	require.NoError(t, registry.Register(&intent{
+		name:         "private",
+		requiresUser: true,
+		handle: func(ctx *IntentContext) (*OutgoingResponse, error) {
+			return getResponseWithText("secret"), nil
+		},
+	}))
+	require.NoError(t, registry.Register(&intent{
+		name: "broken",
+		handle: func(ctx *IntentContext) (*OutgoingResponse, error) {
+			return nil, errors.New("boom")
+		},
+	}))
+	require.NoError(t, registry.Register(&intent{
+		name: "polite",
+		handle: func(ctx *IntentContext) (*OutgoingResponse, error) {
+			return nil, newIntentError("Sorry, no.", nil)
+		},
+	}))
+
+	t.Run("duplicate names are rejected", func(t *testing.T) {
+		assert.Error(t, registry.Register(&intent{name: "echo"}))
+	})
+
+	t.Run("dispatches by handler name", func(t *testing.T) {
+		response, err := registry.Dispatch(&IntentContext{Request: newIntentRequest("echo", map[string]interface{}{"message": "hi"})})
+		require.NoError(t, err)
+		assert.Equal(t, "hi", speech(t, response))
+		assert.NotNil(t, handled)
+	})
+
+	t.Run("unknown handler", func(t *testing.T) {
+		response, err := registry.Dispatch(&IntentContext{Request: newIntentRequest("nope", nil)})
+		require.NoError(t, err)
+		assert.Equal(t, "Sorry, don't know what to do!", speech(t, response))
+	})
+
+	t.Run("missing params", func(t *testing.T) {
+		handled = nil
+		response, err := registry.Dispatch(&IntentContext{Request: newIntentRequest("echo", nil)})
+		require.NoError(t, err)
+		assert.Equal(t, "Sorry, I didn't catch the message.", speech(t, response))
+		assert.Nil(t, handled)
+	})
+
+	t.Run("params fall back to slots", func(t *testing.T) {
+		req := newIntentRequest("echo", nil)
+		req.Scene.Slots = map[string]gSlot{"message": {Value: "from slot"}}
+		response, err := registry.Dispatch(&IntentContext{Request: req})
+		require.NoError(t, err)
+		assert.Equal(t, "from slot", speech(t, response))
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		response, err := registry.Dispatch(&IntentContext{Request: newIntentRequest("private", nil)})
+		require.NoError(t, err)
+		assert.Contains(t, speech(t, response), "I don't know who you are yet")
+	})
+
+	t.Run("errors are spoken", func(t *testing.T) {
+		response, err := registry.Dispatch(&IntentContext{Request: newIntentRequest("broken", nil)})
+		require.NoError(t, err)
+		assert.Equal(t, "Sorry, something went wrong!", speech(t, response))
+
+		response, err = registry.Dispatch(&IntentContext{Request: newIntentRequest("polite", nil)})
+		require.NoError(t, err)
+		assert.Equal(t, "Sorry, no.", speech(t, response))
+	})
+}
+
+func TestHandleSendDM(t *testing.T) {
+	me := &model.User{Id: model.NewId(), Username: "me"}
+	bob := &model.User{Id: model.NewId(), Username: "bob"}
+	smith := &model.User{Id: model.NewId(), Username: "asmith", FirstName: "Alice", LastName: "Smith"}
+	jones := &model.User{Id: model.NewId(), Username: "ajones", FirstName: "Alice", LastName: "Jones"}
+	gone := &model.User{Id: model.NewId(), Username: "carol", DeleteAt: 1}
+	team := &model.Team{Id: model.NewId()}
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetTeamsForUser", me.Id).Return([]*model.Team{team}, nil)
+	api.On("GetUsersInTeam", team.Id, 0, usersPerPage).Return([]*model.User{me, bob, smith, jones, gone}, nil)
+	for _, u := range []*model.User{bob, smith, jones} {
+		api.On("GetUser", u.Id).Return(u, nil).Maybe()
+		api.On("GetDirectChannel", me.Id, u.Id).Return(&model.Channel{Id: "dm_" + u.Username, Type: model.CHANNEL_DIRECT}, nil)
+	}
+	var sentTo []string
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.UserId == me.Id && post.Message == "hello"
+	})).Return(func(post *model.Post) *model.Post {
+		sentTo = append(sentTo, post.ChannelId)
+		return post
+	}, nil)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	require.NoError(t, p.registerIntents())
+	require.NoError(t, p.saveUserSettings(me.Id, &userSettings{SkipConfirmation: []string{"send_message"}}))
+
+	send := func(c *conversation, username string) (*OutgoingResponse, error) {
+		return p.handleSendDM(&IntentContext{
+			Request:      newIntentRequest("send_message", map[string]interface{}{"username": username, "message": "hello"}),
+			UserID:       me.Id,
+			Conversation: c,
+		})
+	}
+
+	for spoken, channelID := range map[string]string{
+		"bob":         "dm_bob",
+		"alis smyth":  "dm_asmith",
+		"Alice Jones": "dm_ajones",
+		"a smith":     "dm_asmith",
+		"Bobb":        "dm_bob",
+	} {
+		sentTo = nil
+		response, err := send(&conversation{UserID: me.Id}, spoken)
+		require.NoError(t, err, spoken)
+		assert.Equal(t, "Message sent!", speech(t, response), spoken)
+		assert.Equal(t, []string{channelID}, sentTo, spoken)
+	}
+
+	t.Run("unknown user", func(t *testing.T) {
+		_, err := send(&conversation{UserID: me.Id}, "carol")
+		require.IsType(t, &intentError{}, err)
+	})
+
+	t.Run("ambiguous name", func(t *testing.T) {
+		sentTo = nil
+		c := &conversation{UserID: me.Id}
+		response, err := send(c, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, "Did you mean Alice Smith or Alice Jones?", speech(t, response))
+
+		response, err = p.handleChoose(&IntentContext{
+			Request:      newIntentRequest("choose", map[string]interface{}{"choice": "jones"}),
+			UserID:       me.Id,
+			Conversation: c,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Message sent!", speech(t, response))
+		assert.Equal(t, []string{"dm_ajones"}, sentTo)
+	})
+}
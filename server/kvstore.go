@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// kvGetJSON loads the JSON value stored under key into v. It reports whether the key existed.
+func (p *Plugin) kvGetJSON(key string, v interface{}) (bool, error) {
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return false, errors.Wrapf(appErr, "failed to get %q", key)
+	}
+	if data == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, errors.Wrapf(err, "failed to decode %q", key)
+	}
+	return true, nil
+}
+
+// kvSetJSON stores v as JSON under key. A zero ttl keeps the value until it is deleted.
+func (p *Plugin) kvSetJSON(key string, v interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode %q", key)
+	}
+	if ttl > 0 {
+		if appErr := p.API.KVSetWithExpiry(key, data, int64(ttl/time.Second)); appErr != nil {
+			return errors.Wrapf(appErr, "failed to set %q", key)
+		}
+		return nil
+	}
+	if appErr := p.API.KVSet(key, data); appErr != nil {
+		return errors.Wrapf(appErr, "failed to set %q", key)
+	}
+	return nil
+}
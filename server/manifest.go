@@ -16,7 +16,7 @@ const manifestStr = `
   "name": "Google Assistant Integration",
   "description": "This plugin allows you to perform Mattermost actions via Google Assistant",
   "version": "0.1.0",
-  "min_server_version": "5.12.0",
+  "min_server_version": "5.20.0",
   "server": {
     "executables": {
       "linux-amd64": "server/dist/plugin-linux-amd64",
@@ -31,7 +31,81 @@ const manifestStr = `
   "settings_schema": {
     "header": "",
     "footer": "",
-    "settings": []
+    "settings": [
+      {
+        "key": "ProjectID",
+        "display_name": "Actions Project ID:",
+        "type": "text",
+        "help_text": "The ID of the Actions on Google project. Fulfillment requests are only accepted when their signature was issued for this project.",
+        "placeholder": "",
+        "default": null
+      },
+      {
+        "key": "JWKSURL",
+        "display_name": "Signing Keys URL:",
+        "type": "text",
+        "help_text": "The URL of the JSON Web Key Set used to verify the Google-Assistant-Signature header of fulfillment requests.",
+        "placeholder": "",
+        "default": "https://www.googleapis.com/oauth2/v3/certs"
+      },
+      {
+        "key": "JWKS",
+        "display_name": "Signing Keys:",
+        "type": "longtext",
+        "help_text": "(Optional) A JSON Web Key Set used to verify fulfillment requests instead of fetching the Signing Keys URL.",
+        "placeholder": "",
+        "default": null
+      },
+      {
+        "key": "OAuthClientID",
+        "display_name": "Account Linking Client ID:",
+        "type": "text",
+        "help_text": "The client ID entered in the account linking section of the Actions console. Use https://\u003cyour-mattermost-url\u003e/plugins/com.kodermonkeys.assistant/oauth2/authorize as the authorization URL and .../oauth2/token as the token URL.",
+        "placeholder": "",
+        "default": "google-assistant"
+      },
+      {
+        "key": "OAuthClientSecret",
+        "display_name": "Account Linking Client Secret:",
+        "type": "generated",
+        "help_text": "The client secret entered in the account linking section of the Actions console. Google must be configured to send client credentials in the request body.",
+        "placeholder": "",
+        "default": null
+      },
+      {
+        "key": "MaxPostsPerChannel",
+        "display_name": "Messages Read Per Channel:",
+        "type": "number",
+        "help_text": "The maximum number of unread messages read out for each channel. Older messages are skipped.",
+        "placeholder": "",
+        "default": 5
+      },
+      {
+        "key": "MaxPostsTotal",
+        "display_name": "Messages Read In Total:",
+        "type": "number",
+        "help_text": "The maximum number of unread messages read out at once across all channels.",
+        "placeholder": "",
+        "default": 20
+      },
+      {
+        "key": "PostsPerTurn",
+        "display_name": "Messages Read Per Turn:",
+        "type": "number",
+        "help_text": "The number of unread messages read before waiting for the user to say \"next\".",
+        "placeholder": "",
+        "default": 3
+      },
+      {
+        "key": "AccessToken",
+        "display_name": "Mattermost Access Token:",
+        "type": "text",
+        "secret": true,
+        "help_text": "A personal access token of a system admin, used to mark messages as read once they have been read out, as plugins cannot do so themselves. Leave empty to never mark messages as read; users are then told that messages stay unread.",
+        "placeholder": "",
+        "default": null
+      }
+    ]
   }
 }
 `
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// The plugin API cannot mark channels as read, so this goes through the REST API. Marking a
+// channel read up to a post is done by viewing it and then marking the post after as unread.
+
+// markReadUpTo marks the channel of the post as read up to and including the post, leaving
+// posts created after it unread.
+func (p *Plugin) markReadUpTo(client *model.Client4, userID string, post *model.Post) error {
+	pl, appErr := p.API.GetPostsSince(post.ChannelId, post.CreateAt)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get posts")
+	}
+
+	var next *model.Post
+	for _, candidate := range pl.Posts {
+		if candidate.CreateAt <= post.CreateAt || candidate.DeleteAt != 0 || candidate.UserId == userID || candidate.IsSystemMessage() {
+			continue
+		}
+		if next == nil || candidate.CreateAt < next.CreateAt {
+			next = candidate
+		}
+	}
+
+	if next != nil {
+		return responseError(client.SetPostUnread(userID, next.Id), "failed to set post unread")
+	}
+	_, resp := client.ViewChannel(userID, &model.ChannelView{ChannelId: post.ChannelId})
+	return responseError(resp, "failed to view channel")
+}
+
+// markSpoken marks the channels of the posts read out between pos and end as read up to the
+// last of them, unless the user turned this off. Pages read again are not marked twice, so
+// going back never marks posts unread. It reports whether the posts stay unread because no
+// access token is set.
+func (p *Plugin) markSpoken(ctx *IntentContext, posts map[int]*model.Post, pos, end int) bool {
+	state := ctx.Conversation.Reading
+	if pos < state.Marked {
+		pos = state.Marked
+	}
+	if pos >= end {
+		return false
+	}
+
+	settings, err := p.getUserSettings(ctx.UserID)
+	if err != nil {
+		p.API.LogWarn("Cannot get settings", "err", err.Error())
+		return false
+	}
+	if !settings.markAsRead() {
+		return false
+	}
+	client, err := p.newRESTClient()
+	if err == errNoAccessToken {
+		return true
+	}
+	if err != nil {
+		p.API.LogWarn("Cannot mark posts as read", "err", err.Error())
+		return false
+	}
+
+	for i := pos; i < end; i++ {
+		lastOfChannel := i == end-1 || state.Items[i+1].Channel != state.Items[i].Channel
+		post, ok := posts[i]
+		if !lastOfChannel || !ok {
+			continue
+		}
+		if err := p.markReadUpTo(client, ctx.UserID, post); err != nil {
+			p.API.LogWarn("Cannot mark post as read", "post_id", post.Id, "err", err.Error())
+		}
+	}
+	state.Marked = end
+	return false
+}
+
+// handleMarkAllRead marks every channel of the user as read, across all teams.
+func (p *Plugin) handleMarkAllRead(ctx *IntentContext) (*OutgoingResponse, error) {
+	client, err := p.newRESTClient()
+	if err == errNoAccessToken {
+		return nil, newIntentError("mark_read.disabled", nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if question := ctx.confirm(ctx.T("mark_read.confirm")); question != nil {
+		return question, nil
+	}
+
+	memberships, err := p.getMemberships(ctx.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	marked := 0
+	for _, m := range memberships {
+		channel, cm := m.Channel, m.Member
+		if channel.TotalMsgCount <= cm.MsgCount && cm.MentionCount == 0 {
+			continue
+		}
+		if _, resp := client.ViewChannel(ctx.UserID, &model.ChannelView{ChannelId: channel.Id}); resp.Error != nil {
+			return nil, errors.Wrap(resp.Error, "failed to view channel")
+		}
+		marked++
+	}
+
+	ctx.Conversation.Reading = nil
+	if marked == 0 {
+		return getResponseWithText(ctx.T("reading.none")), nil
+	}
+	return getResponseWithText(ctx.T("mark_read.done", marked)), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// restRecorder stands in for the Mattermost REST API and records the calls made to it.
+type restRecorder struct {
+	lock  sync.Mutex
+	calls []string
+}
+
+func (rr *restRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	call := r.URL.Path
+	var view model.ChannelView
+	if json.NewDecoder(r.Body).Decode(&view) == nil && view.ChannelId != "" {
+		call += " " + view.ChannelId
+	}
+	rr.calls = append(rr.calls, call)
+	w.Write([]byte(`{"status": "OK"}`))
+}
+
+func (rr *restRecorder) take() []string {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+	calls := rr.calls
+	rr.calls = nil
+	return calls
+}
+
+func TestMarkSpoken(t *testing.T) {
+	rest := &restRecorder{}
+	server := httptest.NewServer(rest)
+	defer server.Close()
+
+	me := model.NewId()
+	other := model.NewId()
+	busy, done := model.NewId(), model.NewId()
+	busyPosts := []*model.Post{
+		newTestPost(busy, other, "one", 10),
+		newTestPost(busy, other, "two", 20),
+		newTestPost(busy, me, "mine", 25),
+		newTestPost(busy, other, "three", 30),
+	}
+	donePost := newTestPost(done, other, "only", 40)
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewString(server.URL)}})
+	api.On("GetPostsSince", busy, int64(20)).Return(newPostList(busyPosts[1:]...), nil)
+	api.On("GetPostsSince", done, int64(40)).Return(newPostList(donePost), nil)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{AccessToken: "token"})
+
+	state := &readingState{
+		Channels: []readingChannel{{ID: busy}, {ID: done}},
+		Items: []readingItem{
+			{Channel: 0, PostID: busyPosts[0].Id},
+			{Channel: 0, PostID: busyPosts[1].Id},
+			{Channel: 1, PostID: donePost.Id},
+			{Channel: 0, PostID: busyPosts[3].Id},
+		},
+	}
+	ctx := &IntentContext{Request: &IncomingRequest{}, UserID: me, Conversation: &conversation{UserID: me, Reading: state}}
+	posts := map[int]*model.Post{0: busyPosts[0], 1: busyPosts[1], 2: donePost}
+
+	p.markSpoken(ctx, posts, 0, 3)
+	assert.Equal(t, []string{
+		"/api/v4/users/" + me + "/posts/" + busyPosts[3].Id + "/set_unread",
+		"/api/v4/channels/members/" + me + "/view " + done,
+	}, rest.take())
+	assert.Equal(t, 3, state.Marked)
+
+	t.Run("pages read again are not marked", func(t *testing.T) {
+		p.markSpoken(ctx, posts, 0, 3)
+		assert.Empty(t, rest.take())
+	})
+
+	t.Run("users can opt out", func(t *testing.T) {
+		require.NoError(t, p.saveUserSettings(me, &userSettings{MarkAsRead: model.NewBool(false)}))
+		state.Marked = 0
+		p.markSpoken(ctx, posts, 0, 3)
+		assert.Empty(t, rest.take())
+	})
+
+	t.Run("nothing is marked without an access token", func(t *testing.T) {
+		require.NoError(t, p.saveUserSettings(me, &userSettings{}))
+		p.setConfiguration(&configuration{})
+		assert.True(t, p.markSpoken(ctx, posts, 0, 3))
+		assert.Empty(t, rest.take())
+	})
+}
+
+func TestUpdateSetting(t *testing.T) {
+	settings := &userSettings{}
+	assert.True(t, settings.markAsRead())
+
+	require.NoError(t, updateSetting(settings, nil, "mark-read", "off"))
+	assert.False(t, settings.markAsRead())
+	require.NoError(t, updateSetting(settings, nil, "mark-read", "on"))
+	assert.True(t, settings.markAsRead())
+
+	assert.Error(t, updateSetting(settings, nil, "mark-read", "maybe"))
+	assert.Error(t, updateSetting(settings, nil, "volume", "on"))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// minMatchScore is the score below which a name is not considered a match at all.
+	minMatchScore = 0.6
+
+	// confidentMatchScore is the score above which the best match is used without asking, as
+	// long as it is ahead of the runner-up by confidentMatchMargin.
+	confidentMatchScore  = 0.85
+	confidentMatchMargin = 0.1
+
+	// maxMatchOptions caps how many matches are offered when asking the user to pick one.
+	maxMatchOptions = 3
+)
+
+// match is a candidate for a name spoken by the user.
+type match struct {
+	ID    string
+	Name  string
+	Score float64
+}
+
+// normalizeName lowercases the name and reduces punctuation, such as the dashes of channel
+// names, to single spaces.
+func normalizeName(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// similarity rates two strings from 0 to 1 by their edit distance.
+func similarity(a, b string) float64 {
+	longest := len([]rune(a))
+	if n := len([]rune(b)); n > longest {
+		longest = n
+	}
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+// matchScore rates from 0 to 1 how well the spoken text matches a name, ignoring case,
+// punctuation and spacing.
+func matchScore(spoken, name string) float64 {
+	s, n := normalizeName(spoken), normalizeName(name)
+	if s == "" || n == "" {
+		return 0
+	}
+
+	score := similarity(s, n)
+	if joined := similarity(strings.Replace(s, " ", "", -1), strings.Replace(n, " ", "", -1)); joined > score {
+		score = joined
+	}
+	// Saying only some words of a long name, such as "release" for "release planning".
+	if strings.Contains(" "+n+" ", " "+s+" ") && score < 0.8 {
+		score = 0.8
+	}
+	return score
+}
+
+// rankMatches drops the candidates scoring below minMatchScore and orders the rest, best first.
+// It reports whether the best match is good enough to be used without asking the user.
+func rankMatches(candidates []match) ([]match, bool) {
+	var matches []match
+	for _, m := range candidates {
+		if m.Score >= minMatchScore {
+			matches = append(matches, m)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	if len(matches) == 0 {
+		return nil, false
+	}
+	if len(matches) == 1 {
+		return matches, true
+	}
+	confident := matches[0].Score >= confidentMatchScore && matches[0].Score-matches[1].Score >= confidentMatchMargin
+	if len(matches) > maxMatchOptions {
+		matches = matches[:maxMatchOptions]
+	}
+	return matches, confident
+}
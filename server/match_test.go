@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, levenshtein("", ""))
+	assert.Equal(t, 3, levenshtein("", "abc"))
+	assert.Equal(t, 3, levenshtein("kitten", "sitting"))
+	assert.Equal(t, 1, levenshtein("café", "cafe"))
+}
+
+func TestMatchScore(t *testing.T) {
+	assert.Equal(t, 1.0, matchScore("Town Square", "town-square"))
+	assert.Equal(t, 1.0, matchScore("off topic", "Off-Topic"))
+	assert.Equal(t, 1.0, matchScore("dev ops", "devops"))
+	assert.Equal(t, 0.8, matchScore("release", "Release Planning"))
+	assert.True(t, matchScore("town squares", "Town Square") > confidentMatchScore)
+	assert.True(t, matchScore("marketing", "Town Square") < minMatchScore)
+	assert.Equal(t, 0.0, matchScore("", "Town Square"))
+}
+
+func TestRankMatches(t *testing.T) {
+	matches, confident := rankMatches([]match{
+		{ID: "a", Score: 0.5},
+		{ID: "b", Score: 0.95},
+		{ID: "c", Score: 0.7},
+	})
+	assert.True(t, confident)
+	assert.Equal(t, "b", matches[0].ID)
+	assert.Len(t, matches, 2)
+
+	matches, confident = rankMatches([]match{{ID: "a", Score: 0.9}, {ID: "b", Score: 0.9}})
+	assert.False(t, confident)
+	assert.Len(t, matches, 2)
+
+	matches, confident = rankMatches([]match{{ID: "a", Score: 0.61}})
+	assert.True(t, confident)
+	assert.Len(t, matches, 1)
+
+	matches, confident = rankMatches([]match{{ID: "a", Score: 0.1}})
+	assert.False(t, confident)
+	assert.Empty(t, matches)
+
+	matches, _ = rankMatches([]match{{Score: 0.7}, {Score: 0.7}, {Score: 0.7}, {Score: 0.7}})
+	assert.Len(t, matches, maxMatchOptions)
+}
+
+func TestPickOption(t *testing.T) {
+	options := []choiceOption{
+		{ID: "a", Name: "Town Square in Acme"},
+		{ID: "b", Name: "Town Square in Globex"},
+	}
+
+	for spoken, id := range map[string]string{
+		"town square in globex": "b",
+		"acme":                  "a",
+		"the first one":         "a",
+		"second":                "b",
+		"the last one":          "b",
+	} {
+		option, ok := pickOption(translator("en"), spoken, options)
+		assert.True(t, ok, spoken)
+		assert.Equal(t, id, option.ID, spoken)
+	}
+
+	_, ok := pickOption(translator("en"), "third", options)
+	assert.False(t, ok)
+	_, ok = pickOption(translator("en"), "initech", options)
+	assert.False(t, ok)
+
+	for spoken, id := range map[string]string{
+		"der erste":   "a",
+		"den zweiten": "b",
+		"die letzte":  "b",
+	} {
+		option, ok := pickOption(translator("de"), spoken, options)
+		assert.True(t, ok, spoken)
+		assert.Equal(t, id, option.ID, spoken)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// maxMentionWords is how many words of a mention are spoken, the rest is left for Mattermost.
+const maxMentionWords = 25
+
+// channelMentionKeys notify everyone in the channel.
+var channelMentionKeys = []string{"@channel", "@all", "@here"}
+
+// mentionKeys returns the words that mention the user, as set in their notification
+// preferences.
+func mentionKeys(u *model.User) []string {
+	keys := []string{"@" + u.Username}
+	for _, key := range strings.Split(u.NotifyProps[model.MENTION_KEYS_NOTIFY_PROP], ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if u.NotifyProps[model.FIRST_NAME_NOTIFY_PROP] == "true" && u.FirstName != "" {
+		keys = append(keys, u.FirstName)
+	}
+	if u.NotifyProps[model.CHANNEL_MENTIONS_NOTIFY_PROP] == "true" {
+		keys = append(keys, channelMentionKeys...)
+	}
+	return keys
+}
+
+// mentionKeysPattern matches any of the keys as a whole word, regardless of case.
+func mentionKeysPattern(keys []string) *regexp.Regexp {
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		quoted[i] = regexp.QuoteMeta(key)
+	}
+	return regexp.MustCompile(`(?i)(?:^|[^\pL\pN_@.-])(?:` + strings.Join(quoted, "|") + `)(?:$|[^\pL\pN_-])`)
+}
+
+// isMuted reports whether the user muted the channel, which then only counts mentions.
+func isMuted(cm *model.ChannelMember) bool {
+	return cm.NotifyProps[model.MARK_UNREAD_NOTIFY_PROP] == model.CHANNEL_MARK_UNREAD_MENTION
+}
+
+// ignoresChannelMentions reports whether @channel, @all and @here do not notify the user in
+// the channel.
+func ignoresChannelMentions(cm *model.ChannelMember) bool {
+	return cm.NotifyProps[model.IGNORE_CHANNEL_MENTIONS_NOTIFY_PROP] == model.IGNORE_CHANNEL_MENTIONS_ON
+}
+
+// getMentions searches every team of the user for the posts mentioning them since they last
+// viewed the channel, oldest first. Direct messages, which are all meant for the user, are left
+// to read_direct_messages, and muted channels are left out unless includeMuted is set.
+func (p *Plugin) getMentions(userID string, includeMuted bool, users *userCache) ([]*unreadChannel, []*model.Post, error) {
+	u, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return nil, nil, errors.Wrap(appErr, "failed to get user")
+	}
+	memberships, err := p.getMemberships(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := mentionKeys(u)
+	withChannel, withoutChannel := mentionKeysPattern(keys), mentionKeysPattern(keys)
+	if u.NotifyProps[model.CHANNEL_MENTIONS_NOTIFY_PROP] == "true" {
+		withoutChannel = mentionKeysPattern(keys[:len(keys)-len(channelMentionKeys)])
+	}
+
+	// The mention counts tell which channels are worth searching.
+	channels := make(map[string]*unreadChannel)
+	viewed := make(map[string]*model.ChannelMember)
+	var names []string
+	var since int64
+	for _, m := range memberships {
+		channel, cm := m.Channel, m.Member
+		if cm.MentionCount == 0 || (isMuted(cm) && !includeMuted) || channel.Type == model.CHANNEL_DIRECT {
+			continue
+		}
+		channels[channel.Id] = &unreadChannel{Channel: channel, Name: users.channelName(channel, userID), Mentions: cm.MentionCount}
+		viewed[channel.Id] = cm
+		names = append(names, channel.Name)
+		if since == 0 || cm.LastViewedAt < since {
+			since = cm.LastViewedAt
+		}
+	}
+	if len(channels) == 0 {
+		return nil, nil, nil
+	}
+	teams, appErr := p.API.GetTeamsForUser(userID)
+	if appErr != nil {
+		return nil, nil, errors.Wrap(appErr, "failed to get teams")
+	}
+
+	// Search dates are whole days, so the search starts the day before the oldest view and
+	// the posts seen already are dropped below.
+	after := time.Unix(0, since*int64(time.Millisecond)).UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	seen := make(map[string]bool)
+	var posts []*model.Post
+	for _, team := range teams {
+		found, appErr := p.API.SearchPostsInTeam(team.Id, []*model.SearchParams{{
+			Terms:      strings.Join(keys, " "),
+			OrTerms:    true,
+			InChannels: names,
+			AfterDate:  after,
+		}})
+		if appErr != nil {
+			return nil, nil, errors.Wrap(appErr, "failed to search posts")
+		}
+		for _, post := range found {
+			// Searches match words loosely, and channel names only within a team.
+			cm, ok := viewed[post.ChannelId]
+			if !ok || seen[post.Id] || post.CreateAt <= cm.LastViewedAt || post.DeleteAt != 0 || post.UserId == userID || post.IsSystemMessage() {
+				continue
+			}
+			pattern := withChannel
+			if ignoresChannelMentions(cm) {
+				pattern = withoutChannel
+			}
+			if !pattern.MatchString(post.Message) {
+				continue
+			}
+			seen[post.Id] = true
+			posts = append(posts, post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreateAt < posts[j].CreateAt
+	})
+
+	var mentioned []*unreadChannel
+	for _, post := range posts {
+		channel := channels[post.ChannelId]
+		if len(channel.Posts) == 0 {
+			mentioned = append(mentioned, channel)
+		}
+		channel.Posts = append(channel.Posts, post)
+	}
+	return mentioned, posts, nil
+}
+
+// newMentionsState queues mentions for reading in the order they were made, up to total.
+func newMentionsState(channels []*unreadChannel, posts []*model.Post, total int) *readingState {
+	state := &readingState{Mentions: true}
+	index := make(map[string]int)
+	for _, channel := range channels {
+		index[channel.Channel.Id] = len(state.Channels)
+		state.Channels = append(state.Channels, readingChannel{ID: channel.Channel.Id, Name: channel.Name})
+	}
+	for _, post := range posts {
+		if len(state.Items) >= total {
+			state.Remaining++
+			continue
+		}
+		state.Items = append(state.Items, readingItem{Channel: index[post.ChannelId], PostID: post.Id})
+	}
+	return state
+}
+
+// trimWords shortens a message to its first words.
+func trimWords(message string, max int) string {
+	words := strings.Fields(message)
+	if len(words) <= max {
+		return strings.Join(words, " ")
+	}
+	return strings.Join(words[:max], " ") + "…"
+}
+
+// describeMention speaks who mentioned the user and the beginning of what they wrote.
+func describeMention(post *model.Post, users *userCache) string {
+	return users.T("mentions.wrote", vars{
+		"User":    users.displayName(post.UserId),
+		"Message": trimWords(plainMessage(post.Message, users), maxMentionWords),
+	})
+}
+
+// handleReadMentions reads out the posts mentioning the user since they last looked at each
+// channel, the oldest first, leaving out muted channels unless the user asks for them.
+func (p *Plugin) handleReadMentions(ctx *IntentContext) (*OutgoingResponse, error) {
+	users := newUserCache(p, ctx.T)
+	channels, posts, err := p.getMentions(ctx.UserID, ctx.Param("include_muted") == "true", users)
+	if err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		ctx.Conversation.Reading = nil
+		return getResponseWithText(ctx.T("mentions.none")), nil
+	}
+
+	_, total := p.readCaps()
+	ctx.Conversation.Reading = newMentionsState(channels, posts, total)
+	response, err := p.readPage(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	response.Prompt.FirstSimple = getResponseWithText(ctx.T("mentions.intro", len(posts))).Prompt.LastSimple
+	return response, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMentionKeysPattern(t *testing.T) {
+	u := &model.User{Username: "me", FirstName: "Maria", NotifyProps: model.StringMap{
+		model.MENTION_KEYS_NOTIFY_PROP:     "deploy, on call",
+		model.FIRST_NAME_NOTIFY_PROP:       "true",
+		model.CHANNEL_MENTIONS_NOTIFY_PROP: "true",
+	}}
+	keys := mentionKeys(u)
+	assert.Equal(t, []string{"@me", "deploy", "on call", "Maria", "@channel", "@all", "@here"}, keys)
+
+	pattern := mentionKeysPattern(keys)
+	for message, mentions := range map[string]bool{
+		"@me can you look?":         true,
+		"thanks @me.":               true,
+		"ping @meredith":            false,
+		"who is ON CALL tonight?":   true,
+		"the deployment is done":    false,
+		"maria, lunch?":             true,
+		"@channel standup in 5":     true,
+		"mail me at me@example.com": false,
+	} {
+		assert.Equal(t, mentions, pattern.MatchString(message), message)
+	}
+}
+
+func TestHandleReadMentions(t *testing.T) {
+	me := &model.User{Id: model.NewId(), Username: "me", NotifyProps: model.StringMap{model.CHANNEL_MENTIONS_NOTIFY_PROP: "true"}}
+	bob := &model.User{Id: model.NewId(), Username: "bob", FirstName: "Bob", LastName: "Builder"}
+	team := &model.Team{Id: model.NewId()}
+
+	town := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, TeamId: team.Id, Name: "town-square", DisplayName: "Town Square"}
+	random := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, TeamId: team.Id, Name: "random", DisplayName: "Random"}
+	muted := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, TeamId: team.Id, Name: "muted", DisplayName: "Muted"}
+	dm := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_DIRECT, Name: model.GetDMNameFromIds(me.Id, bob.Id)}
+
+	api := &plugintest.API{}
+	api.On("GetTeamsForUser", me.Id).Return([]*model.Team{team}, nil)
+	api.On("GetChannelMembersForUser", team.Id, me.Id, 0, channelMembersPerPage).Return([]*model.ChannelMember{
+		{ChannelId: town.Id, MentionCount: 2, LastViewedAt: 100},
+		{ChannelId: random.Id, MentionCount: 1, LastViewedAt: 100, NotifyProps: model.StringMap{model.IGNORE_CHANNEL_MENTIONS_NOTIFY_PROP: model.IGNORE_CHANNEL_MENTIONS_ON}},
+		{ChannelId: muted.Id, MentionCount: 1, LastViewedAt: 100, NotifyProps: model.StringMap{model.MARK_UNREAD_NOTIFY_PROP: model.CHANNEL_MARK_UNREAD_MENTION}},
+		{ChannelId: dm.Id, MentionCount: 3, LastViewedAt: 100},
+	}, nil)
+	channels := []*model.Channel{town, random, muted, dm}
+	api.On("GetChannelsForTeamForUser", team.Id, me.Id, false).Return(channels, nil)
+	for _, u := range []*model.User{me, bob} {
+		api.On("GetUser", u.Id).Return(u, nil)
+	}
+	api.On("GetUserByUsername", "me").Return(me, nil)
+
+	posts := []*model.Post{
+		newTestPost(town.Id, bob.Id, "@me seen already", 50),
+		newTestPost(town.Id, bob.Id, "@me please review the release notes, the ones for the next version that we are shipping on Thursday together with the new onboarding flow and all the fixes", 300),
+		newTestPost(muted.Id, bob.Id, "@me muted but asked for", 250),
+		newTestPost(random.Id, bob.Id, "@channel lunch is here", 200),
+		newTestPost(random.Id, bob.Id, "@me are you coming?", 210),
+		newTestPost(town.Id, bob.Id, "meeting with @meredith", 220),
+		newTestPost(town.Id, me.Id, "@channel my own post", 230),
+	}
+	var searched [][]string
+	api.On("SearchPostsInTeam", team.Id, mock.Anything).Return(func(teamID string, params []*model.SearchParams) []*model.Post {
+		searched = append(searched, params[0].InChannels)
+		var found []*model.Post
+		for _, post := range posts {
+			for _, name := range params[0].InChannels {
+				for _, c := range channels {
+					if c.Id == post.ChannelId && c.Name == name {
+						found = append(found, post)
+					}
+				}
+			}
+		}
+		return found
+	}, nil)
+	for _, post := range posts {
+		api.On("GetPost", post.Id).Return(post, nil)
+	}
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{PostsPerTurn: 3})
+	read := func(params map[string]interface{}) (*IntentContext, *OutgoingResponse) {
+		ctx := &IntentContext{Request: newIntentRequest("read_mentions", params), UserID: me.Id, Conversation: &conversation{UserID: me.Id}}
+		response, err := p.handleReadMentions(ctx)
+		require.NoError(t, err)
+		return ctx, response
+	}
+
+	ctx, response := read(nil)
+	assert.Equal(t, []string{"town-square", "random"}, searched[0])
+	assert.Equal(t, "You were mentioned 2 times:", *response.Prompt.FirstSimple.Speech)
+	assert.Equal(t, `In Random:
+Bob Builder mentioned you: 'me are you coming?'.
+In Town Square:
+Bob Builder mentioned you: 'me please review the release notes, the ones for the next version that we are shipping on Thursday together with the new onboarding flow and…'.
+That's all your mentions.`, displayText(t, response))
+	assert.Equal(t, posts[1].Id, ctx.Conversation.LastPostID)
+
+	_, response = read(map[string]interface{}{"include_muted": true})
+	assert.Equal(t, "You were mentioned 3 times:", *response.Prompt.FirstSimple.Speech)
+	assert.Contains(t, displayText(t, response), "In Muted:\nBob Builder mentioned you: 'me muted but asked for'.")
+
+	posts = nil
+	_, response = read(nil)
+	assert.Equal(t, "Nobody mentioned you since you last looked.", speech(t, response))
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"strings"
+)
+
+// Double Metaphone, after Lawrence Philips' algorithm, encodes a word into a primary and an
+// alternate key that sound alike for words pronounced alike, so that "Smyth" matches "Smith".
+
+const metaphoneKeyLength = 4
+
+type metaphone struct {
+	word          []rune
+	slavoGermanic bool
+
+	primary, alternate strings.Builder
+}
+
+// doubleMetaphone returns the primary and alternate keys of a single word.
+func doubleMetaphone(word string) (string, string) {
+	m := &metaphone{word: []rune(strings.ToUpper(strings.TrimSpace(word)))}
+	if len(m.word) == 0 {
+		return "", ""
+	}
+	upper := string(m.word)
+	m.slavoGermanic = strings.ContainsAny(upper, "WK") || strings.Contains(upper, "CZ") || strings.Contains(upper, "WITZ")
+
+	i := 0
+	if m.contains(0, 2, "GN", "KN", "PN", "WR", "PS") {
+		i = 1
+	}
+	for i < len(m.word) && (m.primary.Len() < metaphoneKeyLength || m.alternate.Len() < metaphoneKeyLength) {
+		switch m.at(i) {
+		case 'A', 'E', 'I', 'O', 'U', 'Y':
+			if i == 0 {
+				m.add("A")
+			}
+			i++
+		case 'B':
+			m.add("P")
+			i = m.skip(i, 'B')
+		case 'Ç':
+			m.add("S")
+			i++
+		case 'C':
+			i = m.handleC(i)
+		case 'D':
+			i = m.handleD(i)
+		case 'F':
+			m.add("F")
+			i = m.skip(i, 'F')
+		case 'G':
+			i = m.handleG(i)
+		case 'H':
+			i = m.handleH(i)
+		case 'J':
+			i = m.handleJ(i)
+		case 'K':
+			m.add("K")
+			i = m.skip(i, 'K')
+		case 'L':
+			i = m.handleL(i)
+		case 'M':
+			m.add("M")
+			if m.at(i+1) == 'M' || (m.contains(i-1, 3, "UMB") && (i+1 == len(m.word)-1 || m.contains(i+2, 2, "ER"))) {
+				i += 2
+			} else {
+				i++
+			}
+		case 'N':
+			m.add("N")
+			i = m.skip(i, 'N')
+		case 'Ñ':
+			m.add("N")
+			i++
+		case 'P':
+			if m.at(i+1) == 'H' {
+				m.add("F")
+				i += 2
+			} else {
+				m.add("P")
+				if m.contains(i+1, 1, "P", "B") {
+					i += 2
+				} else {
+					i++
+				}
+			}
+		case 'Q':
+			m.add("K")
+			i = m.skip(i, 'Q')
+		case 'R':
+			if i == len(m.word)-1 && !m.slavoGermanic && m.contains(i-2, 2, "IE") && !m.contains(i-4, 2, "ME", "MA") {
+				m.addAlternate("R")
+			} else {
+				m.add("R")
+			}
+			i = m.skip(i, 'R')
+		case 'S':
+			i = m.handleS(i)
+		case 'T':
+			i = m.handleT(i)
+		case 'V':
+			m.add("F")
+			i = m.skip(i, 'V')
+		case 'W':
+			i = m.handleW(i)
+		case 'X':
+			i = m.handleX(i)
+		case 'Z':
+			i = m.handleZ(i)
+		default:
+			i++
+		}
+	}
+
+	return truncateKey(m.primary.String()), truncateKey(m.alternate.String())
+}
+
+func truncateKey(key string) string {
+	if len(key) > metaphoneKeyLength {
+		return key[:metaphoneKeyLength]
+	}
+	return key
+}
+
+func (m *metaphone) at(i int) rune {
+	if i < 0 || i >= len(m.word) {
+		return 0
+	}
+	return m.word[i]
+}
+
+// contains reports whether the length runes starting at start equal one of the values.
+func (m *metaphone) contains(start, length int, values ...string) bool {
+	if start < 0 || start+length > len(m.word) {
+		return false
+	}
+	s := string(m.word[start : start+length])
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *metaphone) isVowel(i int) bool {
+	return strings.ContainsRune("AEIOUY", m.at(i))
+}
+
+// skip moves past the letter at i, and past a doubled letter.
+func (m *metaphone) skip(i int, r rune) int {
+	if m.at(i+1) == r {
+		return i + 2
+	}
+	return i + 1
+}
+
+func (m *metaphone) add(s string) {
+	m.primary.WriteString(s)
+	m.alternate.WriteString(s)
+}
+
+func (m *metaphone) addBoth(primary, alternate string) {
+	m.primary.WriteString(primary)
+	m.alternate.WriteString(alternate)
+}
+
+func (m *metaphone) addAlternate(s string) {
+	m.alternate.WriteString(s)
+}
+
+func (m *metaphone) handleC(i int) int {
+	switch {
+	case m.isGermanicC(i):
+		m.add("K")
+		return i + 2
+	case i == 0 && m.contains(i, 6, "CAESAR"):
+		m.add("S")
+		return i + 2
+	case m.contains(i, 2, "CH"):
+		return m.handleCH(i)
+	case m.contains(i, 2, "CZ") && !m.contains(i-2, 4, "WICZ"):
+		m.addBoth("S", "X")
+		return i + 2
+	case m.contains(i+1, 3, "CIA"):
+		m.add("X")
+		return i + 3
+	case m.contains(i, 2, "CC") && !(i == 1 && m.at(0) == 'M'):
+		if m.contains(i+2, 1, "I", "E", "H") && !m.contains(i+2, 2, "HU") {
+			if (i == 1 && m.at(i-1) == 'A') || m.contains(i-1, 5, "UCCEE", "UCCES") {
+				m.add("KS")
+			} else {
+				m.add("X")
+			}
+			return i + 3
+		}
+		m.add("K")
+		return i + 2
+	case m.contains(i, 2, "CK", "CG", "CQ"):
+		m.add("K")
+		return i + 2
+	case m.contains(i, 2, "CI", "CE", "CY"):
+		if m.contains(i, 3, "CIO", "CIE", "CIA") {
+			m.addBoth("S", "X")
+		} else {
+			m.add("S")
+		}
+		return i + 2
+	}
+
+	m.add("K")
+	switch {
+	case m.contains(i+1, 2, " C", " Q", " G"):
+		return i + 3
+	case m.contains(i+1, 1, "C", "K", "Q") && !m.contains(i+1, 2, "CE", "CI"):
+		return i + 2
+	default:
+		return i + 1
+	}
+}
+
+// isGermanicC matches a C pronounced K, as in "bacher" or "chianti".
+func (m *metaphone) isGermanicC(i int) bool {
+	if m.contains(i, 4, "CHIA") {
+		return true
+	}
+	if i <= 1 || m.isVowel(i-2) || !m.contains(i-1, 3, "ACH") {
+		return false
+	}
+	c := m.at(i + 2)
+	return (c != 'I' && c != 'E') || m.contains(i-2, 6, "BACHER", "MACHER")
+}
+
+func (m *metaphone) handleCH(i int) int {
+	switch {
+	case i > 0 && m.contains(i, 4, "CHAE"):
+		m.addBoth("K", "X")
+	case i == 0 && (m.contains(i+1, 5, "HARAC", "HARIS") || m.contains(i+1, 3, "HOR", "HYM", "HIA", "HEM")) && !m.contains(0, 5, "CHORE"):
+		m.add("K")
+	case m.contains(0, 4, "VAN ", "VON ") || m.contains(0, 3, "SCH") ||
+		m.contains(i-2, 6, "ORCHES", "ARCHIT", "ORCHID") || m.contains(i+2, 1, "T", "S") ||
+		((m.contains(i-1, 1, "A", "O", "U", "E") || i == 0) &&
+			(m.contains(i+2, 1, "L", "R", "N", "M", "B", "H", "F", "V", "W", " ") || i+1 == len(m.word)-1)):
+		m.add("K")
+	case i > 0 && m.contains(0, 2, "MC"):
+		m.add("K")
+	case i > 0:
+		m.addBoth("X", "K")
+	default:
+		m.add("X")
+	}
+	return i + 2
+}
+
+func (m *metaphone) handleD(i int) int {
+	if m.contains(i, 2, "DG") {
+		if m.contains(i+2, 1, "I", "E", "Y") {
+			m.add("J")
+			return i + 3
+		}
+		m.add("TK")
+		return i + 2
+	}
+	m.add("T")
+	if m.contains(i, 2, "DT", "DD") {
+		return i + 2
+	}
+	return i + 1
+}
+
+func (m *metaphone) handleG(i int) int {
+	switch {
+	case m.at(i+1) == 'H':
+		return m.handleGH(i)
+	case m.at(i+1) == 'N':
+		switch {
+		case i == 1 && m.isVowel(0) && !m.slavoGermanic:
+			m.addBoth("KN", "N")
+		case !m.contains(i+2, 2, "EY") && m.at(i+1) != 'Y' && !m.slavoGermanic:
+			m.addBoth("N", "KN")
+		default:
+			m.add("KN")
+		}
+		return i + 2
+	case m.contains(i+1, 2, "LI") && !m.slavoGermanic:
+		m.addBoth("KL", "L")
+		return i + 2
+	case i == 0 && (m.at(i+1) == 'Y' || m.contains(i+1, 2, "ES", "EP", "EB", "EL", "EY", "IB", "IL", "IN", "IE", "EI", "ER")):
+		m.addBoth("K", "J")
+		return i + 2
+	case (m.contains(i+1, 2, "ER") || m.at(i+1) == 'Y') && !m.contains(0, 6, "DANGER", "RANGER", "MANGER") &&
+		!m.contains(i-1, 1, "E", "I") && !m.contains(i-1, 3, "RGY", "OGY"):
+		m.addBoth("K", "J")
+		return i + 2
+	case m.contains(i+1, 1, "E", "I", "Y") || m.contains(i-1, 4, "AGGI", "OGGI"):
+		switch {
+		case m.contains(0, 4, "VAN ", "VON ") || m.contains(0, 3, "SCH") || m.contains(i+1, 2, "ET"):
+			m.add("K")
+		case m.contains(i+1, 3, "IER"):
+			m.add("J")
+		default:
+			m.addBoth("J", "K")
+		}
+		return i + 2
+	}
+	m.add("K")
+	return m.skip(i, 'G')
+}
+
+func (m *metaphone) handleGH(i int) int {
+	switch {
+	case i > 0 && !m.isVowel(i-1):
+		m.add("K")
+	case i == 0:
+		if m.at(i+2) == 'I' {
+			m.add("J")
+		} else {
+			m.add("K")
+		}
+	case (i > 1 && m.contains(i-2, 1, "B", "H", "D")) || (i > 2 && m.contains(i-3, 1, "B", "H", "D")) || (i > 3 && m.contains(i-4, 1, "B", "H")):
+		// Silent, as in "bough" or "night".
+	case i > 2 && m.at(i-1) == 'U' && m.contains(i-3, 1, "C", "G", "L", "R", "T"):
+		m.add("F")
+	case m.at(i-1) != 'I':
+		m.add("K")
+	}
+	return i + 2
+}
+
+func (m *metaphone) handleH(i int) int {
+	if (i == 0 || m.isVowel(i-1)) && m.isVowel(i+1) {
+		m.add("H")
+		return i + 2
+	}
+	return i + 1
+}
+
+func (m *metaphone) handleJ(i int) int {
+	if m.contains(i, 4, "JOSE") || m.contains(0, 4, "SAN ") {
+		if (i == 0 && m.at(i+4) == ' ') || len(m.word) == 4 || m.contains(0, 4, "SAN ") {
+			m.add("H")
+		} else {
+			m.addBoth("J", "H")
+		}
+		return i + 1
+	}
+
+	switch {
+	case i == 0:
+		m.addBoth("J", "A")
+	case m.isVowel(i-1) && !m.slavoGermanic && (m.at(i+1) == 'A' || m.at(i+1) == 'O'):
+		m.addBoth("J", "H")
+	case i == len(m.word)-1:
+		m.addBoth("J", "")
+	case !m.contains(i+1, 1, "L", "T", "K", "S", "N", "M", "B", "Z") && !m.contains(i-1, 1, "S", "K", "L"):
+		m.add("J")
+	}
+	return m.skip(i, 'J')
+}
+
+func (m *metaphone) handleL(i int) int {
+	if m.at(i+1) != 'L' {
+		m.add("L")
+		return i + 1
+	}
+
+	// Spanish "ll", as in "cabrillo", has no L sound.
+	n := len(m.word)
+	spanish := (i == n-3 && m.contains(i-1, 4, "ILLO", "ILLA", "ALLE")) ||
+		((m.contains(n-2, 2, "AS", "OS") || m.contains(n-1, 1, "A", "O")) && m.contains(i-1, 4, "ALLE"))
+	if spanish {
+		m.addBoth("L", "")
+	} else {
+		m.add("L")
+	}
+	return i + 2
+}
+
+func (m *metaphone) handleS(i int) int {
+	switch {
+	case m.contains(i-1, 3, "ISL", "YSL"):
+		return i + 1
+	case i == 0 && m.contains(i, 5, "SUGAR"):
+		m.addBoth("X", "S")
+		return i + 1
+	case m.contains(i, 2, "SH"):
+		if m.contains(i+1, 4, "HEIM", "HOEK", "HOLM", "HOLZ") {
+			m.add("S")
+		} else {
+			m.add("X")
+		}
+		return i + 2
+	case m.contains(i, 3, "SIO", "SIA") || m.contains(i, 4, "SIAN"):
+		if m.slavoGermanic {
+			m.add("S")
+		} else {
+			m.addBoth("S", "X")
+		}
+		return i + 3
+	case (i == 0 && m.contains(i+1, 1, "M", "N", "L", "W")) || m.contains(i+1, 1, "Z"):
+		m.addBoth("S", "X")
+		return m.skip(i, 'Z')
+	case m.contains(i, 2, "SC"):
+		return m.handleSC(i)
+	}
+
+	if i == len(m.word)-1 && m.contains(i-2, 2, "AI", "OI") {
+		m.addAlternate("S")
+	} else {
+		m.add("S")
+	}
+	if m.contains(i+1, 1, "S", "Z") {
+		return i + 2
+	}
+	return i + 1
+}
+
+func (m *metaphone) handleSC(i int) int {
+	switch {
+	case m.at(i+2) == 'H':
+		switch {
+		case m.contains(i+3, 2, "ER", "EN"):
+			m.addBoth("X", "SK")
+		case m.contains(i+3, 2, "OO", "UY", "ED", "EM"):
+			m.add("SK")
+		case i == 0 && !m.isVowel(3) && m.at(3) != 'W':
+			m.addBoth("X", "S")
+		default:
+			m.add("X")
+		}
+	case m.contains(i+2, 1, "I", "E", "Y"):
+		m.add("S")
+	default:
+		m.add("SK")
+	}
+	return i + 3
+}
+
+func (m *metaphone) handleT(i int) int {
+	switch {
+	case m.contains(i, 4, "TION"), m.contains(i, 3, "TIA", "TCH"):
+		m.add("X")
+		return i + 3
+	case m.contains(i, 2, "TH"), m.contains(i, 3, "TTH"):
+		if m.contains(i+2, 2, "OM", "AM") || m.contains(0, 4, "VAN ", "VON ") || m.contains(0, 3, "SCH") {
+			m.add("T")
+		} else {
+			m.addBoth("0", "T")
+		}
+		return i + 2
+	}
+	m.add("T")
+	if m.contains(i+1, 1, "T", "D") {
+		return i + 2
+	}
+	return i + 1
+}
+
+func (m *metaphone) handleW(i int) int {
+	switch {
+	case m.contains(i, 2, "WR"):
+		m.add("R")
+		return i + 2
+	case i == 0 && (m.isVowel(i+1) || m.contains(i, 2, "WH")):
+		if m.isVowel(i + 1) {
+			m.addBoth("A", "F")
+		} else {
+			m.add("A")
+		}
+	case (i == len(m.word)-1 && m.isVowel(i-1)) || m.contains(i-1, 5, "EWSKI", "EWSKY", "OWSKI", "OWSKY") || m.contains(0, 3, "SCH"):
+		m.addAlternate("F")
+	case m.contains(i, 4, "WICZ", "WITZ"):
+		m.addBoth("TS", "FX")
+		return i + 4
+	}
+	return i + 1
+}
+
+func (m *metaphone) handleX(i int) int {
+	if i == 0 {
+		m.add("S")
+		return i + 1
+	}
+	// Silent at the end of French words, as in "breaux".
+	if !(i == len(m.word)-1 && (m.contains(i-3, 3, "IAU", "EAU") || m.contains(i-2, 2, "AU", "OU"))) {
+		m.add("KS")
+	}
+	if m.contains(i+1, 1, "C", "X") {
+		return i + 2
+	}
+	return i + 1
+}
+
+func (m *metaphone) handleZ(i int) int {
+	if m.at(i+1) == 'H' {
+		m.add("J")
+		return i + 2
+	}
+	if m.contains(i+1, 2, "ZO", "ZI", "ZA") || (m.slavoGermanic && i > 0 && m.at(i-1) != 'T') {
+		m.addBoth("S", "TS")
+	} else {
+		m.add("S")
+	}
+	return m.skip(i, 'Z')
+}
+
+// soundsAlike reports whether two words share a Double Metaphone key.
+func soundsAlike(a, b string) bool {
+	a1, a2 := doubleMetaphone(a)
+	b1, b2 := doubleMetaphone(b)
+	for _, x := range []string{a1, a2} {
+		for _, y := range []string{b1, b2} {
+			if x != "" && x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
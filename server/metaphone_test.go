@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoubleMetaphone(t *testing.T) {
+	for word, keys := range map[string][2]string{
+		"Smith":     {"SM0", "XMT"},
+		"Schmidt":   {"XMT", "SMT"},
+		"Katherine": {"K0RN", "KTRN"},
+		"Philip":    {"FLP", "FLP"},
+		"Knight":    {"NT", "NT"},
+		"Xavier":    {"SF", "SFR"},
+		"Jose":      {"HS", "HS"},
+		"Alice":     {"ALS", "ALS"},
+		"Caesar":    {"SSR", "SSR"},
+		"Chianti":   {"KNT", "KNT"},
+		"Gnocchi":   {"NX", "NX"},
+		"":          {"", ""},
+	} {
+		primary, alternate := doubleMetaphone(word)
+		assert.Equal(t, keys[0], primary, word)
+		assert.Equal(t, keys[1], alternate, word)
+	}
+}
+
+func TestSoundsAlike(t *testing.T) {
+	assert.True(t, soundsAlike("Smith", "Smyth"))
+	assert.True(t, soundsAlike("Katherine", "Catherine"))
+	assert.True(t, soundsAlike("Jon", "John"))
+	assert.True(t, soundsAlike("Steven", "Stephen"))
+	assert.False(t, soundsAlike("Alice", "Bob"))
+	assert.False(t, soundsAlike("", ""))
+}
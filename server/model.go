@@ -20,36 +20,28 @@ type gIntent struct {
 	Params gIntentParams `json:"params,omitempty"`
 	Query  string        `json:"query,omitempty"`
 }
-type gIntentParams struct {
-	Status    *gIntentTimeParameterValue `json:"status,omitempty"`
-	Message   *gIntentTimeParameterValue `json:"message,omitempty"`
-	OtherUser *gIntentTimeParameterValue `json:"other_user,omitempty"`
-	Username  *gIntentTimeParameterValue `json:"username,omitempty"`
-}
 
-type gIntentParameterValue struct {
-	Original *string `json:"original,omitempty"`
-	Resolved string  `json:"resolved,omitempty"`
-}
+// Details: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Intent
+type gIntentParams map[string]gIntentParameterValue
 
-type gIntentTimeParameterValue struct {
-	Original *string `json:"original,omitempty"`
-	Resolved *string `json:"resolved,omitempty"`
+type gIntentParameterValue struct {
+	Original *string     `json:"original,omitempty"`
+	Resolved interface{} `json:"resolved,omitempty"`
 }
 
 type gScene struct {
-	Name              *string    `json:"name,omitempty"`
-	SlotFillingStatus string     `json:"slotFillingStatus,omitempty"`
-	Slots             gSlot      `json:"slots,omitempty"`
-	Next              gNextScene `json:"next,omitempty"`
+	Name              *string          `json:"name,omitempty"`
+	SlotFillingStatus string           `json:"slotFillingStatus,omitempty"`
+	Slots             map[string]gSlot `json:"slots,omitempty"`
+	Next              gNextScene       `json:"next,omitempty"`
 }
 
-// Need to be validated. Leaving with fake "name" property for now.
-// Details: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Scene
+// Details: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Slot
 type gSlot struct {
-	Username *struct {
-		Value string `json:"value,omitempty"`
-	} `json:"username,omitempty"`
+	Mode    string      `json:"mode,omitempty"`
+	Status  string      `json:"status,omitempty"`
+	Value   interface{} `json:"value,omitempty"`
+	Updated bool        `json:"updated,omitempty"`
 }
 
 // Need to be validated. Leaving with fake "name" property for now.
@@ -72,9 +64,34 @@ type gSessionParams struct {
 }
 
 type gTypeOverride struct {
-	Name    *string `json:"name,omitempty"`
-	Mode    string  `json:"mode,omitempty"`
-	Synonym string  `json:"synonym,omitempty"` // Need to be Updated. https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#SynonymType
+	Name    *string       `json:"name,omitempty"`
+	Mode    string        `json:"typeOverrideMode,omitempty"`
+	Synonym *gSynonymType `json:"synonym,omitempty"`
+}
+
+// Type override modes. Details https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#TypeOverrideMode
+const (
+	typeOverrideReplace = "TYPE_REPLACE"
+	typeOverrideMerge   = "TYPE_MERGE"
+)
+
+// Details https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#SynonymType
+type gSynonymType struct {
+	Entries []gEntry `json:"entries,omitempty"`
+}
+
+type gEntry struct {
+	Name     string         `json:"name"`
+	Synonyms []string       `json:"synonyms,omitempty"`
+	Display  *gEntryDisplay `json:"display,omitempty"`
+}
+
+type gEntryDisplay struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Image       *gImage   `json:"image,omitempty"`
+	Footer      string    `json:"footer,omitempty"`
+	OpenURL     *gOpenURL `json:"openUrl,omitempty"`
 }
 
 type gUser struct {
@@ -87,11 +104,18 @@ type gUser struct {
 	PackageEntitlements  []gUserPackageEntitlements `json:"packageEntitlements,omitempty"`
 }
 
-// Need to be validated. Leaving with fake "name" property for now.
 // Details https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#User
 type gUserParams struct {
-	UserName *string `json:"username,omitempty"`
+	BearerToken     *string `json:"bearerToken,omitempty"`     // Set by Google once the account is linked through OAuth
+	AssistantUserID *string `json:"assistantUserId,omitempty"` // Generated by the plugin to identify the Assistant user across conversations
 }
+
+// accountLinked is the accountLinkingStatus of users that linked their Mattermost account.
+const accountLinked = "LINKED"
+
+// userVerified is the verificationStatus of users whose user.params persist across conversations.
+const userVerified = "VERIFIED"
+
 type gUserEngagement struct {
 	PushNotificationIntents *string `json:"pushNotificationIntents,omitempty"` // Need to be Updated. https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Engagement
 	DailyUpdateIntents      string  `json:"dailyUpdateIntents,omitempty"`      // Need to be Updated. https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Engagement
@@ -110,6 +134,11 @@ type gHomeParams struct {
 type gDevice struct {
 	Capabilities *[]string `json:"capabilities,omitempty"`
 }
+
+// capabilityRichResponse is the device capability of screens that show cards, tables and lists.
+// Details: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Capability
+const capabilityRichResponse = "RICH_RESPONSE"
+
 type gContext struct {
 	Media *gMediaContext `json:"media,omitempty"`
 }
@@ -146,22 +175,33 @@ type gSimple struct {
 }
 
 type gContent struct {
-	Card       *gCard       `json:"card,omitempty"`
-	Image      *gImage      `json:"image,omitempty"`
-	Table      *gTable      `json:"table,omitempty"`
-	Media      *gMedia      `json:"media,omitempty"`
-	Collection *gCollection `json:"collection,omitempty"`
-	List       *gList       `json:"list,omitempty"`
+	Card             *gCard             `json:"card,omitempty"`
+	Image            *gImage            `json:"image,omitempty"`
+	Table            *gTable            `json:"table,omitempty"`
+	Media            *gMedia            `json:"media,omitempty"`
+	Collection       *gCollection       `json:"collection,omitempty"`
+	List             *gList             `json:"list,omitempty"`
+	CollectionBrowse *gCollectionBrowse `json:"collectionBrowse,omitempty"`
 }
 
+// Details: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Card
 type gCard struct {
 	Title     *string `json:"title,omitempty"`
 	Subtitle  string  `json:"subtitle,omitempty"`
 	Text      string  `json:"text,omitempty"`
-	Image     gImage  `json:"image,omitempty"`
+	Image     *gImage `json:"image,omitempty"`
 	ImageFill string  `json:"imageFill,omitempty"`
-	Button    string  `json:"button,omitempty"` // Need Updating: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Card
+	Button    *gLink  `json:"button,omitempty"`
 }
+
+// Image fill modes of cards, tables and collections.
+// Details: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#ImageFill
+const (
+	imageFillGray    = "GRAY"
+	imageFillWhite   = "WHITE"
+	imageFillCropped = "CROPPED"
+)
+
 type gImage struct {
 	URL    *string `json:"url,omitempty"`
 	Alt    string  `json:"alt,omitempty"`
@@ -169,33 +209,97 @@ type gImage struct {
 	Width  int     `json:"width,omitempty"`
 }
 
+// Details: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Table
 type gTable struct {
-	Title     *string `json:"title,omitempty"`
-	Subtitle  string  `json:"subtitle,omitempty"`
-	Image     gImage  `json:"image,omitempty"`
-	ImageFill string  `json:"imageFill,omitempty"`
-	Columns   string  `json:"columns,omitempty"` // Need Updating: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Table
-	Rows      string  `json:"rows,omitempty"`    // Need Updating: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Table
-	Button    string  `json:"button,omitempty"`  // Need Updating: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Card
+	Title    *string        `json:"title,omitempty"`
+	Subtitle string         `json:"subtitle,omitempty"`
+	Image    *gImage        `json:"image,omitempty"`
+	Columns  []gTableColumn `json:"columns,omitempty"`
+	Rows     []gTableRow    `json:"rows,omitempty"`
+	Button   *gLink         `json:"button,omitempty"`
 }
 
+type gTableColumn struct {
+	Header string `json:"header,omitempty"`
+	Align  string `json:"align,omitempty"`
+}
+
+// Column alignments. Details: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#HorizontalAlignment
+const (
+	alignLeading  = "LEADING"
+	alignCenter   = "CENTER"
+	alignTrailing = "TRAILING"
+)
+
+type gTableRow struct {
+	Cells   []gTableCell `json:"cells,omitempty"`
+	Divider bool         `json:"divider,omitempty"`
+}
+
+type gTableCell struct {
+	Text string `json:"text,omitempty"`
+}
+
+// Details: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Media
 type gMedia struct {
-	MediaType             *string  `json:"mediaType,omitempty"`
-	StartOffset           string   `json:"startOffset,omitempty"`
-	OptionalMediaControls []string `json:"optionalMediaControls,omitempty"`
-	MediaObjects          string   `json:"mediaObjects,omitempty"` // Need Updating: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Media
+	MediaType             *string        `json:"mediaType,omitempty"`   // AUDIO or MEDIA_STATUS_ACK
+	StartOffset           string         `json:"startOffset,omitempty"` // Duration in seconds, such as "3.5s"
+	OptionalMediaControls []string       `json:"optionalMediaControls,omitempty"`
+	MediaObjects          []gMediaObject `json:"mediaObjects,omitempty"`
+	RepeatMode            string         `json:"repeatMode,omitempty"`
+	FirstMediaObjectIndex int            `json:"firstMediaObjectIndex,omitempty"`
+}
+
+type gMediaObject struct {
+	Name        string       `json:"name,omitempty"`
+	Description string       `json:"description,omitempty"`
+	URL         *string      `json:"url,omitempty"`
+	Image       *gMediaImage `json:"image,omitempty"`
 }
+
+// gMediaImage is either a large image or an icon shown next to the media object.
+type gMediaImage struct {
+	Large *gImage `json:"large,omitempty"`
+	Icon  *gImage `json:"icon,omitempty"`
+}
+
+// The items of collections and lists are keys of the entries of a type override, which hold
+// their title, description and image.
+// Details: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Collection
 type gCollection struct {
-	Title     *string `json:"title,omitempty"`
-	Subtitle  string  `json:"subtitle,omitempty"`
-	Items     string  `json:"items,omitempty"` // Need Updating: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#Collection
-	ImageFill string  `json:"imageFill,omitempty"`
+	Title     *string           `json:"title,omitempty"`
+	Subtitle  string            `json:"subtitle,omitempty"`
+	Items     []gCollectionItem `json:"items,omitempty"`
+	ImageFill string            `json:"imageFill,omitempty"`
 }
 
+type gCollectionItem struct {
+	Key string `json:"key"`
+}
+
+// Details: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#CollectionBrowse
+type gCollectionBrowse struct {
+	Items     []gCollectionBrowseItem `json:"items,omitempty"`
+	ImageFill string                  `json:"imageFill,omitempty"`
+}
+
+type gCollectionBrowseItem struct {
+	Title         string    `json:"title"`
+	Description   string    `json:"description,omitempty"`
+	Footer        string    `json:"footer,omitempty"`
+	Image         *gImage   `json:"image,omitempty"`
+	OpenURIAction *gOpenURL `json:"openUriAction,omitempty"`
+}
+
+// Details: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#List
 type gList struct {
-	Title    *string `json:"title,omitempty"`
-	Subtitle string  `json:"subtitle,omitempty"`
-	Items    string  `json:"items,omitempty"` // Need Updating: https://developers.google.com/assistant/conversational/reference/rest/v1/TopLevel/fulfill#List
+	Title    *string     `json:"title,omitempty"`
+	Subtitle string      `json:"subtitle,omitempty"`
+	Items    []gListItem `json:"items,omitempty"`
+}
+
+type gListItem struct {
+	Key string `json:"key"`
 }
 
 type gLink struct {
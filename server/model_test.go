@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pruneZero drops the null, false, zero, empty and unspecified values of decoded JSON, which the
+// response model omits.
+func pruneZero(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			if item = pruneZero(item); item == nil {
+				delete(value, k)
+			} else {
+				value[k] = item
+			}
+		}
+		if len(value) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(value) == 0 {
+			return nil
+		}
+		for i, item := range value {
+			value[i] = pruneZero(item)
+		}
+	case bool:
+		if !value {
+			return nil
+		}
+	case float64:
+		if value == 0 {
+			return nil
+		}
+	case string:
+		if value == "" || value == "UNSPECIFIED" {
+			return nil
+		}
+	}
+	return v
+}
+
+func normalizeJSON(t *testing.T, data []byte) string {
+	var v interface{}
+	require.NoError(t, json.Unmarshal(data, &v))
+	normalized, err := json.Marshal(pruneZero(v))
+	require.NoError(t, err)
+	return string(normalized)
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "responses", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			fixture, err := ioutil.ReadFile(file)
+			require.NoError(t, err)
+
+			var response OutgoingResponse
+			require.NoError(t, json.Unmarshal(fixture, &response))
+			data, err := json.Marshal(&response)
+			require.NoError(t, err)
+
+			assert.JSONEq(t, normalizeJSON(t, fixture), normalizeJSON(t, data))
+		})
+	}
+}
+
+func TestTypeOverrideJSON(t *testing.T) {
+	data, err := json.Marshal(gTypeOverride{Name: model.NewString(userTypeName), Mode: typeOverrideMerge})
+	require.NoError(t, err)
+
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &fields))
+	assert.Equal(t, typeOverrideMerge, fields["typeOverrideMode"])
+	assert.NotContains(t, fields, "mode")
+}
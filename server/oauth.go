@@ -0,0 +1,463 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/pkg/errors"
+)
+
+// The plugin acts as the OAuth2 authorization server Google links Assistant users against. Note
+// that Mattermost strips the Authorization header from plugin requests, so client credentials
+// must be sent in the request body and the access token is read from user.params.bearerToken.
+const (
+	authCodeTTL     = 10 * time.Minute
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = 180 * 24 * time.Hour
+
+	// KV keys are limited to 50 characters, hence the short prefixes.
+	authCodeKeyPrefix     = "ac_"
+	accessTokenKeyPrefix  = "at_"
+	refreshTokenKeyPrefix = "rt_"
+	userTokensKeyPrefix   = "tokens_"
+
+	googleRedirectURL        = "https://oauth-redirect.googleusercontent.com/r/"
+	googleSandboxRedirectURL = "https://oauth-redirect-sandbox.googleusercontent.com/r/"
+)
+
+// oauthGrant is what an authorization code, access token or refresh token resolves to.
+type oauthGrant struct {
+	UserID      string `json:"user_id"`
+	ClientID    string `json:"client_id"`
+	RedirectURI string `json:"redirect_uri,omitempty"`
+	ExpiresAt   int64  `json:"expires_at"`
+
+	// RefreshKey links an access token to the refresh token it was issued with, so that
+	// revoking the refresh token also invalidates it.
+	RefreshKey string `json:"refresh_key,omitempty"`
+}
+
+type tokenResponse struct {
+	TokenType    string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Link Google Assistant</title></head>
+<body>
+<h3>Allow Google Assistant to act as {{.Username}} on Mattermost?</h3>
+<p>Google Assistant will be able to read your messages, send messages and change your status.</p>
+<form method="post">
+<input type="hidden" name="csrf" value="{{.CSRF}}">
+<input type="hidden" name="response_type" value="code">
+<input type="hidden" name="client_id" value="{{.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+<input type="hidden" name="state" value="{{.State}}">
+<button type="submit" name="allow" value="true">Allow</button>
+<button type="submit" name="allow" value="false">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// newToken returns a random, URL-safe token.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate token")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken derives the KV key suffix for a token, so tokens are never stored in the clear.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:20])
+}
+
+func secureEquals(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// validRedirectURI reports whether uri is the Google account linking endpoint of the project.
+func validRedirectURI(conf *configuration, uri string) bool {
+	return conf.ProjectID != "" &&
+		(uri == googleRedirectURL+conf.ProjectID || uri == googleSandboxRedirectURL+conf.ProjectID)
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// handleAuthorize implements the authorization endpoint. Users that are not logged in to
+// Mattermost are sent to the login page first, then asked to consent to the link.
+func (p *Plugin) handleAuthorize(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	conf := p.getConfiguration()
+	clientID := r.Form.Get("client_id")
+	redirectURI := r.Form.Get("redirect_uri")
+	state := r.Form.Get("state")
+	if conf.OAuthClientID == "" || clientID != conf.OAuthClientID || !validRedirectURI(conf, redirectURI) {
+		http.Error(w, "Invalid client or redirect URI", http.StatusBadRequest)
+		return
+	}
+
+	redirect := func(params url.Values) {
+		params.Set("state", state)
+		http.Redirect(w, r, redirectURI+"?"+params.Encode(), http.StatusFound)
+	}
+	if r.Form.Get("response_type") != "code" {
+		redirect(url.Values{"error": {"unsupported_response_type"}})
+		return
+	}
+
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		siteURL := ""
+		if config := p.API.GetConfig(); config != nil && config.ServiceSettings.SiteURL != nil {
+			siteURL = strings.TrimSuffix(*config.ServiceSettings.SiteURL, "/")
+		}
+		loginURL := siteURL + "/login?redirect_to=" + url.QueryEscape("/plugins/"+manifest.Id+"/oauth2/authorize?"+r.URL.RawQuery)
+		http.Redirect(w, r, loginURL, http.StatusFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		p.renderConsent(c, w, userID, clientID, redirectURI, state)
+		return
+	}
+
+	if r.Form.Get("allow") != "true" {
+		redirect(url.Values{"error": {"access_denied"}})
+		return
+	}
+
+	code, err := newToken()
+	if err != nil {
+		p.API.LogError("Cannot create authorization code", "err", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	grant := &oauthGrant{
+		UserID:      userID,
+		ClientID:    clientID,
+		RedirectURI: redirectURI,
+		ExpiresAt:   time.Now().Add(authCodeTTL).Unix(),
+	}
+	if err = p.kvSetJSON(authCodeKeyPrefix+hashToken(code), grant, authCodeTTL); err != nil {
+		p.API.LogError("Cannot store authorization code", "err", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	redirect(url.Values{"code": {code}})
+}
+
+func (p *Plugin) renderConsent(c *plugin.Context, w http.ResponseWriter, userID, clientID, redirectURI, state string) {
+	u, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		p.API.LogError("Cannot get user", "err", appErr.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	csrf := ""
+	if c != nil && c.SessionId != "" {
+		if session, sErr := p.API.GetSession(c.SessionId); sErr == nil {
+			csrf = session.GetCSRF()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := consentTemplate.Execute(w, map[string]string{
+		"Username":    u.Username,
+		"CSRF":        csrf,
+		"ClientID":    clientID,
+		"RedirectURI": redirectURI,
+		"State":       state,
+	})
+	if err != nil {
+		p.API.LogError("Cannot render consent page", "err", err.Error())
+	}
+}
+
+// handleToken implements the token endpoint for the authorization_code and refresh_token grants.
+func (p *Plugin) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	conf := p.getConfiguration()
+	clientID := r.PostForm.Get("client_id")
+	if conf.OAuthClientID == "" || clientID != conf.OAuthClientID || !secureEquals(r.PostForm.Get("client_secret"), conf.OAuthClientSecret) {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	var resp *tokenResponse
+	var err error
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		resp, err = p.exchangeAuthCode(clientID, r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"))
+	case "refresh_token":
+		resp, err = p.refreshAccessToken(clientID, r.PostForm.Get("refresh_token"))
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	if err == errInvalidToken {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	if err != nil {
+		p.API.LogError("Cannot issue token", "err", err.Error())
+		writeOAuthError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleRevoke implements token revocation. Unknown tokens are not an error, as per RFC 7009.
+func (p *Plugin) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	conf := p.getConfiguration()
+	if conf.OAuthClientID == "" || r.PostForm.Get("client_id") != conf.OAuthClientID || !secureEquals(r.PostForm.Get("client_secret"), conf.OAuthClientSecret) {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	hash := hashToken(r.PostForm.Get("token"))
+	for _, key := range []string{accessTokenKeyPrefix + hash, refreshTokenKeyPrefix + hash} {
+		if appErr := p.API.KVDelete(key); appErr != nil {
+			p.API.LogError("Cannot revoke token", "err", appErr.Error())
+			writeOAuthError(w, http.StatusInternalServerError, "server_error")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (p *Plugin) exchangeAuthCode(clientID, code, redirectURI string) (*tokenResponse, error) {
+	key := authCodeKeyPrefix + hashToken(code)
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get authorization code")
+	}
+	if data == nil {
+		return nil, errInvalidToken
+	}
+
+	// Codes are single use: only the request that manages to delete it may redeem it.
+	deleted, appErr := p.API.KVCompareAndDelete(key, data)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to consume authorization code")
+	}
+	if !deleted {
+		return nil, errInvalidToken
+	}
+
+	var grant oauthGrant
+	if err := json.Unmarshal(data, &grant); err != nil {
+		return nil, errors.Wrap(err, "failed to decode authorization code")
+	}
+	if grant.ClientID != clientID || grant.RedirectURI != redirectURI || time.Now().Unix() > grant.ExpiresAt {
+		return nil, errInvalidToken
+	}
+
+	refreshToken, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	refreshKey := refreshTokenKeyPrefix + hashToken(refreshToken)
+	refreshGrant := &oauthGrant{
+		UserID:    grant.UserID,
+		ClientID:  clientID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL).Unix(),
+	}
+	if err = p.kvSetJSON(refreshKey, refreshGrant, refreshTokenTTL); err != nil {
+		return nil, err
+	}
+	if err = p.addUserToken(grant.UserID, refreshKey); err != nil {
+		return nil, err
+	}
+
+	resp, err := p.issueAccessToken(refreshGrant, refreshKey)
+	if err != nil {
+		return nil, err
+	}
+	resp.RefreshToken = refreshToken
+
+	return resp, nil
+}
+
+func (p *Plugin) refreshAccessToken(clientID, refreshToken string) (*tokenResponse, error) {
+	refreshKey := refreshTokenKeyPrefix + hashToken(refreshToken)
+	var grant oauthGrant
+	found, err := p.kvGetJSON(refreshKey, &grant)
+	if err != nil {
+		return nil, err
+	}
+	if !found || grant.ClientID != clientID || time.Now().Unix() > grant.ExpiresAt {
+		return nil, errInvalidToken
+	}
+
+	return p.issueAccessToken(&grant, refreshKey)
+}
+
+func (p *Plugin) issueAccessToken(refreshGrant *oauthGrant, refreshKey string) (*tokenResponse, error) {
+	accessToken, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	grant := &oauthGrant{
+		UserID:     refreshGrant.UserID,
+		ClientID:   refreshGrant.ClientID,
+		ExpiresAt:  time.Now().Add(accessTokenTTL).Unix(),
+		RefreshKey: refreshKey,
+	}
+	if err = p.kvSetJSON(accessTokenKeyPrefix+hashToken(accessToken), grant, accessTokenTTL); err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		TokenType:   "Bearer",
+		AccessToken: accessToken,
+		ExpiresIn:   int64(accessTokenTTL / time.Second),
+	}, nil
+}
+
+// userIDForAccessToken resolves the Mattermost user an access token was issued to.
+func (p *Plugin) userIDForAccessToken(accessToken string) (string, error) {
+	var grant oauthGrant
+	found, err := p.kvGetJSON(accessTokenKeyPrefix+hashToken(accessToken), &grant)
+	if err != nil {
+		return "", err
+	}
+	if !found || time.Now().Unix() > grant.ExpiresAt {
+		return "", errInvalidToken
+	}
+
+	refresh, appErr := p.API.KVGet(grant.RefreshKey)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get refresh token")
+	}
+	if refresh == nil {
+		return "", errInvalidToken
+	}
+
+	u, appErr := p.API.GetUser(grant.UserID)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get user")
+	}
+	if u.DeleteAt != 0 {
+		return "", errInvalidToken
+	}
+
+	return u.Id, nil
+}
+
+// addUserToken records a refresh token key for the user, dropping keys that no longer exist.
+func (p *Plugin) addUserToken(userID, refreshKey string) error {
+	key := userTokensKeyPrefix + userID
+	for {
+		old, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to get user tokens")
+		}
+		var keys []string
+		if old != nil {
+			if err := json.Unmarshal(old, &keys); err != nil {
+				return errors.Wrap(err, "failed to decode user tokens")
+			}
+		}
+
+		live := []string{refreshKey}
+		for _, k := range keys {
+			if v, _ := p.API.KVGet(k); v != nil {
+				live = append(live, k)
+			}
+		}
+		data, err := json.Marshal(live)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode user tokens")
+		}
+
+		ok, appErr := p.API.KVCompareAndSet(key, old, data)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to set user tokens")
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+// revokeUserTokens revokes every refresh token issued to the user, which in turn invalidates
+// the access tokens issued with them.
+func (p *Plugin) revokeUserTokens(userID string) error {
+	key := userTokensKeyPrefix + userID
+	var keys []string
+	if _, err := p.kvGetJSON(key, &keys); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if appErr := p.API.KVDelete(k); appErr != nil {
+			return errors.Wrap(appErr, "failed to revoke token")
+		}
+	}
+	if appErr := p.API.KVDelete(key); appErr != nil {
+		return errors.Wrap(appErr, "failed to delete user tokens")
+	}
+	return nil
+}
+
+// linkedUserID resolves the Mattermost user behind a fulfillment request from the OAuth token
+// Google attaches once the Assistant user linked their account.
+func (p *Plugin) linkedUserID(req *IncomingRequest) (string, error) {
+	if req.User.AccountLinkingStatus != accountLinked || req.User.Params.BearerToken == nil {
+		return "", errInvalidToken
+	}
+	return p.userIDForAccessToken(*req.User.Params.BearerToken)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testClientSecret = "s3cret"
+
+func newOAuthTestPlugin(t *testing.T) (*Plugin, *model.User) {
+	user := &model.User{Id: model.NewId(), Username: "alice"}
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetUser", user.Id).Return(user, nil).Maybe()
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{
+		ProjectID:         testProjectID,
+		OAuthClientID:     "google",
+		OAuthClientSecret: testClientSecret,
+	})
+
+	return p, user
+}
+
+func authorize(t *testing.T, p *Plugin, userID string) string {
+	form := url.Values{
+		"response_type": {"code"},
+		"client_id":     {"google"},
+		"redirect_uri":  {googleRedirectURL + testProjectID},
+		"state":         {"xyz"},
+		"allow":         {"true"},
+	}
+	r := httptest.NewRequest(http.MethodPost, "/oauth2/authorize", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Mattermost-User-Id", userID)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(&plugin.Context{}, w, r)
+
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+	return location.Query().Get("code")
+}
+
+func requestToken(p *Plugin, form url.Values) *httptest.ResponseRecorder {
+	form.Set("client_id", "google")
+	if form.Get("client_secret") == "" {
+		form.Set("client_secret", testClientSecret)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(&plugin.Context{}, w, r)
+	return w
+}
+
+func TestOAuthFlow(t *testing.T) {
+	p, user := newOAuthTestPlugin(t)
+
+	code := authorize(t, p, user.Id)
+	require.NotEmpty(t, code)
+
+	exchange := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {googleRedirectURL + testProjectID},
+	}
+	w := requestToken(p, exchange)
+	require.Equal(t, http.StatusOK, w.Code)
+	var tokens tokenResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&tokens))
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	require.NotEmpty(t, tokens.AccessToken)
+	require.NotEmpty(t, tokens.RefreshToken)
+
+	userID, err := p.userIDForAccessToken(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, user.Id, userID)
+
+	t.Run("codes are single use", func(t *testing.T) {
+		w := requestToken(p, exchange)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid_grant")
+	})
+
+	t.Run("client secret is checked", func(t *testing.T) {
+		w := requestToken(p, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}, "client_secret": {"wrong"}})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		w := requestToken(p, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}})
+		require.Equal(t, http.StatusOK, w.Code)
+		var refreshed tokenResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&refreshed))
+		assert.NotEqual(t, tokens.AccessToken, refreshed.AccessToken)
+
+		userID, err := p.userIDForAccessToken(refreshed.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.Id, userID)
+	})
+
+	t.Run("tokens are stored hashed", func(t *testing.T) {
+		kv := p.API.(*plugintest.API)
+		data, _ := kv.KVGet(accessTokenKeyPrefix + tokens.AccessToken)
+		assert.Nil(t, data)
+	})
+
+	t.Run("disconnect revokes everything", func(t *testing.T) {
+		require.NoError(t, p.revokeUserTokens(user.Id))
+		_, err := p.userIDForAccessToken(tokens.AccessToken)
+		assert.Equal(t, errInvalidToken, err)
+
+		w := requestToken(p, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestOAuthAuthorizeValidation(t *testing.T) {
+	p, user := newOAuthTestPlugin(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/oauth2/authorize?response_type=code&client_id=google&redirect_uri="+url.QueryEscape("https://evil.example.com/"), nil)
+	r.Header.Set("Mattermost-User-Id", user.Id)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(&plugin.Context{}, w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOAuthRevoke(t *testing.T) {
+	p, user := newOAuthTestPlugin(t)
+
+	code := authorize(t, p, user.Id)
+	w := requestToken(p, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {googleRedirectURL + testProjectID},
+	})
+	var tokens tokenResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&tokens))
+
+	form := url.Values{"client_id": {"google"}, "client_secret": {testClientSecret}, "token": {tokens.RefreshToken}}
+	r := httptest.NewRequest(http.MethodPost, "/oauth2/revoke", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(&plugin.Context{}, w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	_, err := p.userIDForAccessToken(tokens.AccessToken)
+	assert.Equal(t, errInvalidToken, err, "revoking the refresh token invalidates its access tokens")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// userTypeName and channelTypeName are the types of the Actions console that the
+	// parameters naming users and channels use.
+	userTypeName    = "mattermost_user"
+	channelTypeName = "mattermost_channel"
+
+	// maxTypeOverrideEntries caps how many users and how many channels are sent per session.
+	maxTypeOverrideEntries = 25
+
+	typeOverridesKeyPrefix = "overrides_"
+	typeOverridesTTL       = time.Hour
+)
+
+// synonyms drops the empty and duplicate names, ignoring case.
+func synonyms(names ...string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, strings.TrimSpace(name))
+	}
+	return result
+}
+
+// buildTypeOverrides lists the people the user most recently exchanged direct messages with, and
+// the channels they most recently viewed, as entries of the user and channel types.
+func (p *Plugin) buildTypeOverrides(userID string) ([]gTypeOverride, error) {
+	memberships, err := p.getMemberships(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	type recentChannel struct {
+		channel *model.Channel
+		at      int64
+	}
+	var direct, channels []recentChannel
+	for _, m := range memberships {
+		channel, cm := m.Channel, m.Member
+		switch channel.Type {
+		case model.CHANNEL_DIRECT:
+			direct = append(direct, recentChannel{channel, channel.LastPostAt})
+		case model.CHANNEL_OPEN, model.CHANNEL_PRIVATE:
+			channels = append(channels, recentChannel{channel, cm.LastViewedAt})
+		}
+	}
+	byRecency := func(recent []recentChannel) {
+		sort.SliceStable(recent, func(i, j int) bool {
+			return recent[i].at > recent[j].at
+		})
+	}
+	byRecency(direct)
+	byRecency(channels)
+
+	var users []gEntry
+	for _, recent := range direct {
+		if len(users) >= maxTypeOverrideEntries {
+			break
+		}
+		otherID := recent.channel.GetOtherUserIdForDM(userID)
+		if otherID == "" || otherID == userID {
+			continue
+		}
+		u, appErr := p.API.GetUser(otherID)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to get user")
+		}
+		if u.DeleteAt != 0 || u.IsBot {
+			continue
+		}
+		users = append(users, gEntry{
+			Name:     u.Username,
+			Synonyms: synonyms(append(userNames(u), u.GetDisplayName(model.SHOW_FULLNAME))...),
+		})
+	}
+
+	var channelEntries []gEntry
+	seen := make(map[string]bool)
+	for _, recent := range channels {
+		if len(channelEntries) >= maxTypeOverrideEntries {
+			break
+		}
+		channel := recent.channel
+		if seen[channel.Name] {
+			continue
+		}
+		seen[channel.Name] = true
+		channelEntries = append(channelEntries, gEntry{
+			Name:     channel.Name,
+			Synonyms: synonyms(channel.DisplayName, strings.Replace(channel.Name, "-", " ", -1)),
+		})
+	}
+
+	var overrides []gTypeOverride
+	if len(users) > 0 {
+		overrides = append(overrides, gTypeOverride{
+			Name:    model.NewString(userTypeName),
+			Mode:    typeOverrideMerge,
+			Synonym: &gSynonymType{Entries: users},
+		})
+	}
+	if len(channelEntries) > 0 {
+		overrides = append(overrides, gTypeOverride{
+			Name:    model.NewString(channelTypeName),
+			Mode:    typeOverrideMerge,
+			Synonym: &gSynonymType{Entries: channelEntries},
+		})
+	}
+	return overrides, nil
+}
+
+// getTypeOverrides returns the type overrides of the user, computed at most once per
+// typeOverridesTTL.
+func (p *Plugin) getTypeOverrides(userID string) ([]gTypeOverride, error) {
+	key := typeOverridesKeyPrefix + userID
+	var overrides []gTypeOverride
+	found, err := p.kvGetJSON(key, &overrides)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return overrides, nil
+	}
+
+	overrides, err = p.buildTypeOverrides(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.kvSetJSON(key, overrides, typeOverridesTTL); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// withTypeOverrides teaches the Action the names of the people and channels the user deals with
+// most, once per session. Failing to do so does not fail the intent.
+func (p *Plugin) withTypeOverrides(h IntentHandler, next intentFunc) intentFunc {
+	return func(ctx *IntentContext) (*OutgoingResponse, error) {
+		response, err := next(ctx)
+		if err != nil || response == nil || !h.RequiresUser() || ctx.Conversation.TypeOverridesSent {
+			return response, err
+		}
+
+		overrides, err := p.getTypeOverrides(ctx.UserID)
+		if err != nil {
+			p.API.LogWarn("Cannot get type overrides", "err", err.Error())
+			return response, nil
+		}
+		response.Session.ID = ctx.Request.Session.ID
+		response.Session.TypeOverrides = append(response.Session.TypeOverrides, overrides...)
+		ctx.Conversation.TypeOverridesSent = true
+		return response, nil
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypeOverrides(t *testing.T) {
+	me := &model.User{Id: model.NewId(), Username: "me"}
+	alice := &model.User{Id: model.NewId(), Username: "alice", FirstName: "Alice", LastName: "Smith", Nickname: "Ali"}
+	bob := &model.User{Id: model.NewId(), Username: "bob"}
+	bot := &model.User{Id: model.NewId(), Username: "jira", IsBot: true}
+	team := &model.Team{Id: model.NewId()}
+
+	aliceDM := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_DIRECT, Name: model.GetDMNameFromIds(me.Id, alice.Id), LastPostAt: 300}
+	bobDM := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_DIRECT, Name: model.GetDMNameFromIds(me.Id, bob.Id), LastPostAt: 100}
+	botDM := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_DIRECT, Name: model.GetDMNameFromIds(me.Id, bot.Id), LastPostAt: 500}
+	town := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, Name: "town-square", DisplayName: "Town Square"}
+	dev := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_PRIVATE, Name: "dev-ops", DisplayName: "DevOps"}
+	archived := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, Name: "old", DisplayName: "Old", DeleteAt: 1}
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetTeamsForUser", me.Id).Return([]*model.Team{team}, nil).Once()
+	api.On("GetChannelMembersForUser", team.Id, me.Id, 0, channelMembersPerPage).Return([]*model.ChannelMember{
+		{ChannelId: bobDM.Id},
+		{ChannelId: aliceDM.Id},
+		{ChannelId: botDM.Id},
+		{ChannelId: town.Id, LastViewedAt: 10},
+		{ChannelId: dev.Id, LastViewedAt: 20},
+		{ChannelId: archived.Id, LastViewedAt: 30},
+	}, nil)
+	api.On("GetChannelsForTeamForUser", team.Id, me.Id, false).Return([]*model.Channel{aliceDM, bobDM, botDM, town, dev}, nil).Once()
+	for _, u := range []*model.User{alice, bob, bot} {
+		api.On("GetUser", u.Id).Return(u, nil)
+	}
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	registry := newIntentRegistry(p.withConversation, p.withTypeOverrides)
+	require.NoError(t, registry.Register(&intent{
+		name:         "hello",
+		requiresUser: true,
+		handle: func(ctx *IntentContext) (*OutgoingResponse, error) {
+			return getResponseWithText("hi"), nil
+		},
+	}))
+
+	req := newIntentRequest("hello", nil)
+	req.Session.ID = model.NewString("session")
+	response, err := registry.Dispatch(&IntentContext{Request: req, UserID: me.Id})
+	require.NoError(t, err)
+	assert.Equal(t, "session", *response.Session.ID)
+
+	data, err := json.Marshal(response.Session.TypeOverrides)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{
+		"name": "mattermost_user",
+		"typeOverrideMode": "TYPE_MERGE",
+		"synonym": {"entries": [
+			{"name": "alice", "synonyms": ["alice", "Smith", "Alice Smith", "Ali"]},
+			{"name": "bob", "synonyms": ["bob"]}
+		]}
+	}, {
+		"name": "mattermost_channel",
+		"typeOverrideMode": "TYPE_MERGE",
+		"synonym": {"entries": [
+			{"name": "dev-ops", "synonyms": ["DevOps", "dev ops"]},
+			{"name": "town-square", "synonyms": ["Town Square"]}
+		]}
+	}]`, string(data))
+
+	// The session knows the names now.
+	response, err = registry.Dispatch(&IntentContext{Request: req, UserID: me.Id})
+	require.NoError(t, err)
+	assert.Empty(t, response.Session.TypeOverrides)
+
+	// Other sessions get the names computed before.
+	req.Session.ID = model.NewString("other session")
+	response, err = registry.Dispatch(&IntentContext{Request: req, UserID: me.Id})
+	require.NoError(t, err)
+	assert.Len(t, response.Session.TypeOverrides, 2)
+
+	api.AssertExpectations(t)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// Pairing binds an Assistant user to a Mattermost account without OAuth: `/assistant connect`
+// shows a short-lived code that the user speaks to the Action.
+const (
+	pairingCodeDigits = 6
+	pairingCodeTTL    = 10 * time.Minute
+
+	// maxPairingAttempts limits how many wrong codes an Assistant user may try per hour.
+	maxPairingAttempts = 5
+	pairingAttemptsTTL = time.Hour
+
+	pairingCodeKeyPrefix     = "pair_"
+	userPairingCodeKeyPrefix = "paircode_"
+	pairingAttemptsKeyPrefix = "pairfail_"
+	bindingKeyPrefix         = "binding_"
+	userBindingsKeyPrefix    = "bindings_"
+)
+
+var errTooManyAttempts = errors.New("too many pairing attempts")
+
+type pairingCode struct {
+	UserID    string `json:"user_id"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type binding struct {
+	UserID   string `json:"user_id"`
+	CreateAt int64  `json:"create_at"`
+}
+
+// createPairingCode issues a new code for the user, replacing any code issued before.
+func (p *Plugin) createPairingCode(userID string) (string, error) {
+	var previous string
+	if _, err := p.kvGetJSON(userPairingCodeKeyPrefix+userID, &previous); err != nil {
+		return "", err
+	}
+	if previous != "" {
+		if appErr := p.API.KVDelete(pairingCodeKeyPrefix + previous); appErr != nil {
+			return "", errors.Wrap(appErr, "failed to delete previous pairing code")
+		}
+	}
+
+	data, err := json.Marshal(&pairingCode{
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(pairingCodeTTL).Unix(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode pairing code")
+	}
+
+	max := big.NewInt(1)
+	for i := 0; i < pairingCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	for {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to generate pairing code")
+		}
+		code := fmt.Sprintf("%0*d", pairingCodeDigits, n)
+
+		// Only claim codes nobody else currently holds.
+		ok, appErr := p.API.KVSetWithOptions(pairingCodeKeyPrefix+code, data, model.PluginKVSetOptions{
+			Atomic:          true,
+			ExpireInSeconds: int64(pairingCodeTTL / time.Second),
+		})
+		if appErr != nil {
+			return "", errors.Wrap(appErr, "failed to store pairing code")
+		}
+		if !ok {
+			continue
+		}
+
+		if err := p.kvSetJSON(userPairingCodeKeyPrefix+userID, code, pairingCodeTTL); err != nil {
+			return "", err
+		}
+		return code, nil
+	}
+}
+
+// parsePairingCode extracts the digits of a spoken code, such as "4 8 1 9".
+func parsePairingCode(spoken string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, spoken)
+}
+
+// spokenPairingCode reads the code from the resolved value, which is a number when the Action
+// types the parameter as one, falling back to the words the user said.
+func spokenPairingCode(v gIntentParameterValue) string {
+	var code string
+	switch resolved := v.Resolved.(type) {
+	case float64:
+		code = fmt.Sprintf("%0*d", pairingCodeDigits, int64(resolved))
+	case string:
+		code = parsePairingCode(resolved)
+	}
+	if len(code) != pairingCodeDigits && v.Original != nil {
+		code = parsePairingCode(*v.Original)
+	}
+	return code
+}
+
+// redeemPairingCode binds the Assistant user to the Mattermost user that requested the code.
+// Codes are single use and expire after pairingCodeTTL.
+func (p *Plugin) redeemPairingCode(assistantUserID, code string) (string, error) {
+	attempts := 0
+	if _, err := p.kvGetJSON(pairingAttemptsKeyPrefix+assistantUserID, &attempts); err != nil {
+		return "", err
+	}
+	if attempts >= maxPairingAttempts {
+		return "", errTooManyAttempts
+	}
+
+	key := pairingCodeKeyPrefix + code
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get pairing code")
+	}
+	var pc pairingCode
+	if data != nil {
+		if err := json.Unmarshal(data, &pc); err != nil {
+			return "", errors.Wrap(err, "failed to decode pairing code")
+		}
+	}
+	if data == nil || time.Now().Unix() > pc.ExpiresAt {
+		if err := p.kvSetJSON(pairingAttemptsKeyPrefix+assistantUserID, attempts+1, pairingAttemptsTTL); err != nil {
+			return "", err
+		}
+		return "", errInvalidToken
+	}
+
+	deleted, appErr := p.API.KVCompareAndDelete(key, data)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to consume pairing code")
+	}
+	if !deleted {
+		return "", errInvalidToken
+	}
+	if appErr = p.API.KVDelete(userPairingCodeKeyPrefix + pc.UserID); appErr != nil {
+		return "", errors.Wrap(appErr, "failed to delete pairing code")
+	}
+
+	b := &binding{UserID: pc.UserID, CreateAt: model.GetMillis()}
+	if err := p.kvSetJSON(bindingKeyPrefix+assistantUserID, b, 0); err != nil {
+		return "", err
+	}
+	if err := p.addUserBinding(pc.UserID, assistantUserID); err != nil {
+		return "", err
+	}
+
+	return pc.UserID, nil
+}
+
+// addUserBinding records the Assistant user among the bindings of the Mattermost user.
+func (p *Plugin) addUserBinding(userID, assistantUserID string) error {
+	key := userBindingsKeyPrefix + userID
+	for {
+		old, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to get user bindings")
+		}
+		var ids []string
+		if old != nil {
+			if err := json.Unmarshal(old, &ids); err != nil {
+				return errors.Wrap(err, "failed to decode user bindings")
+			}
+		}
+		for _, id := range ids {
+			if id == assistantUserID {
+				return nil
+			}
+		}
+
+		data, err := json.Marshal(append(ids, assistantUserID))
+		if err != nil {
+			return errors.Wrap(err, "failed to encode user bindings")
+		}
+		ok, appErr := p.API.KVCompareAndSet(key, old, data)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to set user bindings")
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+// boundUserID resolves the Mattermost user an Assistant user was paired with.
+func (p *Plugin) boundUserID(assistantUserID string) (string, error) {
+	var b binding
+	found, err := p.kvGetJSON(bindingKeyPrefix+assistantUserID, &b)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", errInvalidToken
+	}
+	return b.UserID, nil
+}
+
+// revokeUserBindings removes every Assistant binding and the pending pairing code of the user.
+func (p *Plugin) revokeUserBindings(userID string) error {
+	key := userBindingsKeyPrefix + userID
+	var ids []string
+	if _, err := p.kvGetJSON(key, &ids); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		// The Assistant user may have been paired with another account since.
+		boundID, err := p.boundUserID(id)
+		if err == errInvalidToken {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if boundID != userID {
+			continue
+		}
+		if appErr := p.API.KVDelete(bindingKeyPrefix + id); appErr != nil {
+			return errors.Wrap(appErr, "failed to delete binding")
+		}
+	}
+	if appErr := p.API.KVDelete(key); appErr != nil {
+		return errors.Wrap(appErr, "failed to delete user bindings")
+	}
+
+	var code string
+	if _, err := p.kvGetJSON(userPairingCodeKeyPrefix+userID, &code); err != nil {
+		return err
+	}
+	if code != "" {
+		if appErr := p.API.KVDelete(pairingCodeKeyPrefix + code); appErr != nil {
+			return errors.Wrap(appErr, "failed to delete pairing code")
+		}
+	}
+	if appErr := p.API.KVDelete(userPairingCodeKeyPrefix + userID); appErr != nil {
+		return errors.Wrap(appErr, "failed to delete pairing code")
+	}
+
+	return nil
+}
+
+// resolveUserID identifies the Mattermost user behind a fulfillment request, either through
+// OAuth account linking or through a pairing binding.
+func (p *Plugin) resolveUserID(req *IncomingRequest) (string, error) {
+	if req.User.AccountLinkingStatus == accountLinked && req.User.Params.BearerToken != nil {
+		return p.linkedUserID(req)
+	}
+	if req.User.Params.AssistantUserID == nil {
+		return "", errInvalidToken
+	}
+	userID, err := p.boundUserID(*req.User.Params.AssistantUserID)
+	if err != nil {
+		return "", err
+	}
+
+	u, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get user")
+	}
+	if u.DeleteAt != 0 {
+		return "", errInvalidToken
+	}
+	return u.Id, nil
+}
+
+// handlePairing redeems the pairing code spoken by the user.
+func (p *Plugin) handlePairing(ctx *IntentContext) (*OutgoingResponse, error) {
+	req := ctx.Request
+	if req.User.VerificationStatus != userVerified || req.User.Params.AssistantUserID == nil {
+		return getResponseWithText(ctx.T("pairing.not_verified")), nil
+	}
+
+	code := spokenPairingCode(req.Intent.Params["code"])
+	if len(code) != pairingCodeDigits {
+		return getResponseWithText(ctx.T("pairing.not_a_code")), nil
+	}
+
+	userID, err := p.redeemPairingCode(*req.User.Params.AssistantUserID, code)
+	if err == errTooManyAttempts {
+		return nil, newIntentError("pairing.too_many_attempts", nil)
+	}
+	if err == errInvalidToken {
+		return nil, newIntentError("pairing.invalid_code", nil)
+	}
+	if err != nil {
+		return nil, newIntentError("pairing.failed", err)
+	}
+
+	u, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return getResponseWithText(ctx.T("pairing.connected", vars{"Username": u.Username})), nil
+}
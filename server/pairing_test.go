@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPairing(t *testing.T) {
+	user := &model.User{Id: model.NewId(), Username: "alice"}
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetUser", user.Id).Return(user, nil).Maybe()
+
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	assistantUserID := model.NewId()
+	req := &IncomingRequest{}
+	req.User.Params.AssistantUserID = &assistantUserID
+
+	_, err := p.resolveUserID(req)
+	assert.Equal(t, errInvalidToken, err)
+
+	code, err := p.createPairingCode(user.Id)
+	require.NoError(t, err)
+	assert.Len(t, code, pairingCodeDigits)
+
+	t.Run("new codes replace old ones", func(t *testing.T) {
+		newCode, err := p.createPairingCode(user.Id)
+		require.NoError(t, err)
+		_, err = p.redeemPairingCode(model.NewId(), code)
+		assert.Equal(t, errInvalidToken, err)
+		code = newCode
+	})
+
+	userID, err := p.redeemPairingCode(assistantUserID, parsePairingCode(strings.Join(strings.Split(code, ""), " ")))
+	require.NoError(t, err)
+	assert.Equal(t, user.Id, userID)
+
+	resolved, err := p.resolveUserID(req)
+	require.NoError(t, err)
+	assert.Equal(t, user.Id, resolved)
+
+	t.Run("codes are single use", func(t *testing.T) {
+		_, err := p.redeemPairingCode(model.NewId(), code)
+		assert.Equal(t, errInvalidToken, err)
+	})
+
+	t.Run("attempts are limited", func(t *testing.T) {
+		guesser := model.NewId()
+		for i := 0; i < maxPairingAttempts; i++ {
+			_, err := p.redeemPairingCode(guesser, "000000")
+			assert.Equal(t, errInvalidToken, err)
+		}
+		_, err := p.redeemPairingCode(guesser, "000000")
+		assert.Equal(t, errTooManyAttempts, err)
+	})
+
+	t.Run("disconnect revokes bindings", func(t *testing.T) {
+		require.NoError(t, p.revokeUserBindings(user.Id))
+		_, err := p.resolveUserID(req)
+		assert.Equal(t, errInvalidToken, err)
+	})
+}
+
+func TestSpokenPairingCode(t *testing.T) {
+	assert.Equal(t, "048190", spokenPairingCode(gIntentParameterValue{Resolved: float64(48190)}))
+	assert.Equal(t, "481903", spokenPairingCode(gIntentParameterValue{Resolved: "4 8 1 9 0 3"}))
+	assert.Equal(t, "481903", spokenPairingCode(gIntentParameterValue{Original: model.NewString("my code is 481 903")}))
+}
@@ -4,11 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/pkg/errors"
 )
 
 // Plugin implements the interface expected by the Mattermost server to communicate between the server and plugin processes.
@@ -21,111 +24,87 @@ type Plugin struct {
 	// configuration is the active plugin configuration. Consult getConfiguration and
 	// setConfiguration for usage.
 	configuration *configuration
+
+	// keySet caches the keys used to verify fulfillment request signatures.
+	keySet keySetCache
+
+	// intents holds the handlers of fulfillment requests, populated in OnActivate.
+	intents *intentRegistry
+
+	// taskHandlers run the scheduled tasks of each kind, and stopSchedulerFunc stops running
+	// them, see startScheduler.
+	taskHandlers      map[string]taskHandler
+	stopSchedulerFunc func()
+
+	// botUserID is the bot posting reminders, ensured in OnActivate.
+	botUserID string
 }
 
 func getResponseWithText(s string) *OutgoingResponse {
-	return &OutgoingResponse{
-		Prompt: &gPrompt{
-			Override: false,
-			LastSimple: &gSimple{
-				Speech: &s,
-				Text:   s,
-			},
-		},
-	}
+	return newPrompt().Say(s).Response()
 }
 
-func (p *Plugin) handleSendDM(myUid, targetUsername, message string) (*OutgoingResponse, error) {
-	ou, err := p.API.GetUserByUsername(targetUsername)
-	if err != nil {
-		p.API.LogError("Cannot get other user", "err", err.Error())
-		return nil, err
+func (p *Plugin) handleSendDM(ctx *IntentContext) (*OutgoingResponse, error) {
+	myUid, message := ctx.UserID, ctx.Param("message")
+	targetID, question, err := p.resolveUserParam(ctx, "send_message", "username")
+	if err != nil || question != nil {
+		return question, err
 	}
-	dc, err := p.API.GetDirectChannel(myUid, ou.Id)
-	if err != nil {
-		p.API.LogError("Cannot create dm channel", "err", err.Error())
-		return nil, err
+	to := newUserCache(p, ctx.T).displayName(targetID)
+	if question := ctx.confirm(ctx.T("dm.confirm", vars{"Message": message, "User": to})); question != nil {
+		return question, nil
 	}
-	_, err = p.API.CreatePost(&model.Post{
-		ChannelId: dc.Id,
-		UserId:    myUid,
-		Message:   message,
-	})
-	if err != nil {
-		p.API.LogError("Cannot create post", "err", err.Error())
+	if err := p.sendDirectMessage(myUid, targetID, message); err != nil {
 		return nil, err
 	}
-	return getResponseWithText("Message sent!"), nil
+	return getResponseWithText(ctx.T("dm.sent")), nil
 }
 
-func (p *Plugin) handleStatusChange(newStatus, uid string) (*OutgoingResponse, error) {
-	oldStatus, err := p.API.GetUserStatus(uid)
-	if err != nil {
-		p.API.LogError("Cannot get status decode", "err", err.Error())
-		return nil, err
+// sendDirectMessage posts a message as the user to their direct channel with the target user.
+func (p *Plugin) sendDirectMessage(userID, targetID, message string) error {
+	dc, appErr := p.API.GetDirectChannel(userID, targetID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to create dm channel")
 	}
-	_, err = p.API.UpdateUserStatus(uid, newStatus)
-	if err != nil {
-		p.API.LogError("Cannot update status", "err", err.Error())
-		return nil, err
-	}
-	return getResponseWithText(fmt.Sprintf("Changing status from %s to %s", oldStatus.Status, newStatus)), nil
+	return p.createUserPost(userID, dc.Id, "", message)
 }
-func (p *Plugin) handleReadMessages(uid string) (*OutgoingResponse, error) {
-	teamUnreads, err := p.API.GetTeamsUnreadForUser(uid)
-	if err != nil {
-		p.API.LogError("Cannot get unread", "err", err.Error())
-		return nil, err
-	}
-
-	messages := []string{}
-	dms := make(map[string]bool)
-	for _, teamUnread := range teamUnreads {
-		cms, err := p.API.GetChannelMembersForUser(teamUnread.TeamId, uid, 0, 100)
-		if err != nil {
-			p.API.LogError("Cannot get members", "err", err.Error())
-			return nil, err
-		}
-		for _, cm := range cms {
-			if cm.MentionCount > 0 {
-				c, _ := p.API.GetChannel(cm.ChannelId)
-				if c.Type == model.CHANNEL_DIRECT {
-					oid := c.GetOtherUserIdForDM(uid)
-					ou, _ := p.API.GetUser(oid)
-					pl, _ := p.API.GetPostsForChannel(cm.ChannelId, 0, 100)
-					pl.SortByCreateAt()
-					p := pl.Posts[pl.Order[0]]
-					dms[fmt.Sprintf("'%s' wrote '%s'.", ou.Username, p.Message)] = true
-				}
-			}
 
-		}
+// createUserPost posts a message as the user, in reply to the thread of rootID if it is set.
+func (p *Plugin) createUserPost(userID, channelID, rootID, message string) error {
+	_, appErr := p.API.CreatePost(&model.Post{
+		ChannelId: channelID,
+		UserId:    userID,
+		RootId:    rootID,
+		Message:   message,
+	})
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to create post")
 	}
-	if len(dms) == 0 {
-		messages = append(messages, "You have no unread DMs")
-	} else {
-		messages = append([]string{"Here are your messages:"})
-		for m := range dms {
-			messages = append(messages, m)
-		}
+	return nil
+}
+
+// handleStatusChange sets the status the user asked for, for a while if they said until when.
+func (p *Plugin) handleStatusChange(ctx *IntentContext) (*OutgoingResponse, error) {
+	status, ok := parseStatus(ctx.Param("status"))
+	if !ok {
+		return nil, newIntentError("status.unknown", nil, vars{"Status": ctx.Param("status")})
 	}
-	return getResponseWithText(strings.Join(messages, "\n")), nil
+	return p.changeStatus(ctx, status)
 }
-func (p *Plugin) handleGetStatus(uid string) (*OutgoingResponse, error) {
+
+func (p *Plugin) handleGetStatus(ctx *IntentContext) (*OutgoingResponse, error) {
+	uid := ctx.UserID
 	oldStatus, err := p.API.GetUserStatus(uid)
 	if err != nil {
-		p.API.LogError("Cannot get status", "err", err.Error())
-		return nil, err
+		return nil, errors.Wrap(err, "failed to get status")
 	}
 	teamUnreads, err := p.API.GetTeamsUnreadForUser(uid)
 	if err != nil {
-		p.API.LogError("Cannot get unread", "err", err.Error())
-		return nil, err
+		return nil, errors.Wrap(err, "failed to get unread")
 	}
 	teams, err := p.API.GetTeamsForUser(uid)
 	if err != nil {
-		p.API.LogError("Cannot get teams", "err", err.Error())
-		return nil, err
+		return nil, errors.Wrap(err, "failed to get teams")
 	}
 	teamById := func(id string) *model.Team {
 		for _, team := range teams {
@@ -135,129 +114,112 @@ func (p *Plugin) handleGetStatus(uid string) (*OutgoingResponse, error) {
 		}
 		return nil
 	}
-	messages := []string{fmt.Sprintf("Your current status is '%s'.", oldStatus.Status)}
+	status := statusName(ctx, oldStatus.Status)
+	messages := []string{ctx.T("status.current", vars{"Status": status})}
+	table := &gTable{
+		Title: model.NewString(ctx.T("status.table_title")),
+		Columns: []gTableColumn{
+			{Header: ctx.T("status.table_team")},
+			{Header: ctx.T("status.table_unread"), Align: alignTrailing},
+			{Header: ctx.T("status.table_mentions"), Align: alignTrailing},
+		},
+	}
+	var unread, mentions int64
 	for _, teamUnread := range teamUnreads {
 		team := teamById(teamUnread.TeamId)
 		if team == nil {
 			continue
 		}
-		messages = append(messages, fmt.Sprintf("In team '%s' you have %d unread messages and had %d mentions.", team.DisplayName, teamUnread.MsgCount, teamUnread.MentionCount))
+		messages = append(messages, ctx.T("status.team_unread", teamUnread.MsgCount, vars{"Team": team.DisplayName, "Mentions": teamUnread.MentionCount}))
+		table.Rows = append(table.Rows, gTableRow{Cells: []gTableCell{
+			{Text: team.DisplayName},
+			{Text: fmt.Sprint(teamUnread.MsgCount)},
+			{Text: fmt.Sprint(teamUnread.MentionCount)},
+		}})
+		unread += teamUnread.MsgCount
+		mentions += teamUnread.MentionCount
 	}
-	return getResponseWithText(strings.Join(messages, "\n")), nil
+	if !ctx.HasScreen() || len(table.Rows) == 0 {
+		return getResponseWithText(strings.Join(messages, "\n")), nil
+	}
+
+	// The table tells the details, so the speech only sums them up.
+	summary := ctx.T("status.summary", unread, vars{"Status": status, "Mentions": mentions})
+	return newPrompt().Say(summary).Table(table).Response(), nil
 }
 
-// ServeHTTP demonstrates a plugin that handles HTTP requests by greeting the world.
+// ServeHTTP routes the OAuth2 account linking endpoints and the avatars shown on screens, and
+// treats everything else as a fulfillment request from Google.
 func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/oauth2/authorize":
+		p.handleAuthorize(c, w, r)
+	case "/oauth2/token":
+		p.handleToken(w, r)
+	case "/oauth2/revoke":
+		p.handleRevoke(w, r)
+	default:
+		if strings.HasPrefix(r.URL.Path, avatarsPath) {
+			p.handleAvatar(w, r)
+			return
+		}
+		p.handleFulfillment(w, r)
+	}
+}
+
+func (p *Plugin) handleFulfillment(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
 
+	if err := p.verifySignature(r); err != nil {
+		p.API.LogWarn("Rejected fulfillment request", "err", err.Error())
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
 	var dfr IncomingRequest
 	if err := json.NewDecoder(r.Body).Decode(&dfr); err != nil {
 		p.API.LogError("Cannot decode", "err", err.Error())
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
-	p.API.LogInfo("user", "t", dfr.Intent.Params.Username)
-	if dfr.Intent.Params.Username == nil || *dfr.Intent.Params.Username.Resolved == "" {
 
+	// Verified users keep user.params across conversations, so a generated ID identifies them
+	// for pairing.
+	newAssistantUserID := dfr.User.Params.AssistantUserID == nil && dfr.User.VerificationStatus == userVerified
+	if newAssistantUserID {
+		dfr.User.Params.AssistantUserID = model.NewString(model.NewId())
 	}
 
-	var response *OutgoingResponse
-	validateUser := func() string {
-		if dfr.User.Params.UserName == nil || *dfr.User.Params.UserName == "" {
-			response = getResponseWithText("Sorry, you didn't set your mattermost username!")
-			return ""
-		}
-		idB, err := p.API.KVGet(*dfr.User.Params.UserName)
-		if err != nil || idB == nil {
-			response = getResponseWithText("Sorry, you didn't enable google assistant integration!")
-			return ""
-		}
-		u, _ := p.API.GetUserByUsername(*dfr.User.Params.UserName)
-
-		return u.Id
+	ctx := &IntentContext{Request: &dfr}
+	response, err := p.intents.Dispatch(ctx)
+	if err != nil {
+		p.API.LogError("Cannot handle intent", "err", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
 	}
-
-	handler := *dfr.Handler.Name
-	// handler = "set_username"
-	switch handler {
-	case "get_status":
-		{
-			userId := validateUser()
-			if userId == "" {
-				break
-			}
-			var nErr error
-			response, nErr = p.handleGetStatus(userId)
-			if nErr != nil {
-				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-				return
-			}
-		}
-	case "read_direct_messages":
-		{
-			userId := validateUser()
-			if userId == "" {
-				break
-			}
-			var nErr error
-			response, nErr = p.handleReadMessages(userId)
-			if nErr != nil {
-				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-				return
-			}
-		}
-	case "change_status":
-		{
-			userId := validateUser()
-			if userId == "" {
-				break
-			}
-			var nErr error
-			response, nErr = p.handleStatusChange(*dfr.Intent.Params.Status.Resolved, userId)
-			if nErr != nil {
-				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-				return
-			}
-		}
-	case "set_username":
-		{
-			response = &OutgoingResponse{
-				User: &gUser{
-					Params: gUserParams{
-						UserName: dfr.Intent.Params.Username.Resolved, //model.NewString("sysadmin"),
-					},
-				},
-				Prompt: &gPrompt{},
-			}
-		}
-	case "send_message":
-		{
-			userId := validateUser()
-			if userId == "" {
-				break
-			}
-			var nErr error
-			response, nErr = p.handleSendDM(userId, dfr.Scene.Slots.Username.Value, *dfr.Intent.Params.Message.Resolved)
-			if nErr != nil {
-				response = getResponseWithText("Sorry, can't find that user!")
-			}
-		}
-	default:
-		{
-			response = getResponseWithText("Sorry, don't know what to do!")
+	if response.Prompt == nil {
+		response.Prompt = &gPrompt{}
+	}
+	if newAssistantUserID {
+		response.User = &gUser{
+			Params: gUserParams{
+				AssistantUserID: dfr.User.Params.AssistantUserID,
+			},
 		}
 	}
 	suggestions := []gSuggestions{
-		{Title: "Change status to away"},
-		{Title: "Status Report"},
-		{Title: "Read messages"},
-		{Title: "Write message"},
+		{Title: ctx.T("suggestion.change_status")},
+		{Title: ctx.T("suggestion.status_report")},
+		{Title: ctx.T("suggestion.read_messages")},
+		{Title: ctx.T("suggestion.write_message")},
+	}
+	if response.Prompt.Suggestions == nil {
+		response.Prompt.Suggestions = &suggestions
 	}
-	response.Prompt.Suggestions = &suggestions
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
@@ -273,6 +235,15 @@ func getAutocompleteData() *model.AutocompleteData {
 		}, {
 			Item:     "disconnect",
 			HelpText: "Disconnect Google Assistant account",
+		}, {
+			Item:     "settings",
+			HelpText: "Show or change your Google Assistant settings",
+		}, {
+			Item:     "reminders",
+			HelpText: "List, add or cancel your reminders",
+		}, {
+			Item:     "scheduled",
+			HelpText: "List, reschedule or cancel your scheduled messages",
 		},
 	})
 
@@ -282,7 +253,7 @@ func getAutocompleteData() *model.AutocompleteData {
 func (p *Plugin) returnHelp() (*model.CommandResponse, *model.AppError) {
 	return &model.CommandResponse{
 		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-		Text:         "Only connect/disconnect commands are supported!",
+		Text:         "Only connect/disconnect/settings/reminders/scheduled commands are supported!",
 	}, nil
 }
 func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
@@ -293,20 +264,43 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 			return p.returnHelp()
 		}
 		if parts[1] == "connect" {
-			u, _ := p.API.GetUser(args.UserId)
-			p.API.KVSet(u.Username, []byte("true"))
+			code, err := p.createPairingCode(args.UserId)
+			if err != nil {
+				p.API.LogError("Cannot create pairing code", "err", err.Error())
+				return &model.CommandResponse{
+					ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+					Text:         "Failed to create a pairing code, please try again.",
+				}, nil
+			}
+
 			return &model.CommandResponse{
 				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-				Text:         "Connected!",
+				Text: fmt.Sprintf("Your pairing code is **%s**. Within the next %d minutes, say \"Talk to Mattermost\" to your Google Assistant and then \"my code is %s\".",
+					code, int(pairingCodeTTL/time.Minute), strings.Join(strings.Split(code, ""), " ")),
 			}, nil
 		} else if parts[1] == "disconnect" {
-			u, _ := p.API.GetUser(args.UserId)
-			p.API.KVDelete(u.Username)
+			err := p.revokeUserTokens(args.UserId)
+			if err == nil {
+				err = p.revokeUserBindings(args.UserId)
+			}
+			if err != nil {
+				p.API.LogError("Cannot revoke account links", "err", err.Error())
+				return &model.CommandResponse{
+					ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+					Text:         "Failed to disconnect, please try again.",
+				}, nil
+			}
 
 			return &model.CommandResponse{
 				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
 				Text:         "Disconnected!",
 			}, nil
+		} else if parts[1] == "settings" {
+			return p.executeSettingsCommand(args.UserId, parts[2:])
+		} else if parts[1] == "reminders" {
+			return p.executeRemindersCommand(args.UserId, parts[2:])
+		} else if parts[1] == "scheduled" {
+			return p.executeScheduledCommand(args.UserId, parts[2:])
 		} else {
 			return p.returnHelp()
 		}
@@ -315,13 +309,96 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 	return &model.CommandResponse{}, nil
 }
 
+// registerIntents populates the intent registry with every intent the Action supports.
+func (p *Plugin) registerIntents() error {
+	p.intents = newIntentRegistry(p.speakErrors, p.logIntents, p.authenticate, p.localize, p.withConversation, p.withTypeOverrides, validateParams, p.confirmWrites)
+
+	for _, h := range []IntentHandler{
+		&intent{name: "get_status", requiresUser: true, handle: p.handleGetStatus},
+		&intent{name: "read_direct_messages", requiresUser: true, handle: p.handleReadMessages},
+		&intent{name: "read_channel", requiresUser: true, params: []string{"channel"}, handle: p.handleReadChannel},
+		&intent{name: "read_mentions", requiresUser: true, handle: p.handleReadMentions},
+		&intent{name: "search_messages", requiresUser: true, handle: p.handleSearchMessages},
+		&intent{name: "read_search_result", requiresUser: true, params: []string{"result"}, handle: p.handleReadSearchResult},
+		&intent{name: "list_threads", requiresUser: true, handle: p.handleListThreads},
+		&intent{name: "read_thread", requiresUser: true, handle: p.handleReadThread},
+		&intent{name: "read_next", requiresUser: true, handle: p.handleReadNext},
+		&intent{name: "read_previous", requiresUser: true, handle: p.handleReadPrevious},
+		&intent{name: "read_repeat", requiresUser: true, handle: p.handleReadRepeat},
+		&intent{name: "read_skip_channel", requiresUser: true, handle: p.handleReadSkipChannel},
+		&intent{name: "read_stop", requiresUser: true, handle: p.handleReadStop},
+		&intent{name: "mark_all_read", requiresUser: true, writes: true, handle: p.handleMarkAllRead},
+		&intent{name: "reply", requiresUser: true, writes: true, params: []string{"message"}, handle: p.handleReply},
+		&intent{name: "reply_thread", requiresUser: true, writes: true, params: []string{"message"}, handle: p.handleReplyThread},
+		&intent{name: "follow_thread", requiresUser: true, writes: true, handle: p.handleFollowThread},
+		&intent{name: "unfollow_thread", requiresUser: true, writes: true, handle: p.handleUnfollowThread},
+		&intent{name: "react", requiresUser: true, writes: true, params: []string{"emoji"}, handle: p.handleReact},
+		&intent{name: "remove_reaction", requiresUser: true, writes: true, handle: p.handleRemoveReaction},
+		&intent{name: "read_reactions", requiresUser: true, handle: p.handleReadReactions},
+		&intent{name: "save_post", requiresUser: true, writes: true, handle: p.handleSavePost},
+		&intent{name: "pin_post", requiresUser: true, writes: true, handle: p.handlePinPost},
+		&intent{name: "read_saved", requiresUser: true, handle: p.handleReadSaved},
+		&intent{name: "change_status", requiresUser: true, writes: true, params: []string{"status"}, handle: p.handleStatusChange},
+		&intent{name: "set_dnd", requiresUser: true, writes: true, handle: p.handleSetDND},
+		&intent{name: "set_custom_status", requiresUser: true, writes: true, params: []string{"text"}, handle: p.handleSetCustomStatus},
+		&intent{name: "clear_custom_status", requiresUser: true, writes: true, handle: p.handleClearCustomStatus},
+		&intent{name: "set_reminder", requiresUser: true, writes: true, params: []string{"text"}, handle: p.handleSetReminder},
+		&intent{name: "list_reminders", requiresUser: true, handle: p.handleListReminders},
+		&intent{name: "cancel_reminder", requiresUser: true, writes: true, params: []string{"reminder"}, handle: p.handleCancelReminder},
+		&intent{name: "send_message", requiresUser: true, writes: true, params: []string{"username", "message"}, handle: p.handleSendDM},
+		&intent{name: "schedule_message", requiresUser: true, writes: true, params: []string{"username", "message"}, handle: p.handleScheduleMessage},
+		&intent{name: "list_scheduled_messages", requiresUser: true, handle: p.handleListScheduledMessages},
+		&intent{name: "reschedule_message", requiresUser: true, writes: true, params: []string{"scheduled", "when"}, handle: p.handleRescheduleMessage},
+		&intent{name: "cancel_scheduled_message", requiresUser: true, writes: true, params: []string{"scheduled"}, handle: p.handleCancelScheduledMessage},
+		&intent{name: "send_channel_message", requiresUser: true, writes: true, params: []string{"channel", "message"}, handle: p.handleSendChannelMessage},
+		&intent{name: "choose", requiresUser: true, params: []string{"choice"}, handle: p.handleChoose},
+		&intent{name: "confirm", requiresUser: true, handle: p.handleConfirm},
+		&intent{name: "cancel", requiresUser: true, handle: p.handleCancel},
+		&intent{name: "pair_account", params: []string{"code"}, handle: p.handlePairing},
+	} {
+		if err := p.intents.Register(h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (p *Plugin) OnActivate() error {
+	bundlePath, err := p.API.GetBundlePath()
+	if err != nil {
+		return errors.Wrap(err, "failed to get bundle path")
+	}
+	if err := loadCatalog(filepath.Join(bundlePath, "server", "i18n")); err != nil {
+		return err
+	}
+	if err := p.registerIntents(); err != nil {
+		return err
+	}
+	botUserID, err := p.Helpers.EnsureBot(&model.Bot{
+		Username:    "assistant",
+		DisplayName: "Google Assistant",
+		Description: "Posts the reminders set through Google Assistant.",
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to ensure bot")
+	}
+	p.botUserID = botUserID
+
+	p.registerTasks()
+	p.startScheduler()
+
 	p.API.RegisterCommand(&model.Command{
 		Trigger:          "assistant",
 		AutoComplete:     true,
-		AutoCompleteHint: "(connect|disconnect)",
+		AutoCompleteHint: "(connect|disconnect|settings|reminders|scheduled)",
 		AutoCompleteDesc: "Google Assistant for Mattermost",
 		AutocompleteData: getAutocompleteData(),
 	})
 	return nil
 }
+
+func (p *Plugin) OnDeactivate() error {
+	p.stopScheduler()
+	return nil
+}
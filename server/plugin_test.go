@@ -1,28 +1,227 @@
 package main
 
 import (
-	"io/ioutil"
+	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
 	"github.com/stretchr/testify/assert"
 )
 
+// memKV backs the KV methods of a plugintest.API with an in-memory store.
+type memKV struct {
+	lock    sync.Mutex
+	values  map[string][]byte
+	expires map[string]time.Time
+}
+
+func newMemKV(api *plugintest.API) *memKV {
+	kv := &memKV{values: map[string][]byte{}, expires: map[string]time.Time{}}
+
+	api.On("KVGet", mock.Anything).Return(func(key string) []byte {
+		return kv.get(key)
+	}, checkKVKey).Maybe()
+	api.On("KVSet", mock.Anything, mock.Anything).Return(func(key string, value []byte) *model.AppError {
+		if appErr := checkKVKey(key); appErr != nil {
+			return appErr
+		}
+		kv.set(key, value, 0)
+		return nil
+	}).Maybe()
+	api.On("KVSetWithExpiry", mock.Anything, mock.Anything, mock.Anything).Return(func(key string, value []byte, ttl int64) *model.AppError {
+		if appErr := checkKVKey(key); appErr != nil {
+			return appErr
+		}
+		kv.set(key, value, ttl)
+		return nil
+	}).Maybe()
+	api.On("KVDelete", mock.Anything).Return(func(key string) *model.AppError {
+		if appErr := checkKVKey(key); appErr != nil {
+			return appErr
+		}
+		kv.set(key, nil, 0)
+		return nil
+	}).Maybe()
+	api.On("KVCompareAndSet", mock.Anything, mock.Anything, mock.Anything).Return(func(key string, old, value []byte) bool {
+		return checkKVKey(key) == nil && kv.compareAndSet(key, old, value, 0)
+	}, func(key string, old, value []byte) *model.AppError {
+		return checkKVKey(key)
+	}).Maybe()
+	api.On("KVSetWithOptions", mock.Anything, mock.Anything, mock.Anything).Return(func(key string, value []byte, options model.PluginKVSetOptions) bool {
+		if checkKVKey(key) != nil {
+			return false
+		}
+		if options.Atomic {
+			return kv.compareAndSet(key, options.OldValue, value, options.ExpireInSeconds)
+		}
+		kv.set(key, value, options.ExpireInSeconds)
+		return true
+	}, func(key string, value []byte, options model.PluginKVSetOptions) *model.AppError {
+		return checkKVKey(key)
+	}).Maybe()
+	api.On("KVCompareAndDelete", mock.Anything, mock.Anything).Return(func(key string, old []byte) bool {
+		return checkKVKey(key) == nil && kv.compareAndSet(key, old, nil, 0)
+	}, func(key string, old []byte) *model.AppError {
+		return checkKVKey(key)
+	}).Maybe()
+
+	return kv
+}
+
+// checkKVKey fails like the server does for keys longer than the KV store allows.
+func checkKVKey(key string) *model.AppError {
+	if utf8.RuneCountInString(key) > model.KEY_VALUE_KEY_MAX_RUNES {
+		return model.NewAppError("KVSet", "model.plugin_kvset.is_valid.key.app_error", nil, "key="+key, http.StatusBadRequest)
+	}
+	return nil
+}
+
+func (kv *memKV) get(key string) []byte {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	return kv.getLocked(key)
+}
+
+func (kv *memKV) set(key string, value []byte, ttl int64) {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	kv.setLocked(key, value, ttl)
+}
+
+func (kv *memKV) compareAndSet(key string, old, value []byte, ttl int64) bool {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	if !bytes.Equal(kv.getLocked(key), old) {
+		return false
+	}
+	kv.setLocked(key, value, ttl)
+	return true
+}
+
+func (kv *memKV) getLocked(key string) []byte {
+	if exp, ok := kv.expires[key]; ok && time.Now().After(exp) {
+		delete(kv.values, key)
+		delete(kv.expires, key)
+	}
+	return kv.values[key]
+}
+
+func (kv *memKV) setLocked(key string, value []byte, ttl int64) {
+	delete(kv.expires, key)
+	if value == nil {
+		delete(kv.values, key)
+		return
+	}
+	kv.values[key] = value
+	if ttl > 0 {
+		kv.expires[key] = time.Now().Add(time.Duration(ttl) * time.Second)
+	}
+}
+
+func TestMemKVKeyLength(t *testing.T) {
+	api := &plugintest.API{}
+	newMemKV(api)
+
+	longest := strings.Repeat("k", model.KEY_VALUE_KEY_MAX_RUNES)
+	assert.Nil(t, api.KVSet(longest, []byte("v")))
+	tooLong := longest + "k"
+	assert.NotNil(t, api.KVSet(tooLong, []byte("v")))
+	ok, appErr := api.KVCompareAndSet(tooLong, nil, []byte("v"))
+	assert.False(t, ok)
+	assert.NotNil(t, appErr)
+	value, appErr := api.KVGet(tooLong)
+	assert.Nil(t, value)
+	assert.NotNil(t, appErr)
+
+	userID := model.NewId()
+	for _, key := range []string{
+		taskKeyPrefix + statusTaskID(userID),
+		taskKeyPrefix + customStatusTaskID(userID),
+		taskKeyPrefix + model.NewId(),
+		reminderIndexKey(userID),
+		scheduledMessageIndexKey(userID),
+	} {
+		assert.Nil(t, checkKVKey(key), key)
+	}
+}
+
 func TestServeHTTP(t *testing.T) {
 	assert := assert.New(t)
+	signer := newTestSigner(t, "key-1")
+	keys, err := parseKeySet([]byte(signer.jwks))
+	assert.NoError(err)
+
+	api := &plugintest.API{}
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything).Maybe()
 	plugin := Plugin{}
-	w := httptest.NewRecorder()
-	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	plugin.SetAPI(api)
+	plugin.setConfiguration(&configuration{ProjectID: testProjectID, signingKeys: keys})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		plugin.ServeHTTP(nil, w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(http.StatusBadRequest, w.Result().StatusCode)
+	})
+
+	t.Run("rejects unsigned requests", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		plugin.ServeHTTP(nil, w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}")))
+		assert.Equal(http.StatusUnauthorized, w.Result().StatusCode)
+	})
+
+	t.Run("rejects forged requests", func(t *testing.T) {
+		forger := newTestSigner(t, "key-1")
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+		r.Header.Set(signatureHeader, forger.sign(t, validClaims()))
+		plugin.ServeHTTP(nil, w, r)
+		assert.Equal(http.StatusUnauthorized, w.Result().StatusCode)
+	})
+}
+
+func TestHandleGetStatus(t *testing.T) {
+	userID := model.NewId()
+	acme := &model.Team{Id: model.NewId(), DisplayName: "Acme"}
+	globex := &model.Team{Id: model.NewId(), DisplayName: "Globex"}
+
+	api := &plugintest.API{}
+	api.On("GetUserStatus", userID).Return(&model.Status{Status: model.STATUS_ONLINE}, nil)
+	api.On("GetTeamsForUser", userID).Return([]*model.Team{acme, globex}, nil)
+	api.On("GetTeamsUnreadForUser", userID).Return([]*model.TeamUnread{
+		{TeamId: acme.Id, MsgCount: 4, MentionCount: 1},
+		{TeamId: globex.Id, MsgCount: 2},
+	}, nil)
 
-	plugin.ServeHTTP(nil, w, r)
+	p := &Plugin{}
+	p.SetAPI(api)
 
-	result := w.Result()
-	assert.NotNil(result)
-	defer result.Body.Close()
-	bodyBytes, err := ioutil.ReadAll(result.Body)
-	assert.Nil(err)
-	bodyString := string(bodyBytes)
+	t.Run("speaker", func(t *testing.T) {
+		response, err := p.handleGetStatus(&IntentContext{Request: &IncomingRequest{}, UserID: userID})
+		assert.NoError(t, err)
+		assert.Equal(t, `Your current status is 'online'.
+In team 'Acme' you have 4 unread messages and had 1 mentions.
+In team 'Globex' you have 2 unread messages and had 0 mentions.`, speech(t, response))
+		assert.Nil(t, response.Prompt.Content)
+	})
 
-	assert.Equal("Hello, world!", bodyString)
+	t.Run("screen", func(t *testing.T) {
+		req := &IncomingRequest{Device: gDevice{Capabilities: &[]string{capabilityRichResponse}}}
+		response, err := p.handleGetStatus(&IntentContext{Request: req, UserID: userID})
+		assert.NoError(t, err)
+		assert.Equal(t, "Your current status is 'online'. You have 6 unread messages and had 1 mentions.", speech(t, response))
+		table := response.Prompt.Content.Table
+		assert.Len(t, table.Columns, 3)
+		assert.Equal(t, []gTableRow{
+			{Cells: []gTableCell{{Text: "Acme"}, {Text: "4"}, {Text: "1"}}},
+			{Cells: []gTableCell{{Text: "Globex"}, {Text: "2"}, {Text: "0"}}},
+		}, table.Rows)
+	})
 }
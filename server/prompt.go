@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// promptBuilder assembles a response, such as
+// newPrompt().Say("Here you go").Card(card).Suggest("Next").Response(). Each kind of content
+// replaces the previous one, as a prompt carries at most one.
+type promptBuilder struct {
+	response *OutgoingResponse
+
+	// speech and text are the sentences said so far, spoken with a pause between each when
+	// paused is set.
+	speech []string
+	text   []string
+	paused bool
+}
+
+func newPrompt() *promptBuilder {
+	return &promptBuilder{response: &OutgoingResponse{Prompt: &gPrompt{}}}
+}
+
+// Say adds a sentence that is both spoken and displayed.
+func (b *promptBuilder) Say(s string) *promptBuilder {
+	return b.SayDisplay(s, s)
+}
+
+// SayDisplay adds a sentence that is displayed differently than it is spoken.
+func (b *promptBuilder) SayDisplay(speech, text string) *promptBuilder {
+	b.speech = append(b.speech, speech)
+	b.text = append(b.text, text)
+	return b.simple()
+}
+
+// SayPaused adds sentences and pauses between every sentence of the prompt, which turns its
+// speech into SSML.
+func (b *promptBuilder) SayPaused(sentences ...string) *promptBuilder {
+	b.speech = append(b.speech, sentences...)
+	b.text = append(b.text, sentences...)
+	b.paused = true
+	return b.simple()
+}
+
+func (b *promptBuilder) simple() *promptBuilder {
+	speech := strings.Join(b.speech, "\n")
+	if b.paused {
+		speech = pausedSSML(b.speech)
+	}
+	b.response.Prompt.LastSimple = &gSimple{Speech: &speech, Text: strings.Join(b.text, "\n")}
+	return b
+}
+
+func (b *promptBuilder) content() *gContent {
+	b.response.Prompt.Content = &gContent{}
+	return b.response.Prompt.Content
+}
+
+// Card shows a basic card.
+func (b *promptBuilder) Card(card *gCard) *promptBuilder {
+	b.content().Card = card
+	return b
+}
+
+// Image shows an image on its own.
+func (b *promptBuilder) Image(image *gImage) *promptBuilder {
+	b.content().Image = image
+	return b
+}
+
+// Table shows a table.
+func (b *promptBuilder) Table(table *gTable) *promptBuilder {
+	b.content().Table = table
+	return b
+}
+
+// Media plays audio.
+func (b *promptBuilder) Media(media *gMedia) *promptBuilder {
+	b.content().Media = media
+	return b
+}
+
+// List shows entries the user can pick from. The entries are sent as a session override of
+// typeName, which must be the type of the slot filled by the selection.
+func (b *promptBuilder) List(title, typeName string, entries []gEntry) *promptBuilder {
+	list := &gList{Title: model.NewString(title)}
+	for _, e := range entries {
+		list.Items = append(list.Items, gListItem{Key: e.Name})
+	}
+	b.content().List = list
+	return b.overrideType(typeName, entries)
+}
+
+// Collection shows entries the user can pick from as a carousel, see List.
+func (b *promptBuilder) Collection(title, typeName string, entries []gEntry) *promptBuilder {
+	collection := &gCollection{Title: model.NewString(title)}
+	for _, e := range entries {
+		collection.Items = append(collection.Items, gCollectionItem{Key: e.Name})
+	}
+	b.content().Collection = collection
+	return b.overrideType(typeName, entries)
+}
+
+// CollectionBrowse shows items opening a web page when tapped.
+func (b *promptBuilder) CollectionBrowse(items []gCollectionBrowseItem) *promptBuilder {
+	b.content().CollectionBrowse = &gCollectionBrowse{Items: items}
+	return b
+}
+
+func (b *promptBuilder) overrideType(typeName string, entries []gEntry) *promptBuilder {
+	b.response.Session.TypeOverrides = append(b.response.Session.TypeOverrides, gTypeOverride{
+		Name:    model.NewString(typeName),
+		Mode:    typeOverrideReplace,
+		Synonym: &gSynonymType{Entries: entries},
+	})
+	return b
+}
+
+// Suggest adds suggestion chips.
+func (b *promptBuilder) Suggest(titles ...string) *promptBuilder {
+	suggestions := []gSuggestions{}
+	if b.response.Prompt.Suggestions != nil {
+		suggestions = *b.response.Prompt.Suggestions
+	}
+	for _, title := range titles {
+		suggestions = append(suggestions, gSuggestions{Title: title})
+	}
+	b.response.Prompt.Suggestions = &suggestions
+	return b
+}
+
+// Link adds a button opening a web page.
+func (b *promptBuilder) Link(name, url string) *promptBuilder {
+	b.response.Prompt.Link = &gLink{Name: model.NewString(name), Open: gOpenURL{URL: model.NewString(url)}}
+	return b
+}
+
+// Expect biases speech recognition of the user's answer towards the given phrases.
+func (b *promptBuilder) Expect(speech ...string) *promptBuilder {
+	b.response.Expected = &gExpected{Speech: speech}
+	return b
+}
+
+// Response returns the assembled response.
+func (b *promptBuilder) Response() *OutgoingResponse {
+	return b.response
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptBuilder(t *testing.T) {
+	t.Run("speech and suggestions", func(t *testing.T) {
+		response := newPrompt().Say("Hello.").SayDisplay("How are you?", "How are you? 🙂").Suggest("Fine").Suggest("Bad").Expect("fine", "bad").Response()
+		assert.Equal(t, "Hello.\nHow are you?", speech(t, response))
+		assert.Equal(t, "Hello.\nHow are you? 🙂", response.Prompt.LastSimple.Text)
+		assert.Equal(t, &[]gSuggestions{{Title: "Fine"}, {Title: "Bad"}}, response.Prompt.Suggestions)
+		assert.Equal(t, []string{"fine", "bad"}, response.Expected.Speech)
+	})
+
+	t.Run("content replaces content", func(t *testing.T) {
+		response := newPrompt().Say("Here").Image(&gImage{URL: model.NewString("https://example.com/a.png")}).Card(&gCard{Title: model.NewString("Card")}).Response()
+		assert.Nil(t, response.Prompt.Content.Image)
+		assert.Equal(t, "Card", *response.Prompt.Content.Card.Title)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		response := newPrompt().Say("Pick one").List("Channels", "mattermost_channel", []gEntry{
+			{Name: "town-square", Synonyms: []string{"Town Square"}, Display: &gEntryDisplay{Title: "Town Square"}},
+			{Name: "off-topic", Synonyms: []string{"Off-Topic"}, Display: &gEntryDisplay{Title: "Off-Topic"}},
+		}).Response()
+
+		data, err := json.Marshal(response.Prompt.Content)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"list": {"title": "Channels", "items": [{"key": "town-square"}, {"key": "off-topic"}]}}`, string(data))
+
+		require.Len(t, response.Session.TypeOverrides, 1)
+		assert.Equal(t, "mattermost_channel", *response.Session.TypeOverrides[0].Name)
+		assert.Equal(t, typeOverrideReplace, response.Session.TypeOverrides[0].Mode)
+		assert.Len(t, response.Session.TypeOverrides[0].Synonym.Entries, 2)
+	})
+}
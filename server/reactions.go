@@ -0,0 +1,282 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// emojiPerPage is how many custom emoji are fetched at a time.
+const emojiPerPage = 200
+
+// emojiWords maps the emoji most reacted with to the words they are called by, the first being
+// how they are spoken back. Other emoji are called by their name.
+var emojiWords = map[string][]string{
+	"+1":               {"thumbs up", "like", "plus one"},
+	"-1":               {"thumbs down", "dislike", "minus one"},
+	"heart":            {"heart", "love"},
+	"smile":            {"smile", "smiley", "happy"},
+	"laughing":         {"laughing", "laugh", "lol"},
+	"joy":              {"tears of joy", "crying laughing"},
+	"tada":             {"party popper", "tada", "party", "celebrate", "congrats"},
+	"eyes":             {"eyes", "looking"},
+	"white_check_mark": {"check mark", "check", "done"},
+	"fire":             {"fire"},
+	"clap":             {"clapping hands", "clap", "applause"},
+	"thinking_face":    {"thinking face", "thinking"},
+	"rocket":           {"rocket"},
+	"ok_hand":          {"ok hand", "ok", "okay"},
+	"pray":             {"folded hands", "pray", "thanks", "thank you"},
+	"100":              {"hundred points", "hundred"},
+	"cry":              {"crying face", "sad", "cry"},
+	"wave":             {"waving hand", "wave"},
+	"raised_hands":     {"raised hands", "hooray"},
+}
+
+// emojiFillerWords are the words around a spoken emoji, as in "react with a thumbs up to that".
+var emojiFillerWords = map[string]bool{"a": true, "an": true, "the": true, "with": true, "to": true, "that": true, "it": true, "this": true, "emoji": true, "reaction": true}
+
+// cleanEmojiName strips the words around a spoken emoji.
+func cleanEmojiName(spoken string) string {
+	var words []string
+	for _, word := range strings.Fields(normalizeName(spoken)) {
+		if !emojiFillerWords[word] {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// spokenEmoji returns how an emoji is called when spoken.
+func spokenEmoji(name string) string {
+	if words, ok := emojiWords[name]; ok {
+		return words[0]
+	}
+	return strings.Replace(name, "_", " ", -1)
+}
+
+// customEmojiNames returns the names of the custom emoji of the server, as many as could be
+// listed.
+func (p *Plugin) customEmojiNames() []string {
+	var names []string
+	for page := 0; ; page++ {
+		emojis, appErr := p.API.GetEmojiList(model.EMOJI_SORT_BY_NAME, page, emojiPerPage)
+		if appErr != nil {
+			p.API.LogWarn("Cannot get custom emoji", "err", appErr.Error())
+			return names
+		}
+		for _, emoji := range emojis {
+			names = append(names, emoji.Name)
+		}
+		if len(emojis) < emojiPerPage {
+			return names
+		}
+	}
+}
+
+// exactEmoji returns the emoji whose name or word is exactly the spoken text, ignoring the
+// spaces that custom emoji names leave out.
+func exactEmoji(spoken string, customNames []string) (string, bool) {
+	for name, words := range emojiWords {
+		for _, word := range words {
+			if spoken == word {
+				return name, true
+			}
+		}
+	}
+	name := strings.Replace(spoken, " ", "_", -1)
+	if _, ok := model.GetSystemEmojiId(name); ok {
+		return name, true
+	}
+	joined := strings.Replace(spoken, " ", "", -1)
+	for _, name := range customNames {
+		if strings.Replace(normalizeName(name), " ", "", -1) == joined {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// findEmoji finds the emoji named by voice, among the emoji most reacted with, the emoji the
+// server knows by name and its custom emoji.
+func (p *Plugin) findEmoji(spoken string) ([]match, bool) {
+	customNames := p.customEmojiNames()
+	// Words such as "it" may be part of the name, as in "ship it".
+	for _, text := range []string{normalizeName(spoken), cleanEmojiName(spoken)} {
+		if name, ok := exactEmoji(text, customNames); ok {
+			return []match{{ID: name, Name: spokenEmoji(name), Score: 1}}, true
+		}
+	}
+	spoken = cleanEmojiName(spoken)
+
+	// Names are sorted for matches scoring the same to be offered in a stable order.
+	names := make([]string, 0, len(emojiWords))
+	for name := range emojiWords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var candidates []match
+	for _, name := range names {
+		m := match{ID: name, Name: spokenEmoji(name)}
+		for _, word := range emojiWords[name] {
+			if score := matchScore(spoken, word); score > m.Score {
+				m.Score = score
+			}
+		}
+		candidates = append(candidates, m)
+	}
+	for _, name := range customNames {
+		candidates = append(candidates, match{ID: name, Name: spokenEmoji(name), Score: matchScore(spoken, name)})
+	}
+	return rankMatches(candidates)
+}
+
+// lastReadPost returns the post read out last in the session, which "that" refers to in
+// commands such as "thumbs up that". nothingReadID is the error spoken when there is none.
+func (p *Plugin) lastReadPost(ctx *IntentContext, nothingReadID string) (*model.Post, error) {
+	if ctx.Conversation.LastPostID == "" {
+		return nil, newIntentError(nothingReadID, nil)
+	}
+	post, appErr := p.API.GetPost(ctx.Conversation.LastPostID)
+	if appErr != nil || post.DeleteAt != 0 {
+		return nil, newIntentError("reply.deleted", nil)
+	}
+	return post, nil
+}
+
+// handleReact reacts as the user to the post read out last with the emoji they named, as in
+// "thumbs up that".
+func (p *Plugin) handleReact(ctx *IntentContext) (*OutgoingResponse, error) {
+	post, err := p.lastReadablePost(ctx, "reaction.nothing_read")
+	if err != nil {
+		return nil, err
+	}
+	if !p.API.HasPermissionToChannel(ctx.UserID, post.ChannelId, model.PERMISSION_ADD_REACTION) {
+		return nil, newIntentError("reaction.no_permission", nil)
+	}
+
+	emojiName, chosen := ctx.Choice("emoji")
+	if !chosen {
+		matches, confident := p.findEmoji(ctx.Param("emoji"))
+		if len(matches) == 0 {
+			return nil, newIntentError("reaction.unknown_emoji", nil, vars{"Emoji": ctx.Param("emoji")})
+		}
+		if !confident {
+			return ctx.askChoice("react", "emoji", matches), nil
+		}
+		emojiName = matches[0].ID
+	}
+
+	texts := vars{"Emoji": spokenEmoji(emojiName), "User": newUserCache(p, ctx.T).displayName(post.UserId)}
+	if question := ctx.confirm(ctx.T("reaction.confirm", texts)); question != nil {
+		return question, nil
+	}
+	if _, appErr := p.API.AddReaction(&model.Reaction{UserId: ctx.UserID, PostId: post.Id, EmojiName: emojiName}); appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to add reaction")
+	}
+	return getResponseWithText(ctx.T("reaction.added", texts)), nil
+}
+
+// handleRemoveReaction removes a reaction of the user from the post read out last: the one
+// they named, or their only one.
+func (p *Plugin) handleRemoveReaction(ctx *IntentContext) (*OutgoingResponse, error) {
+	post, err := p.lastReadablePost(ctx, "reaction.nothing_read")
+	if err != nil {
+		return nil, err
+	}
+	reactions, appErr := p.API.GetReactions(post.Id)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get reactions")
+	}
+
+	var candidates []match
+	for _, reaction := range reactions {
+		if reaction.UserId != ctx.UserID {
+			continue
+		}
+		m := match{ID: reaction.EmojiName, Name: spokenEmoji(reaction.EmojiName), Score: 1}
+		if ctx.HasParam("emoji") {
+			m.Score = 0
+			spoken := cleanEmojiName(ctx.Param("emoji"))
+			for _, word := range append([]string{reaction.EmojiName}, emojiWords[reaction.EmojiName]...) {
+				if score := matchScore(spoken, word); score > m.Score {
+					m.Score = score
+				}
+			}
+		}
+		candidates = append(candidates, m)
+	}
+	if len(candidates) == 0 {
+		return nil, newIntentError("reaction.none_yours", nil)
+	}
+
+	emojiName, chosen := ctx.Choice("emoji")
+	if !chosen {
+		matches, confident := rankMatches(candidates)
+		if len(matches) == 0 {
+			return nil, newIntentError("reaction.not_yours", nil, vars{"Emoji": ctx.Param("emoji")})
+		}
+		if !confident {
+			return ctx.askChoice("remove_reaction", "emoji", matches), nil
+		}
+		emojiName = matches[0].ID
+	}
+
+	texts := vars{"Emoji": spokenEmoji(emojiName)}
+	if question := ctx.confirm(ctx.T("reaction.confirm_remove", texts)); question != nil {
+		return question, nil
+	}
+	if appErr := p.API.RemoveReaction(&model.Reaction{UserId: ctx.UserID, PostId: post.Id, EmojiName: emojiName}); appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to remove reaction")
+	}
+	return getResponseWithText(ctx.T("reaction.removed", texts)), nil
+}
+
+// handleReadReactions speaks who reacted to the post read out last, and with which emoji, in
+// the order the emoji were first used.
+func (p *Plugin) handleReadReactions(ctx *IntentContext) (*OutgoingResponse, error) {
+	post, err := p.lastReadablePost(ctx, "reaction.nothing_read")
+	if err != nil {
+		return nil, err
+	}
+	reactions, appErr := p.API.GetReactions(post.Id)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get reactions")
+	}
+	if len(reactions) == 0 {
+		return getResponseWithText(ctx.T("reaction.none")), nil
+	}
+
+	users := newUserCache(p, ctx.T)
+	var emojiNames []string
+	reacted := make(map[string][]string)
+	mine := make(map[string]bool)
+	for _, reaction := range reactions {
+		if _, ok := reacted[reaction.EmojiName]; !ok {
+			emojiNames = append(emojiNames, reaction.EmojiName)
+			reacted[reaction.EmojiName] = nil
+		}
+		if reaction.UserId == ctx.UserID {
+			mine[reaction.EmojiName] = true
+			continue
+		}
+		reacted[reaction.EmojiName] = append(reacted[reaction.EmojiName], users.displayName(reaction.UserId))
+	}
+
+	var messages []string
+	for _, emojiName := range emojiNames {
+		names := reacted[emojiName]
+		// The user is named last, the list starting the sentence.
+		if mine[emojiName] {
+			names = append(names, ctx.T("reaction.you"))
+		}
+		messages = append(messages, ctx.T("reaction.item", vars{
+			"Users": spokenList(ctx.T, "list.and", names),
+			"Emoji": spokenEmoji(emojiName),
+		}))
+	}
+	return newPrompt().SayPaused(messages...).Response(), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindEmoji(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetEmojiList", model.EMOJI_SORT_BY_NAME, 0, emojiPerPage).Return([]*model.Emoji{{Name: "shipit"}, {Name: "party_parrot"}}, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	for spoken, want := range map[string]string{
+		"thumbs up that":      "+1",
+		"a heart":             "heart",
+		"white check mark":    "white_check_mark",
+		"sunglasses":          "sunglasses",
+		"party parrot":        "party_parrot",
+		"ship it":             "shipit",
+		"react with applause": "clap",
+	} {
+		matches, confident := p.findEmoji(spoken)
+		require.NotEmpty(t, matches, spoken)
+		assert.True(t, confident, spoken)
+		assert.Equal(t, want, matches[0].ID, spoken)
+	}
+
+	matches, _ := p.findEmoji("xylophone")
+	assert.Empty(t, matches)
+}
+
+func TestReactions(t *testing.T) {
+	me := &model.User{Id: model.NewId(), Username: "me"}
+	alice := &model.User{Id: model.NewId(), Username: "alice", FirstName: "Alice", LastName: "Smith"}
+	bob := &model.User{Id: model.NewId(), Username: "bob", FirstName: "Bob", LastName: "Builder"}
+	post := newTestPost(model.NewId(), alice.Id, "release is out", 10)
+
+	api := &plugintest.API{}
+	api.On("GetPost", post.Id).Return(post, nil)
+	api.On("GetEmojiList", model.EMOJI_SORT_BY_NAME, 0, emojiPerPage).Return([]*model.Emoji{}, nil)
+	api.On("HasPermissionToChannel", me.Id, post.ChannelId, model.PERMISSION_ADD_REACTION).Return(true)
+	api.On("HasPermissionToChannel", me.Id, post.ChannelId, model.PERMISSION_READ_CHANNEL).Return(true)
+	for _, u := range []*model.User{me, alice, bob} {
+		api.On("GetUser", u.Id).Return(u, nil)
+	}
+	reactions := []*model.Reaction{{UserId: bob.Id, PostId: post.Id, EmojiName: "tada"}}
+	api.On("GetReactions", post.Id).Return(func(string) []*model.Reaction { return reactions }, nil)
+	api.On("AddReaction", mock.Anything).Return(func(reaction *model.Reaction) *model.Reaction {
+		reactions = append(reactions, reaction)
+		return reaction
+	}, nil)
+	api.On("RemoveReaction", mock.Anything).Return(func(reaction *model.Reaction) *model.AppError {
+		for i, r := range reactions {
+			if r.UserId == reaction.UserId && r.EmojiName == reaction.EmojiName {
+				reactions = append(reactions[:i], reactions[i+1:]...)
+				break
+			}
+		}
+		return nil
+	})
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	c := &conversation{UserID: me.Id, LastPostID: post.Id}
+	dispatch := func(handle intentFunc, params map[string]interface{}) *OutgoingResponse {
+		response, err := handle(&IntentContext{Request: newIntentRequest("reaction", params), UserID: me.Id, Conversation: c})
+		if iErr, ok := err.(*intentError); ok {
+			return getResponseWithText(translateError(iErr))
+		}
+		require.NoError(t, err)
+		return response
+	}
+
+	response := dispatch(p.handleRemoveReaction, nil)
+	assert.Equal(t, "You haven't reacted to that message.", speech(t, response))
+
+	response = dispatch(p.handleReact, map[string]interface{}{"emoji": "thumbs up"})
+	assert.Equal(t, "Reacted with thumbs up.", speech(t, response))
+	assert.Equal(t, &model.Reaction{UserId: me.Id, PostId: post.Id, EmojiName: "+1"}, reactions[1])
+
+	reactions = append(reactions, &model.Reaction{UserId: alice.Id, PostId: post.Id, EmojiName: "+1"})
+	response = dispatch(p.handleReadReactions, nil)
+	assert.Equal(t, "Bob Builder reacted with party popper.\nAlice Smith and you reacted with thumbs up.", displayText(t, response))
+
+	response = dispatch(p.handleRemoveReaction, map[string]interface{}{"emoji": "party"})
+	assert.Equal(t, "You haven't reacted with party to that message.", speech(t, response))
+	response = dispatch(p.handleRemoveReaction, nil)
+	assert.Equal(t, "Removed your thumbs up reaction.", speech(t, response))
+	assert.Len(t, reactions, 2)
+
+	t.Run("channel left", func(t *testing.T) {
+		gone := newTestPost(model.NewId(), alice.Id, "you can't read me anymore", 20)
+		api.On("GetPost", gone.Id).Return(gone, nil)
+		api.On("HasPermissionToChannel", me.Id, gone.ChannelId, model.PERMISSION_READ_CHANNEL).Return(false)
+		c.LastPostID = gone.Id
+		for _, handle := range []intentFunc{p.handleReact, p.handleRemoveReaction, p.handleReadReactions} {
+			response := dispatch(handle, map[string]interface{}{"emoji": "heart"})
+			assert.Equal(t, "Sorry, that message was deleted.", speech(t, response))
+		}
+	})
+
+	t.Run("nothing read", func(t *testing.T) {
+		c.LastPostID = ""
+		response := dispatch(p.handleReact, map[string]interface{}{"emoji": "heart"})
+		assert.Equal(t, "There is no message to react to. Say read messages first.", speech(t, response))
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// maxThreadTopicWords is how many words of the first post of a thread name what it is about.
+const maxThreadTopicWords = 8
+
+// collapseThreads queues the posts of a channel for reading, replies to the same thread being
+// read as a single item in place of the latest of them.
+func collapseThreads(posts []*model.Post) []readingItem {
+	replies := make(map[string]int)
+	latest := make(map[string]string)
+	for _, post := range posts {
+		if post.RootId != "" {
+			replies[post.RootId]++
+			latest[post.RootId] = post.Id
+		}
+	}
+
+	var items []readingItem
+	for _, post := range posts {
+		switch {
+		case post.RootId == "":
+			items = append(items, readingItem{PostID: post.Id})
+		case latest[post.RootId] == post.Id:
+			items = append(items, readingItem{PostID: post.Id, RootID: post.RootId, Replies: replies[post.RootId]})
+		}
+	}
+	return items
+}
+
+// describeThread speaks how many replies a thread got, and what it is about.
+func (p *Plugin) describeThread(item readingItem, users *userCache) string {
+	root, appErr := p.API.GetPost(item.RootID)
+	if appErr != nil || root.DeleteAt != 0 {
+		return users.T("reading.replies", item.Replies)
+	}
+	return users.T("reading.thread", item.Replies, vars{"Topic": threadTopic(root, users)})
+}
+
+// handleReadChannel reads out what is new in a channel named by voice, or its latest posts if
+// the user read everything already.
+func (p *Plugin) handleReadChannel(ctx *IntentContext) (*OutgoingResponse, error) {
+	channelID, question, err := p.resolveChannelParam(ctx, "read_channel", "channel")
+	if err != nil || question != nil {
+		return question, err
+	}
+	// Channels are only found among the user's own, but they may have lost access since.
+	if !p.API.HasPermissionToChannel(ctx.UserID, channelID, model.PERMISSION_READ_CHANNEL) {
+		return nil, newIntentError("channel.not_found", nil)
+	}
+	cm, appErr := p.API.GetChannelMember(channelID, ctx.UserID)
+	if appErr != nil {
+		return nil, newIntentError("channel.not_found", appErr)
+	}
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get channel")
+	}
+
+	perChannel, total := p.readCaps()
+	pl, appErr := p.API.GetPostsSince(channelID, cm.LastViewedAt)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get posts")
+	}
+	items := collapseThreads(unreadPosts(pl, ctx.UserID, cm.LastViewedAt))
+	unread := len(items) > 0
+	if !unread {
+		if pl, appErr = p.API.GetPostsForChannel(channelID, 0, perChannel); appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to get posts")
+		}
+		items = collapseThreads(unreadPosts(pl, "", 0))
+	}
+
+	users := newUserCache(p, ctx.T)
+	name := users.channelName(channel, ctx.UserID)
+	if len(items) == 0 {
+		ctx.Conversation.Reading = nil
+		return getResponseWithText(ctx.T("channel_reading.empty", vars{"Channel": name})), nil
+	}
+
+	state := &readingState{Channels: []readingChannel{{ID: channel.Id, Name: name, Direct: channel.Type == model.CHANNEL_DIRECT}}}
+	if len(items) > total {
+		state.Channels[0].Skipped = len(items) - total
+		items = items[len(items)-total:]
+	}
+	state.Items = items
+	if !unread {
+		// Posts read before are not marked again.
+		state.Marked = len(items)
+	}
+	ctx.Conversation.Reading = state
+
+	response, err := p.readPage(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	intro := ctx.T("channel_reading.new", vars{"Channel": name})
+	if !unread {
+		intro = ctx.T("channel_reading.latest", vars{"Channel": name})
+	}
+	response.Prompt.FirstSimple = getResponseWithText(intro).Prompt.LastSimple
+	return response, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollapseThreads(t *testing.T) {
+	root := newTestPost("c", "u", "root", 1)
+	first := newTestPost("c", "u", "first reply", 2)
+	first.RootId = root.Id
+	other := newTestPost("c", "u", "other", 3)
+	second := newTestPost("c", "u", "second reply", 4)
+	second.RootId = root.Id
+
+	assert.Equal(t, []readingItem{
+		{PostID: root.Id},
+		{PostID: other.Id},
+		{PostID: second.Id, RootID: root.Id, Replies: 2},
+	}, collapseThreads([]*model.Post{root, first, other, second}))
+}
+
+func TestHandleReadChannel(t *testing.T) {
+	me := &model.User{Id: model.NewId(), Username: "me"}
+	alice := &model.User{Id: model.NewId(), Username: "alice", FirstName: "Alice", LastName: "Smith"}
+	team := &model.Team{Id: model.NewId()}
+	town := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, TeamId: team.Id, Name: "town-square", DisplayName: "Town Square"}
+	random := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, TeamId: team.Id, Name: "random", DisplayName: "Random"}
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetTeamsForUser", me.Id).Return([]*model.Team{team}, nil)
+	api.On("GetChannelMembersForUser", team.Id, me.Id, 0, channelMembersPerPage).Return([]*model.ChannelMember{
+		{ChannelId: town.Id, LastViewedAt: 10}, {ChannelId: random.Id, LastViewedAt: 50},
+	}, nil)
+	api.On("GetChannelsForTeamForUser", team.Id, me.Id, false).Return([]*model.Channel{town, random}, nil)
+	for _, c := range []*model.Channel{town, random} {
+		api.On("GetChannel", c.Id).Return(c, nil)
+	}
+	api.On("GetChannelMember", town.Id, me.Id).Return(&model.ChannelMember{ChannelId: town.Id, LastViewedAt: 10}, nil)
+	api.On("HasPermissionToChannel", me.Id, town.Id, model.PERMISSION_READ_CHANNEL).Return(true)
+	api.On("HasPermissionToChannel", me.Id, random.Id, model.PERMISSION_READ_CHANNEL).Return(false)
+	for _, u := range []*model.User{me, alice} {
+		api.On("GetUser", u.Id).Return(u, nil)
+	}
+
+	root := newTestPost(town.Id, alice.Id, "shall we move the release to next week because of the holidays?", 5)
+	news := newTestPost(town.Id, alice.Id, "lunch is here", 20)
+	var replies []*model.Post
+	for i := 0; i < 3; i++ {
+		reply := newTestPost(town.Id, alice.Id, "fine by me", int64(21+i))
+		reply.RootId = root.Id
+		replies = append(replies, reply)
+	}
+	unread := newPostList(append([]*model.Post{news}, replies...)...)
+	api.On("GetPostsSince", town.Id, int64(10)).Return(func(string, int64) *model.PostList { return unread }, nil)
+	for _, post := range append([]*model.Post{root, news}, replies...) {
+		api.On("GetPost", post.Id).Return(post, nil)
+	}
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	read := func(channel string) (*conversation, *OutgoingResponse, error) {
+		c := &conversation{UserID: me.Id}
+		response, err := p.handleReadChannel(&IntentContext{Request: newIntentRequest("read_channel", map[string]interface{}{"channel": channel}), UserID: me.Id, Conversation: c})
+		return c, response, err
+	}
+
+	c, response, err := read("town square")
+	require.NoError(t, err)
+	assert.Equal(t, "Here is what's new in Town Square:", *response.Prompt.FirstSimple.Speech)
+	assert.Equal(t, `In Town Square:
+Alice Smith wrote 'lunch is here'.
+3 replies in the thread about 'shall we move the release to next week…'.
+These messages stay unread, as marking messages as read is not set up on this server.
+That's all your unread messages.`, displayText(t, response))
+	assert.Equal(t, replies[2].Id, c.LastPostID)
+	assert.True(t, c.MarkReadNoticeSent)
+
+	t.Run("nothing new", func(t *testing.T) {
+		unread = newPostList()
+		api.On("GetPostsForChannel", town.Id, 0, defaultMaxPostsPerChannel).Return(newPostList(root, news), nil)
+
+		c, response, err := read("town square")
+		require.NoError(t, err)
+		assert.Equal(t, "Nothing new in Town Square, here are the latest messages:", *response.Prompt.FirstSimple.Speech)
+		assert.Contains(t, displayText(t, response), "Alice Smith wrote 'shall we move")
+		assert.Equal(t, 2, c.Reading.Marked)
+	})
+
+	t.Run("no permission", func(t *testing.T) {
+		_, _, err := read("random")
+		require.IsType(t, &intentError{}, err)
+		assert.Equal(t, "Sorry, can't find that channel!", translateError(err.(*intentError)))
+	})
+}
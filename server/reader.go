@@ -0,0 +1,558 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mattermost/go-i18n/i18n/bundle"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMaxPostsPerChannel = 5
+	defaultMaxPostsTotal      = 20
+	defaultPostsPerTurn       = 3
+
+	channelMembersPerPage = 100
+)
+
+// unreadChannel holds the unread posts of a channel, oldest first.
+type unreadChannel struct {
+	Channel  *model.Channel
+	Name     string
+	Mentions int64
+	Posts    []*model.Post
+
+	// Skipped counts the older unread posts left out to respect the per-channel cap.
+	Skipped int
+}
+
+// userCache memoizes user lookups while building a response, and names users in the locale
+// of T.
+type userCache struct {
+	api   plugin.API
+	T     bundle.TranslateFunc
+	users map[string]*model.User
+
+	// usernames maps usernames to user IDs, empty for unknown usernames.
+	usernames map[string]string
+}
+
+func newUserCache(p *Plugin, T bundle.TranslateFunc) *userCache {
+	return &userCache{api: p.API, T: T, users: make(map[string]*model.User), usernames: make(map[string]string)}
+}
+
+// mentionName returns how an @mention of the username is spoken: the full name of the user, or
+// who a channel wide mention notifies. Unknown usernames are spoken as is.
+func (c *userCache) mentionName(username string) string {
+	if id, ok := specialMentions[strings.ToLower(username)]; ok {
+		return c.T(id)
+	}
+
+	// Mentions may be followed by punctuation, which usernames may contain too.
+	for name := username; name != ""; name = name[:len(name)-1] {
+		userID, ok := c.usernames[name]
+		if !ok {
+			if u, appErr := c.api.GetUserByUsername(strings.ToLower(name)); appErr == nil {
+				c.users[u.Id] = u
+				userID = u.Id
+			}
+			c.usernames[name] = userID
+		}
+		if userID != "" {
+			return c.displayName(userID) + username[len(name):]
+		}
+		if last := name[len(name)-1]; last != '.' && last != '-' && last != '_' {
+			break
+		}
+	}
+	return username
+}
+
+// displayName returns the full name of the user, falling back to the username.
+func (c *userCache) displayName(userID string) string {
+	u, ok := c.users[userID]
+	if !ok {
+		var appErr *model.AppError
+		if u, appErr = c.api.GetUser(userID); appErr != nil {
+			return c.T("user.someone")
+		}
+		c.users[userID] = u
+	}
+	return u.GetDisplayName(model.SHOW_FULLNAME)
+}
+
+// channelName returns how a channel is referred to when spoken.
+func (c *userCache) channelName(channel *model.Channel, userID string) string {
+	switch channel.Type {
+	case model.CHANNEL_DIRECT:
+		return c.displayName(channel.GetOtherUserIdForDM(userID))
+	case model.CHANNEL_GROUP:
+		return c.T("channel.group", vars{"Names": channel.DisplayName})
+	default:
+		return channel.DisplayName
+	}
+}
+
+// readCaps returns how many posts may be spoken per channel and overall.
+func (p *Plugin) readCaps() (int, int) {
+	conf := p.getConfiguration()
+	perChannel, total := conf.MaxPostsPerChannel, conf.MaxPostsTotal
+	if perChannel <= 0 {
+		perChannel = defaultMaxPostsPerChannel
+	}
+	if total <= 0 {
+		total = defaultMaxPostsTotal
+	}
+	return perChannel, total
+}
+
+// membership is a channel the user is a member of, with their membership of it.
+type membership struct {
+	Channel *model.Channel
+	Member  *model.ChannelMember
+}
+
+// getMemberships returns the channels the user is a member of across all teams, including
+// direct and group messages, each channel once. The channels are fetched a team at a time, and
+// deleted ones are left out.
+func (p *Plugin) getMemberships(userID string) ([]membership, error) {
+	teams, appErr := p.API.GetTeamsForUser(userID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get teams")
+	}
+
+	seen := make(map[string]bool)
+	var memberships []membership
+	for _, team := range teams {
+		list, appErr := p.API.GetChannelsForTeamForUser(team.Id, userID, false)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to get channels")
+		}
+		channels := make(map[string]*model.Channel, len(list))
+		for _, channel := range list {
+			channels[channel.Id] = channel
+		}
+
+		for page := 0; ; page++ {
+			cms, appErr := p.API.GetChannelMembersForUser(team.Id, userID, page, channelMembersPerPage)
+			if appErr != nil {
+				return nil, errors.Wrap(appErr, "failed to get members")
+			}
+			for _, cm := range cms {
+				channel, ok := channels[cm.ChannelId]
+				if ok && !seen[cm.ChannelId] {
+					seen[cm.ChannelId] = true
+					memberships = append(memberships, membership{Channel: channel, Member: cm})
+				}
+			}
+			if len(cms) < channelMembersPerPage {
+				break
+			}
+		}
+	}
+
+	return memberships, nil
+}
+
+// getUnreadChannels collects the posts the user has not seen yet in every channel, ordered so
+// that channels mentioning the user come first, then by most recent activity.
+func (p *Plugin) getUnreadChannels(userID string, users *userCache) ([]*unreadChannel, error) {
+	memberships, err := p.getMemberships(userID)
+	if err != nil {
+		return nil, err
+	}
+	perChannel, _ := p.readCaps()
+
+	var unreads []*unreadChannel
+	for _, m := range memberships {
+		channel, cm := m.Channel, m.Member
+		if channel.TotalMsgCount <= cm.MsgCount && cm.MentionCount == 0 {
+			continue
+		}
+
+		pl, appErr := p.API.GetPostsSince(channel.Id, cm.LastViewedAt)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to get posts")
+		}
+		posts := unreadPosts(pl, userID, cm.LastViewedAt)
+		if len(posts) == 0 {
+			continue
+		}
+
+		unread := &unreadChannel{
+			Channel:  channel,
+			Name:     users.channelName(channel, userID),
+			Mentions: cm.MentionCount,
+			Posts:    posts,
+		}
+		if len(posts) > perChannel {
+			unread.Skipped = len(posts) - perChannel
+			unread.Posts = posts[unread.Skipped:]
+		}
+		unreads = append(unreads, unread)
+	}
+
+	sort.SliceStable(unreads, func(i, j int) bool {
+		if (unreads[i].Mentions > 0) != (unreads[j].Mentions > 0) {
+			return unreads[i].Mentions > 0
+		}
+		return unreads[i].Channel.LastPostAt > unreads[j].Channel.LastPostAt
+	})
+
+	return unreads, nil
+}
+
+// unreadPosts returns the posts of the list created after since by someone other than the
+// user, oldest first. System messages and deleted posts are left out.
+func unreadPosts(pl *model.PostList, userID string, since int64) []*model.Post {
+	var posts []*model.Post
+	for _, post := range pl.Posts {
+		if post.CreateAt <= since || post.DeleteAt != 0 || post.UserId == userID || post.IsSystemMessage() {
+			continue
+		}
+		posts = append(posts, post)
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreateAt < posts[j].CreateAt
+	})
+	return posts
+}
+
+// readingState is the cursor of a multi-turn reading of unread posts.
+type readingState struct {
+	Channels []readingChannel `json:"channels"`
+	Items    []readingItem    `json:"items"`
+
+	// Pos and End delimit the page that was read last.
+	Pos int `json:"pos"`
+	End int `json:"end"`
+
+	// History holds the start of every page read before the current one.
+	History []int `json:"history,omitempty"`
+
+	// Remaining counts the unread posts left out to respect the overall cap.
+	Remaining int `json:"remaining,omitempty"`
+
+	// Marked is the position up to which posts were marked as read.
+	Marked int `json:"marked,omitempty"`
+
+	// Mentions is set when reading the posts mentioning the user, which are trimmed and left
+	// unread since the rest of their channel was not read.
+	Mentions bool `json:"mentions,omitempty"`
+
+	// Thread is the root post of the thread whose replies are read, which are marked read in
+	// the thread rather than in their channel.
+	Thread string `json:"thread,omitempty"`
+
+	// Saved is set when reading the posts the user saved, which are not marked read.
+	Saved bool `json:"saved,omitempty"`
+}
+
+type readingChannel struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Direct  bool   `json:"direct,omitempty"`
+	Skipped int    `json:"skipped,omitempty"`
+}
+
+type readingItem struct {
+	Channel int    `json:"channel"`
+	PostID  string `json:"post_id"`
+
+	// Replies counts the replies to the thread of RootID read as this item, PostID being the
+	// latest of them.
+	RootID  string `json:"root_id,omitempty"`
+	Replies int    `json:"replies,omitempty"`
+}
+
+// newReadingState queues the unread posts for reading, up to total posts.
+func newReadingState(unreads []*unreadChannel, total int) *readingState {
+	state := &readingState{}
+	for _, unread := range unreads {
+		if len(state.Items) >= total {
+			state.Remaining += unread.Skipped + len(unread.Posts)
+			continue
+		}
+
+		state.Channels = append(state.Channels, readingChannel{
+			ID:      unread.Channel.Id,
+			Name:    unread.Name,
+			Direct:  unread.Channel.Type == model.CHANNEL_DIRECT,
+			Skipped: unread.Skipped,
+		})
+		for i, post := range unread.Posts {
+			if len(state.Items) >= total {
+				state.Remaining += len(unread.Posts) - i
+				break
+			}
+			state.Items = append(state.Items, readingItem{Channel: len(state.Channels) - 1, PostID: post.Id})
+		}
+	}
+	return state
+}
+
+// postsPerTurn returns how many posts are read per conversational turn.
+func (p *Plugin) postsPerTurn() int {
+	if n := p.getConfiguration().PostsPerTurn; n > 0 {
+		return n
+	}
+	return defaultPostsPerTurn
+}
+
+func describeChannel(T bundle.TranslateFunc, channel readingChannel) string {
+	if channel.Direct {
+		return T("reading.from", vars{"Channel": channel.Name})
+	}
+	return T("reading.in", vars{"Channel": channel.Name})
+}
+
+func describePost(post *model.Post, users *userCache) string {
+	message := plainMessage(post.Message, users)
+	if message == "" && len(post.FileIds) > 0 {
+		return users.T("reading.shared_file", vars{"User": users.displayName(post.UserId)})
+	}
+	return users.T("reading.wrote", vars{"User": users.displayName(post.UserId), "Message": message})
+}
+
+// readPage speaks the page of the reading starting at pos, and moves the cursor to it.
+func (p *Plugin) readPage(ctx *IntentContext, pos int) (*OutgoingResponse, error) {
+	state := ctx.Conversation.Reading
+	users := newUserCache(p, ctx.T)
+
+	end := pos + p.postsPerTurn()
+	if end > len(state.Items) {
+		end = len(state.Items)
+	}
+
+	var messages []string
+	posts := make(map[int]*model.Post)
+	for i := pos; i < end; i++ {
+		item := state.Items[i]
+		channel := state.Channels[item.Channel]
+		firstOfChannel := i == 0 || state.Items[i-1].Channel != item.Channel
+		if i == pos || firstOfChannel {
+			messages = append(messages, describeChannel(ctx.T, channel))
+		}
+		if firstOfChannel && channel.Skipped > 0 {
+			messages = append(messages, ctx.T("reading.skipped", channel.Skipped))
+		}
+
+		post, appErr := p.API.GetPost(item.PostID)
+		if appErr != nil {
+			messages = append(messages, ctx.T("reading.deleted"))
+			continue
+		}
+		posts[i] = post
+		ctx.Conversation.LastPostID = post.Id
+		switch {
+		case item.Replies > 0:
+			messages = append(messages, p.describeThread(item, users))
+		case state.Mentions:
+			messages = append(messages, describeMention(post, users))
+		default:
+			messages = append(messages, describePost(post, users))
+		}
+	}
+
+	state.Pos, state.End = pos, end
+	switch {
+	case state.Thread != "":
+		p.markThreadSpoken(ctx, posts, pos, end)
+	case !state.Mentions && !state.Saved:
+		// Users are told once per session that marking as read is not set up.
+		if p.markSpoken(ctx, posts, pos, end) && !ctx.Conversation.MarkReadNoticeSent {
+			ctx.Conversation.MarkReadNoticeSent = true
+			messages = append(messages, ctx.T("reading.not_marked"))
+		}
+	}
+	if end >= len(state.Items) {
+		switch {
+		case state.Mentions && state.Remaining > 0:
+			messages = append(messages, ctx.T("mentions.remaining", state.Remaining))
+		case state.Mentions:
+			messages = append(messages, ctx.T("mentions.all_read"))
+		case state.Thread != "":
+			messages = append(messages, ctx.T("thread.all_read"))
+		case state.Saved && state.Remaining > 0:
+			messages = append(messages, ctx.T("saved.remaining", state.Remaining))
+		case state.Saved:
+			messages = append(messages, ctx.T("saved.all_read"))
+		case state.Remaining > 0:
+			messages = append(messages, ctx.T("reading.remaining", state.Remaining))
+		default:
+			messages = append(messages, ctx.T("reading.all_read"))
+		}
+	} else {
+		messages = append(messages, ctx.T("reading.say_next"))
+	}
+
+	response := newPrompt().SayPaused(messages...).Response()
+	setReadingPrompts(ctx, response, state)
+	return response, nil
+}
+
+// setReadingPrompts tunes speech recognition and suggestions to the reading commands that make
+// sense at the current position.
+func setReadingPrompts(ctx *IntentContext, response *OutgoingResponse, state *readingState) {
+	var expected []string
+	var suggestions []gSuggestions
+	if state.End < len(state.Items) {
+		expected = append(expected, ctx.T("reading.expect_next"), ctx.T("reading.expect_skip"))
+		suggestions = append(suggestions, gSuggestions{Title: ctx.T("reading.suggest_next")}, gSuggestions{Title: ctx.T("reading.suggest_skip")})
+	}
+	if state.Pos > 0 {
+		expected = append(expected, ctx.T("reading.expect_previous"))
+		suggestions = append(suggestions, gSuggestions{Title: ctx.T("reading.suggest_previous")})
+	}
+	expected = append(expected, ctx.T("reading.expect_repeat"), ctx.T("reading.expect_stop"))
+	suggestions = append(suggestions, gSuggestions{Title: ctx.T("reading.suggest_repeat")}, gSuggestions{Title: ctx.T("reading.suggest_stop")})
+
+	response.Expected = &gExpected{Speech: expected}
+	response.Prompt.Suggestions = &suggestions
+}
+
+func (p *Plugin) handleReadMessages(ctx *IntentContext) (*OutgoingResponse, error) {
+	users := newUserCache(p, ctx.T)
+	unreads, err := p.getUnreadChannels(ctx.UserID, users)
+	if err != nil {
+		return nil, err
+	}
+	if len(unreads) == 0 {
+		ctx.Conversation.Reading = nil
+		return getResponseWithText(ctx.T("reading.none")), nil
+	}
+
+	_, total := p.readCaps()
+	ctx.Conversation.Reading = newReadingState(unreads, total)
+	response, err := p.readPage(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	intro := ctx.T("reading.intro")
+	if ctx.HasScreen() {
+		if content := p.unreadChannelsContent(unreads, users); content != nil {
+			response.Prompt.Content = content
+			intro = ctx.T("reading.intro_screen", len(unreads))
+		}
+	}
+	response.Prompt.FirstSimple = getResponseWithText(intro).Prompt.LastSimple
+	return response, nil
+}
+
+// maxBrowseItems is the most items a collection browse may show.
+const maxBrowseItems = 10
+
+// unreadChannelsContent lays out the channels with unread posts for screens, each showing the
+// avatar of its latest sender and opening its latest post in Mattermost. It returns nil when the
+// site URL the links need is not set.
+func (p *Plugin) unreadChannelsContent(unreads []*unreadChannel, users *userCache) *gContent {
+	siteURL := p.siteURL()
+	if siteURL == "" {
+		return nil
+	}
+
+	var items []gCollectionBrowseItem
+	for _, unread := range unreads {
+		if len(items) == maxBrowseItems {
+			break
+		}
+		last := unread.Posts[len(unread.Posts)-1]
+		description := users.T("reading.channel_unread", unread.Skipped+len(unread.Posts))
+		if unread.Mentions > 0 {
+			description += ", " + users.T("reading.channel_mentions", unread.Mentions)
+		}
+		item := gCollectionBrowseItem{
+			Title:         unread.Name,
+			Description:   description,
+			Footer:        users.T("reading.latest_from", vars{"User": users.displayName(last.UserId)}),
+			OpenURIAction: &gOpenURL{URL: model.NewString(siteURL + "/_redirect/pl/" + last.Id)},
+		}
+		if avatar, err := p.avatarURL(last.UserId); err != nil {
+			p.API.LogWarn("Cannot get avatar URL", "err", err.Error())
+		} else {
+			item.Image = &gImage{URL: model.NewString(avatar), Alt: users.displayName(last.UserId)}
+		}
+		items = append(items, item)
+	}
+
+	// Collection browses need at least two items, a single channel is shown as a card.
+	if len(items) == 1 {
+		item := items[0]
+		return &gContent{Card: &gCard{
+			Title:    model.NewString(item.Title),
+			Subtitle: item.Description,
+			Text:     item.Footer,
+			Image:    item.Image,
+			Button:   &gLink{Name: model.NewString(users.T("reading.open")), Open: *item.OpenURIAction},
+		}}
+	}
+	return &gContent{CollectionBrowse: &gCollectionBrowse{Items: items}}
+}
+
+// errNotReading is answered when a reading command arrives outside of a reading.
+var errNotReading = newIntentError("reading.not_reading", nil)
+
+func (p *Plugin) handleReadNext(ctx *IntentContext) (*OutgoingResponse, error) {
+	state := ctx.Conversation.Reading
+	if state == nil {
+		return nil, errNotReading
+	}
+	if state.End >= len(state.Items) {
+		response := getResponseWithText(ctx.T("reading.no_more_messages"))
+		setReadingPrompts(ctx, response, state)
+		return response, nil
+	}
+	state.History = append(state.History, state.Pos)
+	return p.readPage(ctx, state.End)
+}
+
+func (p *Plugin) handleReadPrevious(ctx *IntentContext) (*OutgoingResponse, error) {
+	state := ctx.Conversation.Reading
+	if state == nil {
+		return nil, errNotReading
+	}
+	if len(state.History) == 0 {
+		return p.readPage(ctx, state.Pos)
+	}
+	pos := state.History[len(state.History)-1]
+	state.History = state.History[:len(state.History)-1]
+	return p.readPage(ctx, pos)
+}
+
+func (p *Plugin) handleReadRepeat(ctx *IntentContext) (*OutgoingResponse, error) {
+	state := ctx.Conversation.Reading
+	if state == nil {
+		return nil, errNotReading
+	}
+	return p.readPage(ctx, state.Pos)
+}
+
+// handleReadSkipChannel continues with the first post of the channel after the one that was
+// read last.
+func (p *Plugin) handleReadSkipChannel(ctx *IntentContext) (*OutgoingResponse, error) {
+	state := ctx.Conversation.Reading
+	if state == nil {
+		return nil, errNotReading
+	}
+
+	current := state.Items[state.End-1].Channel
+	for i := state.End; i < len(state.Items); i++ {
+		if state.Items[i].Channel != current {
+			state.History = append(state.History, state.Pos)
+			return p.readPage(ctx, i)
+		}
+	}
+
+	state.Pos, state.End = len(state.Items), len(state.Items)
+	response := getResponseWithText(ctx.T("reading.no_more_channels"))
+	setReadingPrompts(ctx, response, state)
+	return response, nil
+}
+
+func (p *Plugin) handleReadStop(ctx *IntentContext) (*OutgoingResponse, error) {
+	ctx.Conversation.Reading = nil
+	return getResponseWithText(ctx.T("reading.stopped")), nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPostList(posts ...*model.Post) *model.PostList {
+	pl := model.NewPostList()
+	for _, post := range posts {
+		pl.AddPost(post)
+		pl.AddOrder(post.Id)
+	}
+	return pl
+}
+
+func newTestPost(channelID, userID, message string, createAt int64) *model.Post {
+	return &model.Post{Id: model.NewId(), ChannelId: channelID, UserId: userID, Message: message, CreateAt: createAt}
+}
+
+func TestHandleReadMessages(t *testing.T) {
+	me := &model.User{Id: model.NewId(), Username: "me"}
+	alice := &model.User{Id: model.NewId(), Username: "alice", FirstName: "Alice", LastName: "Smith"}
+	bob := &model.User{Id: model.NewId(), Username: "bob"}
+	team := &model.Team{Id: model.NewId()}
+
+	dm := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_DIRECT, Name: model.GetDMNameFromIds(me.Id, alice.Id), TotalMsgCount: 3, LastPostAt: 100}
+	town := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, DisplayName: "Town Square", TotalMsgCount: 10, LastPostAt: 200}
+	quiet := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, DisplayName: "Quiet", TotalMsgCount: 4}
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetTeamsForUser", me.Id).Return([]*model.Team{team}, nil)
+	api.On("GetChannelMembersForUser", team.Id, me.Id, 0, channelMembersPerPage).Return([]*model.ChannelMember{
+		{ChannelId: town.Id, MsgCount: 2, LastViewedAt: 10},
+		{ChannelId: dm.Id, MsgCount: 1, MentionCount: 2, LastViewedAt: 10},
+		{ChannelId: quiet.Id, MsgCount: 4, LastViewedAt: 10},
+	}, nil)
+	api.On("GetChannelsForTeamForUser", team.Id, me.Id, false).Return([]*model.Channel{dm, town, quiet}, nil)
+	for _, u := range []*model.User{me, alice, bob} {
+		api.On("GetUser", u.Id).Return(u, nil)
+	}
+	dmPosts := []*model.Post{
+		newTestPost(dm.Id, alice.Id, "seen already", 5),
+		newTestPost(dm.Id, alice.Id, "hi", 20),
+		newTestPost(dm.Id, me.Id, "my own reply", 25),
+		newTestPost(dm.Id, alice.Id, "are you there?", 30),
+	}
+	api.On("GetPostsSince", dm.Id, int64(10)).Return(newPostList(dmPosts...), nil)
+	var townPosts []*model.Post
+	for i := 0; i < 8; i++ {
+		townPosts = append(townPosts, newTestPost(town.Id, bob.Id, fmt.Sprintf("update %d", i), int64(20+i)))
+	}
+	api.On("GetPostsSince", town.Id, int64(10)).Return(newPostList(townPosts...), nil)
+
+	for _, post := range append(dmPosts, townPosts...) {
+		api.On("GetPost", post.Id).Return(post, nil)
+	}
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{MaxPostsPerChannel: 3, MaxPostsTotal: 4, PostsPerTurn: 3})
+	ctx := &IntentContext{Request: &IncomingRequest{}, UserID: me.Id, Conversation: &conversation{UserID: me.Id}}
+
+	response, err := p.handleReadMessages(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "Here are your messages:", *response.Prompt.FirstSimple.Speech)
+	assert.Equal(t, `From Alice Smith:
+Alice Smith wrote 'hi'.
+Alice Smith wrote 'are you there?'.
+In Town Square:
+5 earlier messages skipped.
+bob wrote 'update 5'.
+These messages stay unread, as marking messages as read is not set up on this server.
+Say next to continue.`, displayText(t, response))
+	assert.True(t, strings.HasPrefix(speech(t, response), "<speak>From Alice Smith:"+sentencePause+"Alice Smith wrote &apos;hi&apos;."+sentencePause))
+	assert.Equal(t, []string{"next", "skip this channel", "repeat", "stop"}, response.Expected.Speech)
+	assert.Equal(t, townPosts[5].Id, ctx.Conversation.LastPostID)
+
+	response, err = p.handleReadNext(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, `In Town Square:
+bob wrote 'update 6'.
+You have 1 more unread message.`, displayText(t, response))
+	assert.Equal(t, []string{"previous", "repeat", "stop"}, response.Expected.Speech)
+
+	response, err = p.handleReadRepeat(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, displayText(t, response), "update 6")
+
+	response, err = p.handleReadPrevious(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, speech(t, response), "From Alice Smith:")
+
+	// The page ended in Town Square, which is the last channel.
+	response, err = p.handleReadSkipChannel(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "There are no more channels.", speech(t, response))
+
+	_, err = p.handleReadStop(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, ctx.Conversation.Reading)
+
+	_, err = p.handleReadNext(ctx)
+	assert.Equal(t, errNotReading, err)
+
+	t.Run("screen", func(t *testing.T) {
+		api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewString("https://mm.example.com/")}})
+
+		req := &IncomingRequest{Device: gDevice{Capabilities: &[]string{"SPEECH", capabilityRichResponse}}}
+		ctx := &IntentContext{Request: req, UserID: me.Id, Conversation: &conversation{UserID: me.Id}}
+		response, err := p.handleReadMessages(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "You have unread messages in 2 channels. Here they are:", *response.Prompt.FirstSimple.Speech)
+		assert.Contains(t, displayText(t, response), "Alice Smith wrote 'hi'.")
+
+		require.NotNil(t, response.Prompt.Content)
+		require.NotNil(t, response.Prompt.Content.CollectionBrowse)
+		items := response.Prompt.Content.CollectionBrowse.Items
+		require.Len(t, items, 2)
+		assert.Equal(t, "Alice Smith", items[0].Title)
+		assert.Equal(t, "2 unread messages, 2 mentions", items[0].Description)
+		assert.Equal(t, "Latest from Alice Smith", items[0].Footer)
+		assert.Equal(t, "https://mm.example.com/_redirect/pl/"+dmPosts[3].Id, *items[0].OpenURIAction.URL)
+		assert.Contains(t, *items[0].Image.URL, "https://mm.example.com/plugins/"+manifest.Id+avatarsPath+alice.Id+"?sig=")
+		assert.Equal(t, "Town Square", items[1].Title)
+		assert.Equal(t, "8 unread messages", items[1].Description)
+	})
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const reminderTask = "reminder"
+
+// reminder is the data of a reminder task, posted to the user by the bot when it is due.
+type reminder struct {
+	Text string `json:"text"`
+}
+
+// reminderIndexKey is the key of the index of the reminder tasks of the user.
+func reminderIndexKey(userID string) string {
+	return "rem_" + userID
+}
+
+// cleanReminderText drops the "to" of "remind me to ..." and the punctuation around the text.
+func cleanReminderText(text string) string {
+	text = strings.Trim(strings.TrimSpace(text), ".!?,;: ")
+	if lower := strings.ToLower(text); strings.HasPrefix(lower, "to ") {
+		text = strings.TrimSpace(text[3:])
+	}
+	return text
+}
+
+// splitReminder splits a reminder such as "review the release notes at 3pm" into what to be
+// reminded of and when, the longest ending of the text that is a time being the when.
+func splitReminder(text string, now time.Time) (string, time.Time, bool) {
+	words := strings.Fields(text)
+	for i := 1; i < len(words); i++ {
+		if at, ok := parseTime(strings.Join(words[i:], " "), now); ok {
+			return strings.Join(words[:i], " "), at, true
+		}
+	}
+	return "", time.Time{}, false
+}
+
+// reminderParams returns what to remind the user of and when, from the "text" parameter and
+// the "when" parameter or, failing that, the end of the text.
+func (p *Plugin) reminderParams(ctx *IntentContext, now time.Time) (string, time.Time, error) {
+	text := ctx.Param("text")
+	var at time.Time
+	if ctx.HasParam("when") {
+		var ok bool
+		if at, ok = parseTime(ctx.Param("when"), now); !ok {
+			return "", time.Time{}, newIntentError("time.not_understood", nil, vars{"Time": ctx.Param("when")})
+		}
+	} else {
+		var ok bool
+		if text, at, ok = splitReminder(text, now); !ok {
+			return "", time.Time{}, newIntentError("reminder.no_time", nil)
+		}
+	}
+	if text = cleanReminderText(text); text == "" {
+		return "", time.Time{}, newIntentError("reminder.no_text", nil)
+	}
+	return text, at, nil
+}
+
+// handleSetReminder schedules a reminder the bot posts to the user in Mattermost.
+func (p *Plugin) handleSetReminder(ctx *IntentContext) (*OutgoingResponse, error) {
+	now := time.Now().In(p.userLocation(ctx.UserID))
+	text, at, err := p.reminderParams(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	texts := vars{"Text": text, "When": describeTime(ctx.T, at, now)}
+	if question := ctx.confirm(ctx.T("reminder.confirm", texts)); question != nil {
+		return question, nil
+	}
+	if err := p.scheduleIndexed(reminderIndexKey(ctx.UserID), model.NewId(), reminderTask, ctx.UserID, at, reminder{Text: text}); err != nil {
+		return nil, err
+	}
+	return getResponseWithText(ctx.T("reminder.set", texts)), nil
+}
+
+// getReminders returns the reminders of the user along with their tasks, the soonest first.
+func (p *Plugin) getReminders(userID string) ([]*scheduledTask, []reminder, error) {
+	tasks, err := p.indexedTasks(reminderIndexKey(userID))
+	if err != nil {
+		return nil, nil, err
+	}
+	reminders := make([]reminder, len(tasks))
+	for i, task := range tasks {
+		if err := json.Unmarshal(task.Data, &reminders[i]); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to decode reminder")
+		}
+	}
+	return tasks, reminders, nil
+}
+
+// handleListReminders tells the user what they will be reminded of, and when.
+func (p *Plugin) handleListReminders(ctx *IntentContext) (*OutgoingResponse, error) {
+	tasks, reminders, err := p.getReminders(ctx.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return getResponseWithText(ctx.T("reminder.none")), nil
+	}
+
+	now := time.Now().In(p.userLocation(ctx.UserID))
+	items := make([]string, len(tasks))
+	for i, task := range tasks {
+		items[i] = ctx.T("reminder.item", vars{"Text": reminders[i].Text, "When": describeTime(ctx.T, task.due(), now)})
+	}
+	return getResponseWithText(ctx.T("reminder.list", len(items), vars{"Reminders": spokenList(ctx.T, "list.and", items)})), nil
+}
+
+// handleCancelReminder cancels the reminder the user named, asking which one was meant when
+// several sound alike.
+func (p *Plugin) handleCancelReminder(ctx *IntentContext) (*OutgoingResponse, error) {
+	tasks, reminders, err := p.getReminders(ctx.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	id, chosen := ctx.Choice("reminder")
+	if !chosen {
+		candidates := make([]match, len(tasks))
+		for i, task := range tasks {
+			candidates[i] = match{ID: task.ID, Name: reminders[i].Text, Score: matchScore(cleanReminderText(ctx.Param("reminder")), reminders[i].Text)}
+		}
+		matches, confident := rankMatches(candidates)
+		if len(matches) == 0 {
+			return nil, newIntentError("reminder.not_found", nil)
+		}
+		if !confident {
+			return ctx.askChoice("cancel_reminder", "reminder", matches), nil
+		}
+		id = matches[0].ID
+	}
+
+	var text string
+	for i, task := range tasks {
+		if task.ID == id {
+			text = reminders[i].Text
+		}
+	}
+	if text == "" {
+		return nil, newIntentError("reminder.not_found", nil)
+	}
+	if question := ctx.confirm(ctx.T("reminder.confirm_cancel", vars{"Text": text})); question != nil {
+		return question, nil
+	}
+	if err := p.unschedule(id); err != nil {
+		return nil, err
+	}
+	return getResponseWithText(ctx.T("reminder.cancelled", vars{"Text": text})), nil
+}
+
+// deliverReminder posts a due reminder to the user's direct channel with the bot, in the
+// user's Mattermost language.
+func (p *Plugin) deliverReminder(task *scheduledTask) error {
+	var r reminder
+	if err := json.Unmarshal(task.Data, &r); err != nil {
+		return errors.Wrap(err, "failed to decode reminder")
+	}
+	u, appErr := p.API.GetUser(task.UserID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get user")
+	}
+	channel, appErr := p.API.GetDirectChannel(task.UserID, p.botUserID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get direct channel")
+	}
+	if _, appErr := p.API.CreatePost(&model.Post{
+		ChannelId: channel.Id,
+		UserId:    p.botUserID,
+		Message:   translator(u.Locale)("reminder.message", vars{"Text": r.Text}),
+	}); appErr != nil {
+		return errors.Wrap(appErr, "failed to create post")
+	}
+	return nil
+}
+
+// describeReminders lists the reminders of /assistant reminders.
+func describeReminders(tasks []*scheduledTask, reminders []reminder, loc *time.Location) string {
+	if len(tasks) == 0 {
+		return "You have no reminders. Add one with `/assistant reminders add <what> <when>`."
+	}
+	lines := []string{"Your reminders:"}
+	for i, task := range tasks {
+		lines = append(lines, fmt.Sprintf("%d. %s, %s", i+1, reminders[i].Text, task.due().In(loc).Format("Mon Jan 2 at 3:04 PM")))
+	}
+	lines = append(lines, "Cancel one with `/assistant reminders cancel <number>`.")
+	return strings.Join(lines, "\n")
+}
+
+// executeRemindersCommand lists the user's reminders, adds one with
+// `/assistant reminders add <what> <when>` or cancels one with
+// `/assistant reminders cancel <number>`.
+func (p *Plugin) executeRemindersCommand(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	respond := func(text string) (*model.CommandResponse, *model.AppError) {
+		return &model.CommandResponse{ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL, Text: text}, nil
+	}
+	loc := p.userLocation(userID)
+	tasks, reminders, err := p.getReminders(userID)
+	if err != nil {
+		p.API.LogError("Cannot get reminders", "err", err.Error())
+		return respond("Failed to get your reminders, please try again.")
+	}
+
+	if len(args) == 0 {
+		return respond(describeReminders(tasks, reminders, loc))
+	}
+	switch args[0] {
+	case "add":
+		text, at, ok := splitReminder(strings.Join(args[1:], " "), time.Now().In(loc))
+		if text = cleanReminderText(text); !ok || text == "" {
+			return respond("Sorry, I didn't understand when to remind you. Try `/assistant reminders add review the release notes at 3pm`.")
+		}
+		if err := p.scheduleIndexed(reminderIndexKey(userID), model.NewId(), reminderTask, userID, at, reminder{Text: text}); err != nil {
+			p.API.LogError("Cannot add reminder", "err", err.Error())
+			return respond("Failed to add the reminder, please try again.")
+		}
+		return respond(fmt.Sprintf("I'll remind you to %s on %s.", text, at.Format("Mon Jan 2 at 3:04 PM")))
+	case "cancel":
+		var n int
+		if len(args) != 2 {
+			return respond("Usage: `/assistant reminders cancel <number>`")
+		}
+		if _, err := fmt.Sscanf(args[1], "%d", &n); err != nil || n < 1 || n > len(tasks) {
+			return respond(fmt.Sprintf("Sorry, there is no reminder %s.", args[1]))
+		}
+		if err := p.unschedule(tasks[n-1].ID); err != nil {
+			p.API.LogError("Cannot cancel reminder", "err", err.Error())
+			return respond("Failed to cancel the reminder, please try again.")
+		}
+		return respond(fmt.Sprintf("Cancelled the reminder to %s.", reminders[n-1].Text))
+	default:
+		return respond("Usage: `/assistant reminders [add <what> <when>|cancel <number>]`")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitReminder(t *testing.T) {
+	now := time.Date(2020, time.June, 10, 14, 20, 0, 0, time.UTC)
+	for text, expected := range map[string]struct {
+		text string
+		at   time.Time
+	}{
+		"review the release notes at 3pm": {"review the release notes", time.Date(2020, time.June, 10, 15, 0, 0, 0, time.UTC)},
+		"call the team in 10 minutes":     {"call the team", now.Add(10 * time.Minute)},
+		"water the plants tomorrow":       {"water the plants", time.Date(2020, time.June, 11, 9, 0, 0, 0, time.UTC)},
+	} {
+		what, at, ok := splitReminder(text, now)
+		require.True(t, ok, text)
+		assert.Equal(t, expected.text, what, text)
+		assert.Equal(t, expected.at, at, text)
+	}
+
+	_, _, ok := splitReminder("review the release notes", now)
+	assert.False(t, ok)
+}
+
+func TestReminders(t *testing.T) {
+	u := &model.User{Id: model.NewId(), Locale: "de", Timezone: model.StringMap{"useAutomaticTimezone": "false", "manualTimezone": "UTC"}}
+	botUserID := model.NewId()
+	dm := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_DIRECT}
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetUser", u.Id).Return(u, nil)
+	api.On("GetDirectChannel", u.Id, botUserID).Return(dm, nil)
+	var posted []*model.Post
+	api.On("CreatePost", mock.Anything).Return(func(post *model.Post) *model.Post {
+		posted = append(posted, post)
+		return post
+	}, nil)
+
+	p := &Plugin{botUserID: botUserID}
+	p.SetAPI(api)
+	p.registerTasks()
+	dispatch := func(handle intentFunc, name string, params map[string]interface{}, c *conversation) string {
+		response, err := handle(&IntentContext{Request: newIntentRequest(name, params), UserID: u.Id, Conversation: c})
+		if iErr, ok := err.(*intentError); ok {
+			return translateError(iErr)
+		}
+		require.NoError(t, err)
+		return speech(t, response)
+	}
+	c := &conversation{UserID: u.Id}
+
+	assert.Equal(t, "You have no reminders.", dispatch(p.handleListReminders, "list_reminders", nil, c))
+	assert.Equal(t, "Sorry, I didn't catch when to remind you.", dispatch(p.handleSetReminder, "set_reminder", map[string]interface{}{"text": "to review the notes"}, c))
+
+	assert.Regexp(t, `^OK, I'll remind you to review the release notes (today|tomorrow) at `,
+		dispatch(p.handleSetReminder, "set_reminder", map[string]interface{}{"text": "to review the release notes", "when": "in 2 hours"}, c))
+	dispatch(p.handleSetReminder, "set_reminder", map[string]interface{}{"text": "call the release team in 3 hours"}, c)
+	dispatch(p.handleSetReminder, "set_reminder", map[string]interface{}{"text": "water the plants in 4 hours"}, c)
+	assert.Regexp(t, `^You have 3 reminders: to review the release notes .*, to call the release team .* and to water the plants .*\.$`,
+		dispatch(p.handleListReminders, "list_reminders", nil, c))
+
+	t.Run("cancel", func(t *testing.T) {
+		assert.Equal(t, "Cancelled the reminder to water the plants.", dispatch(p.handleCancelReminder, "cancel_reminder", map[string]interface{}{"reminder": "water plants"}, c))
+		assert.Equal(t, "Sorry, I can't find that reminder!", dispatch(p.handleCancelReminder, "cancel_reminder", map[string]interface{}{"reminder": "buy milk"}, c))
+	})
+
+	t.Run("slash command", func(t *testing.T) {
+		response, _ := p.executeRemindersCommand(u.Id, nil)
+		assert.Contains(t, response.Text, "1. review the release notes, ")
+		assert.Contains(t, response.Text, "2. call the release team, ")
+
+		response, _ = p.executeRemindersCommand(u.Id, []string{"cancel", "2"})
+		assert.Equal(t, "Cancelled the reminder to call the release team.", response.Text)
+		response, _ = p.executeRemindersCommand(u.Id, []string{"cancel", "2"})
+		assert.Equal(t, "Sorry, there is no reminder 2.", response.Text)
+
+		response, _ = p.executeRemindersCommand(u.Id, []string{"add", "book", "flights", "in", "5", "hours"})
+		assert.Contains(t, response.Text, "I'll remind you to book flights on ")
+	})
+
+	t.Run("delivery", func(t *testing.T) {
+		p.runDueTasks(time.Now().Add(2*time.Hour + time.Minute))
+		require.Len(t, posted, 1)
+		assert.Equal(t, dm.Id, posted[0].ChannelId)
+		assert.Equal(t, botUserID, posted[0].UserId)
+		assert.Equal(t, ":alarm_clock: Erinnerung: review the release notes", posted[0].Message)
+
+		tasks, _, err := p.getReminders(u.Id)
+		require.NoError(t, err)
+		assert.Len(t, tasks, 1)
+		// The reminders cancelled or delivered are dropped from the index.
+		var ids []string
+		_, err = p.kvGetJSON(reminderIndexKey(u.Id), &ids)
+		require.NoError(t, err)
+		assert.Equal(t, []string{tasks[0].ID}, ids)
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// handleReply posts a reply to the post read out last, in its thread if it was itself a reply,
+// once the user confirmed the dictated text.
+func (p *Plugin) handleReply(ctx *IntentContext) (*OutgoingResponse, error) {
+	c := ctx.Conversation
+	if c.LastPostID == "" {
+		return nil, newIntentError("reply.nothing_read", nil)
+	}
+	post, appErr := p.API.GetPost(c.LastPostID)
+	if appErr != nil || post.DeleteAt != 0 {
+		return nil, newIntentError("reply.deleted", nil)
+	}
+	if !p.API.HasPermissionToChannel(ctx.UserID, post.ChannelId, model.PERMISSION_CREATE_POST) {
+		return nil, newIntentError("reply.no_permission", nil)
+	}
+
+	message := ctx.Param("message")
+	to := newUserCache(p, ctx.T).displayName(post.UserId)
+	if post.RootId != "" {
+		to = ctx.T("reply.thread", vars{"User": to})
+	}
+	if question := ctx.confirm(ctx.T("reply.confirm", vars{"Message": message, "To": to})); question != nil {
+		return question, nil
+	}
+
+	if err := p.createUserPost(ctx.UserID, post.ChannelId, post.RootId, message); err != nil {
+		return nil, err
+	}
+	return getResponseWithText(ctx.T("reply.sent")), nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleReply(t *testing.T) {
+	me := &model.User{Id: model.NewId(), Username: "me"}
+	alice := &model.User{Id: model.NewId(), Username: "alice", FirstName: "Alice"}
+	channelID, rootID := model.NewId(), model.NewId()
+	topLevel := newTestPost(channelID, alice.Id, "lunch?", 10)
+	inThread := newTestPost(channelID, alice.Id, "sounds good", 20)
+	inThread.RootId = rootID
+	readonly := newTestPost(model.NewId(), alice.Id, "announcement", 30)
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetUser", alice.Id).Return(alice, nil)
+	for _, post := range []*model.Post{topLevel, inThread, readonly} {
+		api.On("GetPost", post.Id).Return(post, nil)
+	}
+	api.On("HasPermissionToChannel", me.Id, channelID, model.PERMISSION_CREATE_POST).Return(true)
+	api.On("HasPermissionToChannel", me.Id, readonly.ChannelId, model.PERMISSION_CREATE_POST).Return(false)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	require.NoError(t, p.registerIntents())
+
+	reply := func(c *conversation, message string) (*OutgoingResponse, error) {
+		return p.handleReply(&IntentContext{
+			Request:           newIntentRequest("reply", map[string]interface{}{"message": message}),
+			UserID:            me.Id,
+			Conversation:      c,
+			intentName:        "reply",
+			needsConfirmation: true,
+		})
+	}
+	answer := func(c *conversation, handle intentFunc) (*OutgoingResponse, error) {
+		return handle(&IntentContext{Request: newIntentRequest("", nil), UserID: me.Id, Conversation: c})
+	}
+
+	t.Run("nothing was read", func(t *testing.T) {
+		_, err := reply(&conversation{UserID: me.Id}, "hello")
+		require.IsType(t, &intentError{}, err)
+	})
+
+	t.Run("channel the user can't post in", func(t *testing.T) {
+		_, err := reply(&conversation{UserID: me.Id, LastPostID: readonly.Id}, "hello")
+		require.IsType(t, &intentError{}, err)
+	})
+
+	t.Run("top level post", func(t *testing.T) {
+		c := &conversation{UserID: me.Id, LastPostID: topLevel.Id}
+		response, err := reply(c, "sure")
+		require.NoError(t, err)
+		assert.Equal(t, "I'll reply 'sure' to Alice, shall I?", speech(t, response))
+		require.NotNil(t, c.PendingAction)
+		assert.Equal(t, "reply", c.PendingAction.Intent)
+		assert.Equal(t, map[string]string{"message": "sure"}, c.PendingAction.Params)
+
+		response, err = answer(c, p.handleCancel)
+		require.NoError(t, err)
+		assert.Equal(t, "OK, I won't do it.", speech(t, response))
+		assert.Nil(t, c.PendingAction)
+
+		_, err = answer(c, p.handleConfirm)
+		assert.Equal(t, errNoPendingAction, err)
+	})
+
+	t.Run("reply in thread", func(t *testing.T) {
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.ChannelId == channelID && post.RootId == rootID && post.UserId == me.Id && post.Message == "on my way"
+		})).Return(&model.Post{}, nil).Once()
+
+		c := &conversation{UserID: me.Id, LastPostID: inThread.Id}
+		response, err := reply(c, "on my way")
+		require.NoError(t, err)
+		assert.Equal(t, "I'll reply 'on my way' to the thread with Alice, shall I?", speech(t, response))
+
+		response, err = answer(c, p.handleConfirm)
+		require.NoError(t, err)
+		assert.Equal(t, "Reply sent!", speech(t, response))
+		assert.Nil(t, c.PendingAction)
+	})
+
+	api.AssertExpectations(t)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// Saved posts are the user's preferences of the flagged_post category, named by post ID, which
+// the webapp lists as Saved Messages. The plugin API offers preferences from 5.26 only, so
+// older servers are reached through the REST API.
+
+// versionAtLeast reports whether the server version, such as "5.26.2", is at least major.minor.
+func versionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	gotMajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	gotMinor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	return gotMajor > major || (gotMajor == major && gotMinor >= minor)
+}
+
+// hasPreferencesAPI reports whether the plugin API offers user preferences.
+func (p *Plugin) hasPreferencesAPI() bool {
+	return versionAtLeast(p.API.GetServerVersion(), 5, 26)
+}
+
+// getSavedPostIDs returns the IDs of the posts the user saved.
+func (p *Plugin) getSavedPostIDs(userID string) ([]string, error) {
+	var prefs []model.Preference
+	if p.hasPreferencesAPI() {
+		var appErr *model.AppError
+		if prefs, appErr = p.API.GetPreferencesForUser(userID); appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to get preferences")
+		}
+	} else {
+		client, err := p.newRESTClient()
+		if err != nil {
+			return nil, err
+		}
+		var resp *model.Response
+		prefs, resp = client.GetPreferencesByCategory(userID, model.PREFERENCE_CATEGORY_FLAGGED_POST)
+		// Users who never saved a post have no such category.
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		if err := responseError(resp, "failed to get preferences"); err != nil {
+			return nil, err
+		}
+	}
+
+	var ids []string
+	for _, pref := range prefs {
+		if pref.Category == model.PREFERENCE_CATEGORY_FLAGGED_POST && pref.Value == "true" {
+			ids = append(ids, pref.Name)
+		}
+	}
+	return ids, nil
+}
+
+// savePost saves the post for the user, as the webapp's Save does.
+func (p *Plugin) savePost(userID, postID string) error {
+	prefs := []model.Preference{{UserId: userID, Category: model.PREFERENCE_CATEGORY_FLAGGED_POST, Name: postID, Value: "true"}}
+	if p.hasPreferencesAPI() {
+		if appErr := p.API.UpdatePreferencesForUser(userID, prefs); appErr != nil {
+			return errors.Wrap(appErr, "failed to update preferences")
+		}
+		return nil
+	}
+	client, err := p.newRESTClient()
+	if err != nil {
+		return err
+	}
+	preferences := model.Preferences(prefs)
+	_, resp := client.UpdatePreferences(userID, &preferences)
+	return responseError(resp, "failed to update preferences")
+}
+
+// lastReadablePost returns the post read out last, checking the user can still read it.
+func (p *Plugin) lastReadablePost(ctx *IntentContext, nothingReadID string) (*model.Post, error) {
+	post, err := p.lastReadPost(ctx, nothingReadID)
+	if err != nil {
+		return nil, err
+	}
+	if !p.API.HasPermissionToChannel(ctx.UserID, post.ChannelId, model.PERMISSION_READ_CHANNEL) {
+		return nil, newIntentError("reply.deleted", nil)
+	}
+	return post, nil
+}
+
+// canSave reports whether saved posts can be reached, which takes the access token on servers
+// without the preferences of the plugin API.
+func (p *Plugin) canSave() bool {
+	return p.hasPreferencesAPI() || p.getConfiguration().AccessToken != ""
+}
+
+// handleSavePost saves the post read out last for later, listing it in the user's Saved
+// Messages.
+func (p *Plugin) handleSavePost(ctx *IntentContext) (*OutgoingResponse, error) {
+	post, err := p.lastReadablePost(ctx, "saved.nothing_read")
+	if err != nil {
+		return nil, err
+	}
+	if !p.canSave() {
+		return nil, newIntentError("saved.disabled", nil)
+	}
+	saved, err := p.getSavedPostIDs(ctx.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range saved {
+		if id == post.Id {
+			return getResponseWithText(ctx.T("saved.already")), nil
+		}
+	}
+
+	texts := vars{"User": newUserCache(p, ctx.T).displayName(post.UserId)}
+	if question := ctx.confirm(ctx.T("saved.confirm", texts)); question != nil {
+		return question, nil
+	}
+	if err := p.savePost(ctx.UserID, post.Id); err != nil {
+		return nil, err
+	}
+	return getResponseWithText(ctx.T("saved.done", texts)), nil
+}
+
+// handlePinPost pins the post read out last to its channel.
+func (p *Plugin) handlePinPost(ctx *IntentContext) (*OutgoingResponse, error) {
+	post, err := p.lastReadablePost(ctx, "pinned.nothing_read")
+	if err != nil {
+		return nil, err
+	}
+	if post.IsPinned {
+		return getResponseWithText(ctx.T("pinned.already")), nil
+	}
+
+	texts := vars{"User": newUserCache(p, ctx.T).displayName(post.UserId)}
+	if question := ctx.confirm(ctx.T("pinned.confirm", texts)); question != nil {
+		return question, nil
+	}
+	post = post.Clone()
+	post.IsPinned = true
+	if _, appErr := p.API.UpdatePost(post); appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to pin post")
+	}
+	return getResponseWithText(ctx.T("pinned.done", texts)), nil
+}
+
+// handleReadSaved reads out the posts the user saved, the most recent first. Saved posts are
+// not marked as read.
+func (p *Plugin) handleReadSaved(ctx *IntentContext) (*OutgoingResponse, error) {
+	if !p.canSave() {
+		return nil, newIntentError("saved.disabled", nil)
+	}
+	ids, err := p.getSavedPostIDs(ctx.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var posts []*model.Post
+	for _, id := range ids {
+		post, appErr := p.API.GetPost(id)
+		if appErr != nil || post.DeleteAt != 0 {
+			continue
+		}
+		// Posts stay saved after the user left their channel.
+		if !p.API.HasPermissionToChannel(ctx.UserID, post.ChannelId, model.PERMISSION_READ_CHANNEL) {
+			continue
+		}
+		posts = append(posts, post)
+	}
+	if len(posts) == 0 {
+		ctx.Conversation.Reading = nil
+		return getResponseWithText(ctx.T("saved.none")), nil
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreateAt > posts[j].CreateAt
+	})
+
+	_, total := p.readCaps()
+	users := newUserCache(p, ctx.T)
+	state := &readingState{Saved: true}
+	if len(posts) > total {
+		state.Remaining = len(posts) - total
+		posts = posts[:total]
+	}
+	for _, post := range posts {
+		if n := len(state.Channels); n == 0 || state.Channels[n-1].ID != post.ChannelId {
+			channel, appErr := p.API.GetChannel(post.ChannelId)
+			if appErr != nil {
+				return nil, errors.Wrap(appErr, "failed to get channel")
+			}
+			state.Channels = append(state.Channels, readingChannel{
+				ID:     channel.Id,
+				Name:   users.channelName(channel, ctx.UserID),
+				Direct: channel.Type == model.CHANNEL_DIRECT,
+			})
+		}
+		state.Items = append(state.Items, readingItem{Channel: len(state.Channels) - 1, PostID: post.Id})
+	}
+	ctx.Conversation.Reading = state
+
+	response, err := p.readPage(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	response.Prompt.FirstSimple = getResponseWithText(ctx.T("saved.intro", len(posts)+state.Remaining)).Prompt.LastSimple
+	return response, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionAtLeast(t *testing.T) {
+	assert.True(t, versionAtLeast("5.26.2", 5, 26))
+	assert.True(t, versionAtLeast("5.30.0", 5, 26))
+	assert.True(t, versionAtLeast("6.0.0", 5, 26))
+	assert.False(t, versionAtLeast("5.12.4", 5, 26))
+	assert.False(t, versionAtLeast("4.30.0", 5, 26))
+	assert.False(t, versionAtLeast("", 5, 26))
+}
+
+func TestSavedPosts(t *testing.T) {
+	me := &model.User{Id: model.NewId(), Username: "me"}
+	alice := &model.User{Id: model.NewId(), Username: "alice", FirstName: "Alice", LastName: "Smith"}
+	town := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, DisplayName: "Town Square"}
+	left := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, DisplayName: "Left"}
+
+	older := newTestPost(town.Id, alice.Id, "the wiki has the runbook", 10)
+	newer := newTestPost(town.Id, alice.Id, "release is out", 20)
+	gone := newTestPost(left.Id, alice.Id, "you can't read me anymore", 30)
+
+	api := &plugintest.API{}
+	api.On("GetServerVersion").Return("5.26.0")
+	api.On("GetChannel", town.Id).Return(town, nil)
+	api.On("HasPermissionToChannel", me.Id, town.Id, model.PERMISSION_READ_CHANNEL).Return(true)
+	api.On("HasPermissionToChannel", me.Id, left.Id, model.PERMISSION_READ_CHANNEL).Return(false)
+	for _, u := range []*model.User{me, alice} {
+		api.On("GetUser", u.Id).Return(u, nil)
+	}
+	for _, post := range []*model.Post{older, newer, gone} {
+		api.On("GetPost", post.Id).Return(post, nil)
+	}
+	prefs := []model.Preference{
+		{UserId: me.Id, Category: model.PREFERENCE_CATEGORY_FLAGGED_POST, Name: gone.Id, Value: "true"},
+		{UserId: me.Id, Category: model.PREFERENCE_CATEGORY_DISPLAY_SETTINGS, Name: "use_military_time", Value: "true"},
+	}
+	api.On("GetPreferencesForUser", me.Id).Return(func(string) []model.Preference { return prefs }, nil)
+	api.On("UpdatePreferencesForUser", me.Id, mock.Anything).Return(func(userID string, updated []model.Preference) *model.AppError {
+		prefs = append(prefs, updated...)
+		return nil
+	})
+	var pinned []*model.Post
+	api.On("UpdatePost", mock.Anything).Return(func(post *model.Post) *model.Post {
+		pinned = append(pinned, post)
+		return post
+	}, nil)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	c := &conversation{UserID: me.Id}
+	dispatch := func(handle intentFunc) *OutgoingResponse {
+		response, err := handle(&IntentContext{Request: newIntentRequest("saved", nil), UserID: me.Id, Conversation: c})
+		if iErr, ok := err.(*intentError); ok {
+			return getResponseWithText(translateError(iErr))
+		}
+		require.NoError(t, err)
+		return response
+	}
+
+	response := dispatch(p.handleSavePost)
+	assert.Equal(t, "There is no message to save. Say read messages first.", speech(t, response))
+	response = dispatch(p.handleReadSaved)
+	assert.Equal(t, "You have no saved messages.", speech(t, response))
+
+	for _, post := range []*model.Post{older, newer} {
+		c.LastPostID = post.Id
+		response = dispatch(p.handleSavePost)
+		assert.Equal(t, "Saved the message from Alice Smith. You'll find it in your saved messages.", speech(t, response))
+	}
+	assert.Equal(t, model.Preference{UserId: me.Id, Category: model.PREFERENCE_CATEGORY_FLAGGED_POST, Name: newer.Id, Value: "true"}, prefs[len(prefs)-1])
+	response = dispatch(p.handleSavePost)
+	assert.Equal(t, "You saved that message already.", speech(t, response))
+
+	response = dispatch(p.handleReadSaved)
+	assert.Equal(t, "You have 2 saved messages:", *response.Prompt.FirstSimple.Speech)
+	assert.Equal(t, `In Town Square:
+Alice Smith wrote 'release is out'.
+Alice Smith wrote 'the wiki has the runbook'.
+That's all your saved messages.`, displayText(t, response))
+
+	response = dispatch(p.handlePinPost)
+	assert.Equal(t, "Pinned the message from Alice Smith.", speech(t, response))
+	require.Len(t, pinned, 1)
+	assert.True(t, pinned[0].IsPinned)
+	assert.Equal(t, older.Id, pinned[0].Id)
+	assert.False(t, older.IsPinned)
+
+	t.Run("older servers", func(t *testing.T) {
+		var calls []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, r.Method+" "+r.URL.Path)
+			if r.Method == http.MethodGet {
+				w.Write([]byte(`[{"user_id": "` + me.Id + `", "category": "flagged_post", "name": "` + newer.Id + `", "value": "true"}]`))
+				return
+			}
+			w.Write([]byte(`{"status": "OK"}`))
+		}))
+		defer server.Close()
+
+		api := &plugintest.API{}
+		api.On("GetServerVersion").Return("5.20.0")
+		api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewString(server.URL)}})
+		api.On("GetPost", older.Id).Return(older, nil)
+		api.On("HasPermissionToChannel", me.Id, town.Id, model.PERMISSION_READ_CHANNEL).Return(true)
+		api.On("GetUser", alice.Id).Return(alice, nil)
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		response := dispatch(p.handleSavePost)
+		assert.Equal(t, "Sorry, saving messages is not set up on this server.", speech(t, response))
+
+		p.setConfiguration(&configuration{AccessToken: "token"})
+		response = dispatch(p.handleSavePost)
+		assert.Equal(t, "Saved the message from Alice Smith. You'll find it in your saved messages.", speech(t, response))
+		assert.Equal(t, []string{
+			"GET /api/v4/users/" + me.Id + "/preferences/flagged_post",
+			"PUT /api/v4/users/" + me.Id + "/preferences",
+		}, calls)
+	})
+}
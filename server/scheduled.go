@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	scheduledMessageTask = "scheduled_message"
+
+	// scheduledTaskProp holds the ID of the task of a scheduled message in its post.
+	scheduledTaskProp = "scheduled_task_id"
+
+	// scheduledMessageClockSkew widens the search for a post sent by an earlier attempt.
+	scheduledMessageClockSkew = time.Minute
+)
+
+// scheduledMessage is the data of a scheduled message task, sent as the user when it is due.
+type scheduledMessage struct {
+	TargetID string `json:"target_id"`
+	Message  string `json:"message"`
+}
+
+// scheduledMessageIndexKey is the key of the index of the scheduled message tasks of the user.
+func scheduledMessageIndexKey(userID string) string {
+	return "sched_" + userID
+}
+
+// whenParam returns the time given by the "when" parameter in the user's time zone.
+func whenParam(ctx *IntentContext, now time.Time) (time.Time, error) {
+	at, ok := parseTime(ctx.Param("when"), now)
+	if !ok {
+		return time.Time{}, newIntentError("time.not_understood", nil, vars{"Time": ctx.Param("when")})
+	}
+	return at, nil
+}
+
+// scheduledMessageParams returns the message to send and when, from the "when" parameter or,
+// failing that, the end of the message as in "standup is moved tomorrow at 9".
+func scheduledMessageParams(ctx *IntentContext, now time.Time) (string, time.Time, error) {
+	message := strings.TrimSpace(ctx.Param("message"))
+	if ctx.HasParam("when") {
+		at, err := whenParam(ctx, now)
+		return message, at, err
+	}
+	message, at, ok := splitReminder(message, now)
+	if !ok {
+		return "", time.Time{}, newIntentError("scheduled.no_time", nil)
+	}
+	return message, at, nil
+}
+
+// handleScheduleMessage schedules a direct message to be sent as the user later on.
+func (p *Plugin) handleScheduleMessage(ctx *IntentContext) (*OutgoingResponse, error) {
+	now := time.Now().In(p.userLocation(ctx.UserID))
+	message, at, err := scheduledMessageParams(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	targetID, question, err := p.resolveUserParam(ctx, "schedule_message", "username")
+	if err != nil || question != nil {
+		return question, err
+	}
+
+	texts := vars{"Message": message, "User": newUserCache(p, ctx.T).displayName(targetID), "When": describeTime(ctx.T, at, now)}
+	if question := ctx.confirm(ctx.T("scheduled.confirm", texts)); question != nil {
+		return question, nil
+	}
+	if err := p.scheduleIndexed(scheduledMessageIndexKey(ctx.UserID), model.NewId(), scheduledMessageTask, ctx.UserID, at, scheduledMessage{TargetID: targetID, Message: message}); err != nil {
+		return nil, err
+	}
+	return getResponseWithText(ctx.T("scheduled.set", texts)), nil
+}
+
+// getScheduledMessages returns the messages the user scheduled along with their tasks, the
+// soonest first.
+func (p *Plugin) getScheduledMessages(userID string) ([]*scheduledTask, []scheduledMessage, error) {
+	tasks, err := p.indexedTasks(scheduledMessageIndexKey(userID))
+	if err != nil {
+		return nil, nil, err
+	}
+	messages := make([]scheduledMessage, len(tasks))
+	for i, task := range tasks {
+		if err := json.Unmarshal(task.Data, &messages[i]); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to decode scheduled message")
+		}
+	}
+	return tasks, messages, nil
+}
+
+// handleListScheduledMessages tells the user which messages will be sent, to whom and when.
+func (p *Plugin) handleListScheduledMessages(ctx *IntentContext) (*OutgoingResponse, error) {
+	tasks, messages, err := p.getScheduledMessages(ctx.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return getResponseWithText(ctx.T("scheduled.none")), nil
+	}
+
+	now := time.Now().In(p.userLocation(ctx.UserID))
+	users := newUserCache(p, ctx.T)
+	items := make([]string, len(tasks))
+	for i, task := range tasks {
+		items[i] = ctx.T("scheduled.item", vars{
+			"Message": messages[i].Message,
+			"User":    users.displayName(messages[i].TargetID),
+			"When":    describeTime(ctx.T, task.due(), now),
+		})
+	}
+	return getResponseWithText(ctx.T("scheduled.list", len(items), vars{"Messages": spokenList(ctx.T, "list.and", items)})), nil
+}
+
+// findScheduledMessage returns the scheduled message the user named by its text or by its
+// recipient, asking which one was meant when several sound alike.
+func (p *Plugin) findScheduledMessage(ctx *IntentContext, intentName string) (*scheduledTask, vars, *OutgoingResponse, error) {
+	tasks, messages, err := p.getScheduledMessages(ctx.UserID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	users := newUserCache(p, ctx.T)
+	names := make([]string, len(tasks))
+	for i := range tasks {
+		names[i] = ctx.T("scheduled.name", vars{"Message": messages[i].Message, "User": users.displayName(messages[i].TargetID)})
+	}
+
+	id, chosen := ctx.Choice("scheduled")
+	if !chosen {
+		spoken := cleanReminderText(ctx.Param("scheduled"))
+		candidates := make([]match, len(tasks))
+		for i, task := range tasks {
+			score := matchScore(spoken, messages[i].Message)
+			if s := nameScore(spoken, users.displayName(messages[i].TargetID)); s > score {
+				score = s
+			}
+			candidates[i] = match{ID: task.ID, Name: names[i], Score: score}
+		}
+		matches, confident := rankMatches(candidates)
+		if len(matches) == 0 {
+			return nil, nil, nil, newIntentError("scheduled.not_found", nil)
+		}
+		if !confident {
+			return nil, nil, ctx.askChoice(intentName, "scheduled", matches), nil
+		}
+		id = matches[0].ID
+	}
+
+	for i, task := range tasks {
+		if task.ID == id {
+			return task, vars{"Message": messages[i].Message, "User": users.displayName(messages[i].TargetID)}, nil, nil
+		}
+	}
+	return nil, nil, nil, newIntentError("scheduled.not_found", nil)
+}
+
+// handleRescheduleMessage moves a scheduled message to another time.
+func (p *Plugin) handleRescheduleMessage(ctx *IntentContext) (*OutgoingResponse, error) {
+	now := time.Now().In(p.userLocation(ctx.UserID))
+	at, err := whenParam(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	task, texts, question, err := p.findScheduledMessage(ctx, "reschedule_message")
+	if err != nil || question != nil {
+		return question, err
+	}
+
+	texts["When"] = describeTime(ctx.T, at, now)
+	if question := ctx.confirm(ctx.T("scheduled.confirm_reschedule", texts)); question != nil {
+		return question, nil
+	}
+	moved, err := p.reschedule(task.ID, at)
+	if err != nil {
+		return nil, err
+	}
+	if !moved {
+		return nil, newIntentError("scheduled.already_sent", nil)
+	}
+	return getResponseWithText(ctx.T("scheduled.set", texts)), nil
+}
+
+// handleCancelScheduledMessage drops a scheduled message before it is sent.
+func (p *Plugin) handleCancelScheduledMessage(ctx *IntentContext) (*OutgoingResponse, error) {
+	task, texts, question, err := p.findScheduledMessage(ctx, "cancel_scheduled_message")
+	if err != nil || question != nil {
+		return question, err
+	}
+	if question := ctx.confirm(ctx.T("scheduled.confirm_cancel", texts)); question != nil {
+		return question, nil
+	}
+	cancelled, err := p.cancelTask(task.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !cancelled {
+		return nil, newIntentError("scheduled.already_sent", nil)
+	}
+	return getResponseWithText(ctx.T("scheduled.cancelled", texts)), nil
+}
+
+// deliverScheduledMessage sends a due scheduled message as the user, the way send_message
+// does. The post is marked with the ID of its task, and a task run again only sends the
+// message if no earlier attempt did, so that it goes out exactly once.
+func (p *Plugin) deliverScheduledMessage(task *scheduledTask) error {
+	var m scheduledMessage
+	if err := json.Unmarshal(task.Data, &m); err != nil {
+		return errors.Wrap(err, "failed to decode scheduled message")
+	}
+	dc, appErr := p.API.GetDirectChannel(task.UserID, m.TargetID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to create dm channel")
+	}
+	if task.Attempts > 1 {
+		sent, err := p.scheduledMessageSent(dc.Id, task)
+		if err != nil || sent {
+			return err
+		}
+	}
+
+	post := &model.Post{ChannelId: dc.Id, UserId: task.UserID, Message: m.Message}
+	post.AddProp(scheduledTaskProp, task.ID)
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		return errors.Wrap(appErr, "failed to create post")
+	}
+	return nil
+}
+
+// scheduledMessageSent reports whether an earlier attempt of the task posted its message to
+// the channel, such as one that failed after the post was created or whose server stopped.
+func (p *Plugin) scheduledMessageSent(channelID string, task *scheduledTask) (bool, error) {
+	// The servers of the cluster may not agree on the time to the millisecond.
+	since := task.Started - int64(scheduledMessageClockSkew/time.Millisecond)
+	pl, appErr := p.API.GetPostsSince(channelID, since)
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to get posts")
+	}
+	for _, post := range pl.Posts {
+		if post.UserId == task.UserID && post.GetProp(scheduledTaskProp) == task.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// describeScheduledMessages lists the messages of /assistant scheduled.
+func (p *Plugin) describeScheduledMessages(tasks []*scheduledTask, messages []scheduledMessage, loc *time.Location) string {
+	if len(tasks) == 0 {
+		return "You have no scheduled messages."
+	}
+	users := newUserCache(p, translator(defaultLocale))
+	lines := []string{"Your scheduled messages:"}
+	for i, task := range tasks {
+		lines = append(lines, fmt.Sprintf("%d. \"%s\" to %s, %s", i+1, messages[i].Message, users.displayName(messages[i].TargetID), task.due().In(loc).Format("Mon Jan 2 at 3:04 PM")))
+	}
+	lines = append(lines, "Reschedule one with `/assistant scheduled reschedule <number> <when>` or cancel it with `/assistant scheduled cancel <number>`.")
+	return strings.Join(lines, "\n")
+}
+
+// executeScheduledCommand lists the user's scheduled messages, moves one with
+// `/assistant scheduled reschedule <number> <when>` or cancels one with
+// `/assistant scheduled cancel <number>`.
+func (p *Plugin) executeScheduledCommand(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	respond := func(text string) (*model.CommandResponse, *model.AppError) {
+		return &model.CommandResponse{ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL, Text: text}, nil
+	}
+	loc := p.userLocation(userID)
+	tasks, messages, err := p.getScheduledMessages(userID)
+	if err != nil {
+		p.API.LogError("Cannot get scheduled messages", "err", err.Error())
+		return respond("Failed to get your scheduled messages, please try again.")
+	}
+
+	if len(args) == 0 {
+		return respond(p.describeScheduledMessages(tasks, messages, loc))
+	}
+	number := func() (int, bool) {
+		var n int
+		if _, err := fmt.Sscanf(args[1], "%d", &n); err != nil || n < 1 || n > len(tasks) {
+			return 0, false
+		}
+		return n - 1, true
+	}
+	switch args[0] {
+	case "reschedule":
+		if len(args) < 3 {
+			return respond("Usage: `/assistant scheduled reschedule <number> <when>`")
+		}
+		i, ok := number()
+		if !ok {
+			return respond(fmt.Sprintf("Sorry, there is no scheduled message %s.", args[1]))
+		}
+		at, ok := parseTime(strings.Join(args[2:], " "), time.Now().In(loc))
+		if !ok {
+			return respond("Sorry, I didn't understand when to send the message. Try `/assistant scheduled reschedule 1 tomorrow at 9am`.")
+		}
+		moved, err := p.reschedule(tasks[i].ID, at)
+		if err != nil {
+			p.API.LogError("Cannot reschedule message", "err", err.Error())
+			return respond("Failed to reschedule the message, please try again.")
+		}
+		if !moved {
+			return respond("Sorry, that message was already sent.")
+		}
+		return respond(fmt.Sprintf("I'll send \"%s\" on %s.", messages[i].Message, at.Format("Mon Jan 2 at 3:04 PM")))
+	case "cancel":
+		if len(args) != 2 {
+			return respond("Usage: `/assistant scheduled cancel <number>`")
+		}
+		i, ok := number()
+		if !ok {
+			return respond(fmt.Sprintf("Sorry, there is no scheduled message %s.", args[1]))
+		}
+		cancelled, err := p.cancelTask(tasks[i].ID)
+		if err != nil {
+			p.API.LogError("Cannot cancel scheduled message", "err", err.Error())
+			return respond("Failed to cancel the message, please try again.")
+		}
+		if !cancelled {
+			return respond("Sorry, that message was already sent.")
+		}
+		return respond(fmt.Sprintf("Cancelled the message \"%s\".", messages[i].Message))
+	default:
+		return respond("Usage: `/assistant scheduled [reschedule <number> <when>|cancel <number>]`")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduledMessages(t *testing.T) {
+	me := &model.User{Id: model.NewId(), Username: "me", Timezone: model.StringMap{"useAutomaticTimezone": "false", "manualTimezone": "UTC"}}
+	bob := &model.User{Id: model.NewId(), Username: "bob", FirstName: "Bob", LastName: "Builder"}
+	alice := &model.User{Id: model.NewId(), Username: "alice", FirstName: "Alice", LastName: "Smith"}
+	team := &model.Team{Id: model.NewId()}
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetTeamsForUser", me.Id).Return([]*model.Team{team}, nil)
+	api.On("GetUsersInTeam", team.Id, 0, usersPerPage).Return([]*model.User{me, bob, alice}, nil)
+	for _, u := range []*model.User{me, bob, alice} {
+		api.On("GetUser", u.Id).Return(u, nil)
+		api.On("GetDirectChannel", me.Id, u.Id).Return(&model.Channel{Id: "dm_" + u.Username, Type: model.CHANNEL_DIRECT}, nil)
+	}
+	var posted []*model.Post
+	var createErr *model.AppError
+	api.On("CreatePost", mock.Anything).Return(func(post *model.Post) *model.Post {
+		posted = append(posted, post)
+		return post
+	}, func(*model.Post) *model.AppError {
+		// The post is created even when the request fails, as on a timeout.
+		appErr := createErr
+		createErr = nil
+		return appErr
+	})
+	api.On("GetPostsSince", mock.Anything, mock.Anything).Return(func(channelID string, since int64) *model.PostList {
+		var found []*model.Post
+		for _, post := range posted {
+			if post.ChannelId == channelID {
+				found = append(found, post)
+			}
+		}
+		return newPostList(found...)
+	}, nil)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.registerTasks()
+	dispatch := func(handle intentFunc, name string, params map[string]interface{}, c *conversation) string {
+		response, err := handle(&IntentContext{Request: newIntentRequest(name, params), UserID: me.Id, Conversation: c})
+		if iErr, ok := err.(*intentError); ok {
+			return translateError(iErr)
+		}
+		require.NoError(t, err)
+		return speech(t, response)
+	}
+	c := &conversation{UserID: me.Id}
+
+	assert.Equal(t, "You have no scheduled messages.", dispatch(p.handleListScheduledMessages, "list_scheduled_messages", nil, c))
+	assert.Equal(t, "Sorry, I didn't catch when to send the message.",
+		dispatch(p.handleScheduleMessage, "schedule_message", map[string]interface{}{"username": "bob", "message": "standup is moved"}, c))
+
+	assert.Regexp(t, `^OK, I'll send it (today|tomorrow) at `,
+		dispatch(p.handleScheduleMessage, "schedule_message", map[string]interface{}{"username": "bob", "message": "standup is moved", "when": "in 2 hours"}, c))
+	dispatch(p.handleScheduleMessage, "schedule_message", map[string]interface{}{"username": "alice", "message": "lunch is on me in 3 hours"}, c)
+	assert.Regexp(t, `^You have 2 scheduled messages: 'standup is moved' to Bob Builder .* and 'lunch is on me' to Alice Smith .*\.$`,
+		dispatch(p.handleListScheduledMessages, "list_scheduled_messages", nil, c))
+
+	t.Run("reschedule", func(t *testing.T) {
+		assert.Regexp(t, `^OK, I'll send it (today|tomorrow) at `,
+			dispatch(p.handleRescheduleMessage, "reschedule_message", map[string]interface{}{"scheduled": "to alice", "when": "in 4 hours"}, c))
+		assert.Equal(t, "Sorry, I can't find that scheduled message!",
+			dispatch(p.handleRescheduleMessage, "reschedule_message", map[string]interface{}{"scheduled": "release party", "when": "in 4 hours"}, c))
+
+		tasks, _, err := p.getScheduledMessages(me.Id)
+		require.NoError(t, err)
+		require.Len(t, tasks, 2)
+		assert.WithinDuration(t, time.Now().Add(4*time.Hour), tasks[1].due(), 2*time.Minute)
+	})
+
+	t.Run("slash command", func(t *testing.T) {
+		response, _ := p.executeScheduledCommand(me.Id, nil)
+		assert.Contains(t, response.Text, "1. \"standup is moved\" to Bob Builder, ")
+		assert.Contains(t, response.Text, "2. \"lunch is on me\" to Alice Smith, ")
+
+		response, _ = p.executeScheduledCommand(me.Id, []string{"reschedule", "3", "tomorrow"})
+		assert.Equal(t, "Sorry, there is no scheduled message 3.", response.Text)
+		response, _ = p.executeScheduledCommand(me.Id, []string{"reschedule", "2", "in", "5", "hours"})
+		assert.Contains(t, response.Text, "I'll send \"lunch is on me\" on ")
+	})
+
+	t.Run("delivery", func(t *testing.T) {
+		p.runDueTasks(time.Now().Add(2*time.Hour + time.Minute))
+		require.Len(t, posted, 1)
+		assert.Equal(t, "dm_bob", posted[0].ChannelId)
+		assert.Equal(t, me.Id, posted[0].UserId)
+		assert.Equal(t, "standup is moved", posted[0].Message)
+
+		p.runDueTasks(time.Now().Add(2*time.Hour + time.Minute))
+		assert.Len(t, posted, 1)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		assert.Equal(t, "Cancelled the message 'lunch is on me' to Alice Smith.",
+			dispatch(p.handleCancelScheduledMessage, "cancel_scheduled_message", map[string]interface{}{"scheduled": "lunch"}, c))
+		assert.Equal(t, "You have no scheduled messages.", dispatch(p.handleListScheduledMessages, "list_scheduled_messages", nil, c))
+
+		p.runDueTasks(time.Now().Add(6 * time.Hour))
+		assert.Len(t, posted, 1)
+	})
+
+	t.Run("sent once when an attempt fails after posting", func(t *testing.T) {
+		dispatch(p.handleScheduleMessage, "schedule_message", map[string]interface{}{"username": "alice", "message": "release is out", "when": "in 1 hour"}, c)
+		createErr = model.NewAppError("CreatePost", "app.post.save.app_error", nil, "timeout", http.StatusInternalServerError)
+		api.On("LogError", "Scheduled task failed", "task_id", mock.Anything, "err", mock.Anything).Once()
+
+		now := time.Now().Add(time.Hour + time.Minute)
+		p.runDueTasks(now)
+		require.Len(t, posted, 2)
+		tasks, _, err := p.getScheduledMessages(me.Id)
+		require.NoError(t, err)
+		require.Len(t, tasks, 1)
+
+		p.runDueTasks(now.Add(taskRetryDelay))
+		assert.Len(t, posted, 2)
+		tasks, _, err = p.getScheduledMessages(me.Id)
+		require.NoError(t, err)
+		assert.Empty(t, tasks)
+	})
+
+	t.Run("left alone while another server runs it", func(t *testing.T) {
+		dispatch(p.handleScheduleMessage, "schedule_message", map[string]interface{}{"username": "bob", "message": "see you", "when": "in 1 hour"}, c)
+		tasks, _, err := p.getScheduledMessages(me.Id)
+		require.NoError(t, err)
+		require.Len(t, tasks, 1)
+
+		// Another server took the task and stopped before sending the message.
+		now := time.Now().Add(time.Hour + time.Minute)
+		task := tasks[0]
+		task.Attempts, task.Started = 1, model.GetMillisForTime(now)
+		task.LeaseOwner, task.LeaseUntil = model.NewId(), model.GetMillisForTime(now.Add(taskLeaseTTL))
+		require.NoError(t, p.kvSetJSON(taskKeyPrefix+task.ID, task, 0))
+		assert.Equal(t, "Sorry, that message was already sent.",
+			dispatch(p.handleCancelScheduledMessage, "cancel_scheduled_message", map[string]interface{}{"scheduled": "see you"}, c))
+
+		p.runDueTasks(now)
+		assert.Len(t, posted, 2)
+		p.runDueTasks(now.Add(taskLeaseTTL))
+		require.Len(t, posted, 3)
+		assert.Equal(t, "see you", posted[2].Message)
+		assert.Equal(t, task.ID, posted[2].GetProp(scheduledTaskProp))
+		p.runDueTasks(now.Add(2 * taskLeaseTTL))
+		assert.Len(t, posted, 3)
+	})
+}
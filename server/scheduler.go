@@ -0,0 +1,521 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	scheduleKey       = "schedule"
+	taskKeyPrefix     = "task_"
+	schedulerLockKey  = "scheduler_lock"
+	schedulerInterval = 30 * time.Second
+
+	// schedulerLockTTL frees the lock of a server that stopped while running tasks. The lock is
+	// renewed before every task.
+	schedulerLockTTL = 2 * time.Minute
+
+	// taskLeaseTTL is how long other servers leave alone a task being run, after which a
+	// server that stopped while running it is taken to have failed.
+	taskLeaseTTL = 2 * time.Minute
+
+	// Failed tasks are retried after taskRetryDelay, doubled on every attempt up to
+	// maxTaskRetryDelay, and given up after maxTaskAttempts.
+	taskRetryDelay    = time.Minute
+	maxTaskRetryDelay = time.Hour
+	maxTaskAttempts   = 10
+)
+
+// scheduledTask is something the plugin does later on behalf of a user, such as restoring
+// their status. Tasks are stored in the KV store and so survive restarts.
+type scheduledTask struct {
+	// ID identifies the task, scheduling another task with the same ID replaces it.
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	UserID string `json:"user_id"`
+
+	// At is when the task is due, in milliseconds since the epoch.
+	At int64 `json:"at"`
+
+	// Data is decoded by the handler of the kind of task.
+	Data json.RawMessage `json:"data,omitempty"`
+
+	// Attempts counts the runs of the task so far, which failed unless one is under way.
+	Attempts int `json:"attempts,omitempty"`
+
+	// Started is when the task was first run, in milliseconds since the epoch. Handlers of
+	// tasks run again look for what an earlier attempt did since then.
+	Started int64 `json:"started,omitempty"`
+
+	// LeaseOwner is the run of the scheduler the task is leased to until LeaseUntil, in
+	// milliseconds since the epoch. Other runs leave the task alone until then.
+	LeaseOwner string `json:"lease_owner,omitempty"`
+	LeaseUntil int64  `json:"lease_until,omitempty"`
+
+	// Done records that the handler succeeded, should dropping the task afterwards fail.
+	Done bool `json:"done,omitempty"`
+}
+
+// due returns when the task is due.
+func (task *scheduledTask) due() time.Time {
+	return time.Unix(0, task.At*int64(time.Millisecond))
+}
+
+// leased reports whether a run of the scheduler holds the task at now.
+func (task *scheduledTask) leased(now time.Time) bool {
+	return task.LeaseUntil > model.GetMillisForTime(now)
+}
+
+// retryDelay returns how long to wait before running the task again after a failed attempt.
+func (task *scheduledTask) retryDelay() time.Duration {
+	delay := taskRetryDelay
+	for i := 1; i < task.Attempts && delay < maxTaskRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxTaskRetryDelay {
+		delay = maxTaskRetryDelay
+	}
+	return delay
+}
+
+// taskHandler runs a due task. Failed tasks are logged and retried later, see runTask, so
+// handlers of tasks with effects that must not be repeated check whether an earlier attempt
+// had them already.
+type taskHandler func(task *scheduledTask) error
+
+// registerTasks sets the handlers of every kind of task.
+func (p *Plugin) registerTasks() {
+	p.taskHandlers = map[string]taskHandler{
+		restoreStatusTask:     p.restoreStatus,
+		clearCustomStatusTask: p.clearExpiredCustomStatus,
+		reminderTask:          p.deliverReminder,
+		scheduledMessageTask:  p.deliverScheduledMessage,
+	}
+}
+
+// scheduleAt schedules a task of the kind for the user at the given time, see schedule.
+func (p *Plugin) scheduleAt(id, kind, userID string, at time.Time, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode task")
+	}
+	return p.schedule(&scheduledTask{ID: id, Kind: kind, UserID: userID, At: model.GetMillisForTime(at), Data: encoded})
+}
+
+// getTask loads a scheduled task, or returns nil if there is none with the ID.
+func (p *Plugin) getTask(id string) (*scheduledTask, error) {
+	var task scheduledTask
+	found, err := p.kvGetJSON(taskKeyPrefix+id, &task)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// schedule stores a task and adds it to the schedule, replacing any task with the same ID.
+func (p *Plugin) schedule(task *scheduledTask) error {
+	if err := p.kvSetJSON(taskKeyPrefix+task.ID, task, 0); err != nil {
+		return err
+	}
+	return p.updateSchedule(func(due map[string]int64) {
+		due[task.ID] = task.At
+	})
+}
+
+// unschedule drops a task, if it is still scheduled.
+func (p *Plugin) unschedule(id string) error {
+	if err := p.updateSchedule(func(due map[string]int64) {
+		delete(due, id)
+	}); err != nil {
+		return err
+	}
+	if appErr := p.API.KVDelete(taskKeyPrefix + id); appErr != nil {
+		return errors.Wrap(appErr, "failed to delete task")
+	}
+	return nil
+}
+
+// reschedule moves a task to another time. It returns false if the task is no longer
+// scheduled, such as when it already ran.
+func (p *Plugin) reschedule(id string, at time.Time) (bool, error) {
+	data, appErr := p.API.KVGet(taskKeyPrefix + id)
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to get task")
+	}
+	if data == nil {
+		return false, nil
+	}
+	var task scheduledTask
+	if err := json.Unmarshal(data, &task); err != nil {
+		return false, errors.Wrap(err, "failed to decode task")
+	}
+	if task.Done || task.leased(time.Now()) {
+		return false, nil
+	}
+	task.At = model.GetMillisForTime(at)
+	moved, err := json.Marshal(&task)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to encode task")
+	}
+	// Swapping the task fails once a server leased it to run, see runTask.
+	ok, appErr := p.API.KVCompareAndSet(taskKeyPrefix+id, data, moved)
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to set task")
+	}
+	if !ok {
+		return false, nil
+	}
+	return true, p.updateSchedule(func(due map[string]int64) {
+		due[id] = task.At
+	})
+}
+
+// cancelTask drops a task unless it already ran, returning whether it did not.
+func (p *Plugin) cancelTask(id string) (bool, error) {
+	data, appErr := p.API.KVGet(taskKeyPrefix + id)
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to get task")
+	}
+	if data == nil {
+		return false, nil
+	}
+	var task scheduledTask
+	if err := json.Unmarshal(data, &task); err != nil {
+		return false, errors.Wrap(err, "failed to decode task")
+	}
+	if task.Done || task.leased(time.Now()) {
+		return false, nil
+	}
+	ok, appErr := p.API.KVCompareAndDelete(taskKeyPrefix+id, data)
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to delete task")
+	}
+	if !ok {
+		return false, nil
+	}
+	return true, p.updateSchedule(func(due map[string]int64) {
+		delete(due, id)
+	})
+}
+
+// The tasks of a user that they may list, such as their reminders, are found through an index
+// holding their IDs under a key per user. Task IDs are kept short for their keys to fit the KV
+// store, which leaves no room to find them by a prefix.
+
+// scheduleIndexed schedules a task like scheduleAt and adds it to the index under indexKey.
+func (p *Plugin) scheduleIndexed(indexKey, id, kind, userID string, at time.Time, data interface{}) error {
+	if err := p.scheduleAt(id, kind, userID, at, data); err != nil {
+		return err
+	}
+	if err := p.updateTaskIndex(indexKey, func(ids []string) []string {
+		return append(ids, id)
+	}); err != nil {
+		if unscheduleErr := p.unschedule(id); unscheduleErr != nil {
+			p.API.LogWarn("Cannot unschedule task", "task_id", id, "err", unscheduleErr.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+// indexedTasks returns the scheduled tasks of the index under indexKey, the soonest first. The
+// IDs of the tasks that ran or were cancelled are dropped from the index.
+func (p *Plugin) indexedTasks(indexKey string) ([]*scheduledTask, error) {
+	var ids []string
+	if _, err := p.kvGetJSON(indexKey, &ids); err != nil {
+		return nil, err
+	}
+	var tasks []*scheduledTask
+	gone := make(map[string]bool)
+	for _, id := range ids {
+		task, err := p.getTask(id)
+		if err != nil {
+			return nil, err
+		}
+		if task == nil {
+			gone[id] = true
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	if len(gone) > 0 {
+		if err := p.updateTaskIndex(indexKey, func(ids []string) []string {
+			var kept []string
+			for _, id := range ids {
+				if !gone[id] {
+					kept = append(kept, id)
+				}
+			}
+			return kept
+		}); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].At < tasks[j].At
+	})
+	return tasks, nil
+}
+
+// updateTaskIndex changes the task IDs of the index under indexKey, retrying concurrent
+// changes like updateSchedule.
+func (p *Plugin) updateTaskIndex(indexKey string, update func(ids []string) []string) error {
+	for {
+		old, appErr := p.API.KVGet(indexKey)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to get task index")
+		}
+		var ids []string
+		if old != nil {
+			if err := json.Unmarshal(old, &ids); err != nil {
+				return errors.Wrap(err, "failed to decode task index")
+			}
+		}
+
+		data, err := json.Marshal(update(ids))
+		if err != nil {
+			return errors.Wrap(err, "failed to encode task index")
+		}
+		ok, appErr := p.API.KVCompareAndSet(indexKey, old, data)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to set task index")
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+// updateSchedule changes the schedule, which maps the ID of every task to when it is due.
+// Concurrent changes, possibly by other servers of the cluster, are retried.
+func (p *Plugin) updateSchedule(update func(due map[string]int64)) error {
+	for {
+		old, appErr := p.API.KVGet(scheduleKey)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to get schedule")
+		}
+		due := make(map[string]int64)
+		if old != nil {
+			if err := json.Unmarshal(old, &due); err != nil {
+				return errors.Wrap(err, "failed to decode schedule")
+			}
+		}
+
+		update(due)
+		data, err := json.Marshal(due)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode schedule")
+		}
+		ok, appErr := p.API.KVCompareAndSet(scheduleKey, old, data)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to set schedule")
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+// runDueTasks runs the tasks due by now. Only one server of the cluster runs tasks at a time,
+// the others skip their turn.
+func (p *Plugin) runDueTasks(now time.Time) {
+	lock := []byte(model.NewId())
+	locked, appErr := p.API.KVSetWithOptions(schedulerLockKey, lock, model.PluginKVSetOptions{
+		Atomic:          true,
+		ExpireInSeconds: int64(schedulerLockTTL / time.Second),
+	})
+	if appErr != nil {
+		p.API.LogError("Cannot lock scheduler", "err", appErr.Error())
+		return
+	}
+	if !locked {
+		return
+	}
+	// The lock may have expired and been taken by another server meanwhile, which keeps it.
+	defer func() {
+		if _, appErr := p.API.KVCompareAndDelete(schedulerLockKey, lock); appErr != nil {
+			p.API.LogWarn("Cannot unlock scheduler", "err", appErr.Error())
+		}
+	}()
+
+	var due map[string]int64
+	if _, err := p.kvGetJSON(scheduleKey, &due); err != nil {
+		p.API.LogError("Cannot get schedule", "err", err.Error())
+		return
+	}
+	for id, at := range due {
+		if at > model.GetMillisForTime(now) {
+			continue
+		}
+		// A slow run could otherwise outlast the lock and share the tasks with another server.
+		if !p.renewSchedulerLock(lock) {
+			return
+		}
+		if err := p.runTask(id, at, string(lock), now); err != nil {
+			p.API.LogError("Scheduled task failed", "task_id", id, "err", err.Error())
+		}
+	}
+}
+
+// renewSchedulerLock extends the scheduler lock, reporting whether this run still holds it.
+func (p *Plugin) renewSchedulerLock(lock []byte) bool {
+	renewed, appErr := p.API.KVSetWithOptions(schedulerLockKey, lock, model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        lock,
+		ExpireInSeconds: int64(schedulerLockTTL / time.Second),
+	})
+	if appErr != nil {
+		p.API.LogError("Cannot renew scheduler lock", "err", appErr.Error())
+		return false
+	}
+	return renewed
+}
+
+// runTask runs a due task for the scheduler run owner and drops it once its handler
+// succeeded, unless it was rescheduled meanwhile. The task is leased to the run while its
+// handler runs, so that no other server runs it too. A failed task stays scheduled, to be
+// retried later, as does a task whose lease expired because its server stopped.
+func (p *Plugin) runTask(id string, at int64, owner string, now time.Time) error {
+	data, appErr := p.API.KVGet(taskKeyPrefix + id)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get task")
+	}
+	if data == nil {
+		return p.updateSchedule(func(due map[string]int64) {
+			if due[id] == at {
+				delete(due, id)
+			}
+		})
+	}
+
+	var task scheduledTask
+	if err := json.Unmarshal(data, &task); err != nil {
+		return errors.Wrap(err, "failed to decode task")
+	}
+	if task.At != at || task.leased(now) {
+		return nil
+	}
+	if task.Done {
+		return p.dropTask(id, at, data)
+	}
+	handle, ok := p.taskHandlers[task.Kind]
+	if !ok {
+		return errors.Errorf("unknown task kind %q", task.Kind)
+	}
+
+	// Taking the lease claims the task: rescheduling or cancelling it fails from then on, and
+	// so does taking it for another run, as the task was changed since it was loaded.
+	task.Attempts++
+	if task.Started == 0 {
+		task.Started = model.GetMillisForTime(now)
+	}
+	task.LeaseOwner = owner
+	task.LeaseUntil = model.GetMillisForTime(now.Add(taskLeaseTTL))
+	leased, err := p.swapTask(&task, data)
+	if leased == nil || err != nil {
+		return err
+	}
+
+	if handleErr := handle(&task); handleErr != nil {
+		if task.Attempts >= maxTaskAttempts {
+			p.API.LogError("Giving up scheduled task", "task_id", id, "attempts", task.Attempts)
+			if err := p.dropTask(id, at, leased); err != nil {
+				return err
+			}
+			return handleErr
+		}
+		return p.retryTask(&task, leased, now, handleErr)
+	}
+
+	task.Done = true
+	done, err := p.swapTask(&task, leased)
+	if done == nil || err != nil {
+		return err
+	}
+	return p.dropTask(id, at, done)
+}
+
+// swapTask stores the task in place of old, returning what it stored or nil if the task was
+// changed meanwhile.
+func (p *Plugin) swapTask(task *scheduledTask, old []byte) ([]byte, error) {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode task")
+	}
+	ok, appErr := p.API.KVCompareAndSet(taskKeyPrefix+task.ID, old, data)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to set task")
+	}
+	if !ok {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// dropTask deletes a task that ran, stored as data, and removes it from the schedule.
+func (p *Plugin) dropTask(id string, at int64, data []byte) error {
+	if _, appErr := p.API.KVCompareAndDelete(taskKeyPrefix+id, data); appErr != nil {
+		return errors.Wrap(appErr, "failed to delete task")
+	}
+	return p.updateSchedule(func(due map[string]int64) {
+		if due[id] == at {
+			delete(due, id)
+		}
+	})
+}
+
+// retryTask releases a task whose handler failed with err and schedules it to run again
+// later, returning err.
+func (p *Plugin) retryTask(task *scheduledTask, leased []byte, now time.Time, err error) error {
+	at := task.At
+	task.At = model.GetMillisForTime(now.Add(task.retryDelay()))
+	task.LeaseOwner, task.LeaseUntil = "", 0
+	retried, swapErr := p.swapTask(task, leased)
+	if swapErr != nil {
+		return swapErr
+	}
+	if retried != nil {
+		if updateErr := p.updateSchedule(func(due map[string]int64) {
+			if due[task.ID] == at {
+				due[task.ID] = task.At
+			}
+		}); updateErr != nil {
+			return updateErr
+		}
+	}
+	return errors.Wrapf(err, "attempt %d failed, retrying at %s", task.Attempts, task.due().UTC().Format(time.RFC3339))
+}
+
+// startScheduler runs due tasks in the background until stopScheduler is called.
+func (p *Plugin) startScheduler() {
+	stop, done := make(chan struct{}), make(chan struct{})
+	p.stopSchedulerFunc = func() {
+		close(stop)
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				p.runDueTasks(now)
+			}
+		}
+	}()
+}
+
+func (p *Plugin) stopScheduler() {
+	if p.stopSchedulerFunc != nil {
+		p.stopSchedulerFunc()
+		p.stopSchedulerFunc = nil
+	}
+}
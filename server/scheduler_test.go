@@ -0,0 +1,152 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler(t *testing.T) {
+	api := &plugintest.API{}
+	kv := newMemKV(api)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	var ran []string
+	p.taskHandlers = map[string]taskHandler{
+		"test": func(task *scheduledTask) error {
+			ran = append(ran, task.ID)
+			return nil
+		},
+	}
+
+	now := time.Now()
+	require.NoError(t, p.scheduleAt("due", "test", "user", now.Add(-time.Minute), nil))
+	require.NoError(t, p.scheduleAt("later", "test", "user", now.Add(time.Hour), nil))
+	require.NoError(t, p.scheduleAt("dropped", "test", "user", now.Add(-time.Minute), nil))
+	require.NoError(t, p.unschedule("dropped"))
+
+	t.Run("runs due tasks once", func(t *testing.T) {
+		p.runDueTasks(now)
+		assert.Equal(t, []string{"due"}, ran)
+		p.runDueTasks(now)
+		assert.Equal(t, []string{"due"}, ran)
+		assert.Nil(t, kv.get(taskKeyPrefix+"due"))
+		assert.Nil(t, kv.get(taskKeyPrefix+"dropped"))
+	})
+
+	t.Run("rescheduling replaces the task", func(t *testing.T) {
+		require.NoError(t, p.scheduleAt("later", "test", "user", now.Add(-time.Second), nil))
+		p.runDueTasks(now)
+		assert.Equal(t, []string{"due", "later"}, ran)
+	})
+
+	t.Run("moves and cancels tasks not yet run", func(t *testing.T) {
+		require.NoError(t, p.scheduleAt("moved", "test", "user", now.Add(time.Hour), nil))
+		moved, err := p.reschedule("moved", now.Add(-time.Second))
+		require.NoError(t, err)
+		assert.True(t, moved)
+		require.NoError(t, p.scheduleAt("cancelled", "test", "user", now.Add(-time.Second), nil))
+		cancelled, err := p.cancelTask("cancelled")
+		require.NoError(t, err)
+		assert.True(t, cancelled)
+
+		p.runDueTasks(now)
+		assert.Equal(t, []string{"due", "later", "moved"}, ran)
+		moved, err = p.reschedule("moved", now.Add(time.Hour))
+		require.NoError(t, err)
+		assert.False(t, moved)
+		cancelled, err = p.cancelTask("moved")
+		require.NoError(t, err)
+		assert.False(t, cancelled)
+		ran = ran[:2]
+	})
+
+	t.Run("skips its turn while another server runs tasks", func(t *testing.T) {
+		require.NoError(t, p.scheduleAt("locked", "test", "user", now.Add(-time.Second), nil))
+		kv.set(schedulerLockKey, []byte(model.NewId()), 60)
+		p.runDueTasks(now)
+		assert.Equal(t, []string{"due", "later"}, ran)
+
+		kv.set(schedulerLockKey, nil, 0)
+		p.runDueTasks(now)
+		assert.Equal(t, []string{"due", "later", "locked"}, ran)
+	})
+
+	t.Run("retries failed tasks later", func(t *testing.T) {
+		failures := 2
+		p.taskHandlers["flaky"] = func(task *scheduledTask) error {
+			if failures > 0 {
+				failures--
+				return errors.New("server unavailable")
+			}
+			ran = append(ran, task.ID)
+			return nil
+		}
+		api.On("LogError", "Scheduled task failed", "task_id", "flaky", "err", mock.Anything).Twice()
+		require.NoError(t, p.scheduleAt("flaky", "flaky", "user", now.Add(-time.Second), nil))
+
+		p.runDueTasks(now)
+		task, err := p.getTask("flaky")
+		require.NoError(t, err)
+		require.NotNil(t, task)
+		assert.Equal(t, 1, task.Attempts)
+		assert.WithinDuration(t, now.Add(taskRetryDelay), task.due(), time.Second)
+
+		p.runDueTasks(now.Add(taskRetryDelay))
+		task, err = p.getTask("flaky")
+		require.NoError(t, err)
+		require.NotNil(t, task)
+		assert.Equal(t, 2, task.Attempts)
+		assert.WithinDuration(t, now.Add(3*taskRetryDelay), task.due(), time.Second)
+
+		p.runDueTasks(now.Add(3 * taskRetryDelay))
+		assert.Equal(t, []string{"due", "later", "locked", "flaky"}, ran)
+		assert.Nil(t, kv.get(taskKeyPrefix+"flaky"))
+		ran = ran[:3]
+	})
+
+	t.Run("stops once another server took the lock", func(t *testing.T) {
+		other := []byte(model.NewId())
+		var slow []string
+		p.taskHandlers["steal"] = func(task *scheduledTask) error {
+			slow = append(slow, task.ID)
+			kv.set(schedulerLockKey, other, 60)
+			return nil
+		}
+		require.NoError(t, p.scheduleAt("slow1", "steal", "user", now.Add(-time.Second), nil))
+		require.NoError(t, p.scheduleAt("slow2", "steal", "user", now.Add(-time.Second), nil))
+		p.runDueTasks(now)
+		assert.Len(t, slow, 1)
+		assert.Equal(t, other, kv.get(schedulerLockKey))
+
+		kv.set(schedulerLockKey, nil, 0)
+		p.runDueTasks(now)
+		assert.Len(t, slow, 2)
+		kv.set(schedulerLockKey, nil, 0)
+	})
+
+	t.Run("leaves tasks leased to another run alone", func(t *testing.T) {
+		require.NoError(t, p.scheduleAt("leased", "test", "user", now.Add(-time.Second), nil))
+		task, err := p.getTask("leased")
+		require.NoError(t, err)
+		task.Attempts, task.LeaseOwner, task.LeaseUntil = 1, model.NewId(), model.GetMillisForTime(now.Add(taskLeaseTTL))
+		require.NoError(t, p.kvSetJSON(taskKeyPrefix+task.ID, task, 0))
+
+		p.runDueTasks(now)
+		assert.Equal(t, []string{"due", "later", "locked"}, ran)
+		moved, err := p.reschedule("leased", now.Add(time.Hour))
+		require.NoError(t, err)
+		assert.False(t, moved)
+
+		p.runDueTasks(now.Add(taskLeaseTTL))
+		assert.Equal(t, []string{"due", "later", "locked", "leased"}, ran)
+		ran = ran[:3]
+	})
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// searchResultTypeName is the type of the Actions console whose entries are the results of
+	// the last search, which lists on screens select from.
+	searchResultTypeName = "search_result"
+
+	// maxSearchResults caps how many results are kept to be listed and picked from.
+	maxSearchResults = maxBrowseItems
+)
+
+// searchResult is a post found by the last search, which the user may ask to hear in full.
+type searchResult struct {
+	PostID string `json:"post_id"`
+	Name   string `json:"name"`
+}
+
+// searchFilters maps the spoken filters of search_messages to the server's search parameters:
+// the words to look for, who wrote the post, in which channel and when.
+func (p *Plugin) searchFilters(ctx *IntentContext, now time.Time) (*model.SearchParams, string, *OutgoingResponse, error) {
+	params := &model.SearchParams{Terms: ctx.Param("terms")}
+	if ctx.HasParam("from") {
+		userID, question, err := p.resolveUserParam(ctx, "search_messages", "from")
+		if err != nil || question != nil {
+			return nil, "", question, err
+		}
+		u, appErr := p.API.GetUser(userID)
+		if appErr != nil {
+			return nil, "", nil, errors.Wrap(appErr, "failed to get user")
+		}
+		params.FromUsers = []string{u.Username}
+	}
+
+	var teamID string
+	if ctx.HasParam("channel") {
+		channelID, question, err := p.resolveChannelParam(ctx, "search_messages", "channel")
+		if err != nil || question != nil {
+			return nil, "", question, err
+		}
+		channel, appErr := p.API.GetChannel(channelID)
+		if appErr != nil {
+			return nil, "", nil, errors.Wrap(appErr, "failed to get channel")
+		}
+		params.InChannels, teamID = []string{channel.Name}, channel.TeamId
+	}
+
+	if ctx.HasParam("when") {
+		start, end, ok := parseDateRange(ctx.Param("when"), now)
+		if !ok {
+			return nil, "", nil, newIntentError("time.not_understood", nil, vars{"Time": ctx.Param("when")})
+		}
+		// The server searches after the end of the after date and before the start of the
+		// before date.
+		_, offset := now.Zone()
+		params.AfterDate = start.AddDate(0, 0, -1).Format("2006-01-02")
+		params.BeforeDate = end.Format("2006-01-02")
+		params.TimeZoneOffset = offset
+	}
+
+	if params.Terms == "" && len(params.FromUsers) == 0 && len(params.InChannels) == 0 {
+		return nil, "", nil, newIntentError("search.no_filter", nil)
+	}
+	return params, teamID, nil, nil
+}
+
+// searchPosts runs the search in every team of the user, or only in the given one, and returns
+// the posts of the channels the user is a member of, the most recent first.
+func (p *Plugin) searchPosts(userID, teamID string, params *model.SearchParams) ([]*model.Post, error) {
+	memberships, err := p.getMemberships(userID)
+	if err != nil {
+		return nil, err
+	}
+	member := make(map[string]bool)
+	for _, m := range memberships {
+		member[m.Channel.Id] = true
+	}
+
+	teamIDs := []string{teamID}
+	if teamID == "" {
+		teams, appErr := p.API.GetTeamsForUser(userID)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to get teams")
+		}
+		teamIDs = teamIDs[:0]
+		for _, team := range teams {
+			teamIDs = append(teamIDs, team.Id)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var posts []*model.Post
+	for _, id := range teamIDs {
+		found, appErr := p.API.SearchPostsInTeam(id, []*model.SearchParams{params})
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to search posts")
+		}
+		// Plugins search on behalf of no one, so the results may come from any channel.
+		for _, post := range found {
+			if !member[post.ChannelId] || seen[post.Id] || post.DeleteAt != 0 || post.IsSystemMessage() {
+				continue
+			}
+			seen[post.Id] = true
+			posts = append(posts, post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreateAt > posts[j].CreateAt
+	})
+	return posts, nil
+}
+
+// handleSearchMessages searches the posts the user can read, as in "find messages from Carol
+// about the budget last week", and speaks the most recent results. Screens list every result,
+// and selecting one reads it in full.
+func (p *Plugin) handleSearchMessages(ctx *IntentContext) (*OutgoingResponse, error) {
+	now := time.Now().In(p.userLocation(ctx.UserID))
+	params, teamID, question, err := p.searchFilters(ctx, now)
+	if err != nil || question != nil {
+		return question, err
+	}
+	posts, err := p.searchPosts(ctx.UserID, teamID, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		ctx.Conversation.SearchResults = nil
+		return getResponseWithText(ctx.T("search.none")), nil
+	}
+	found := len(posts)
+	if len(posts) > maxSearchResults {
+		posts = posts[:maxSearchResults]
+	}
+
+	users := newUserCache(p, ctx.T)
+	channels := make(map[string]string)
+	channelName := func(channelID string) string {
+		name, ok := channels[channelID]
+		if !ok {
+			if channel, appErr := p.API.GetChannel(channelID); appErr == nil {
+				name = users.channelName(channel, ctx.UserID)
+			}
+			channels[channelID] = name
+		}
+		return name
+	}
+
+	ctx.Conversation.SearchResults = nil
+	messages := []string{ctx.T("search.found", found)}
+	var entries []gEntry
+	for i, post := range posts {
+		texts := vars{
+			"User":    users.displayName(post.UserId),
+			"Channel": channelName(post.ChannelId),
+			"When":    describeAgo(ctx.T, time.Unix(0, post.CreateAt*int64(time.Millisecond)), now),
+			"Message": trimWords(plainMessage(post.Message, users), maxMentionWords),
+		}
+		title := ctx.T("search.result_title", texts)
+		ctx.Conversation.SearchResults = append(ctx.Conversation.SearchResults, searchResult{PostID: post.Id, Name: title})
+		if i < p.postsPerTurn() {
+			messages = append(messages, ctx.T("search.result", texts))
+		}
+		entries = append(entries, gEntry{
+			Name:     post.Id,
+			Synonyms: synonyms(title),
+			Display:  &gEntryDisplay{Title: title, Description: texts["Message"].(string), Footer: texts["When"].(string)},
+		})
+	}
+	ctx.Conversation.LastPostID = posts[0].Id
+	if len(posts) > 1 {
+		messages = append(messages, ctx.T("search.say_read"))
+	}
+
+	// Lists need at least two items.
+	list := ctx.HasScreen() && len(entries) > 1
+	prompt := newPrompt().SayPaused(messages...)
+	if list {
+		prompt.List(ctx.T("search.list_title"), searchResultTypeName, entries)
+	}
+	response := prompt.Response()
+	if list {
+		response.Session.ID = ctx.Request.Session.ID
+	}
+	return response, nil
+}
+
+// handleReadSearchResult reads out in full the search result the user selected on screen or
+// named, by its position or its author and channel.
+func (p *Plugin) handleReadSearchResult(ctx *IntentContext) (*OutgoingResponse, error) {
+	results := ctx.Conversation.SearchResults
+	if len(results) == 0 {
+		return nil, newIntentError("search.no_results", nil)
+	}
+
+	spoken := ctx.Param("result")
+	postID := ""
+	for _, result := range results {
+		if result.PostID == spoken {
+			postID = result.PostID
+		}
+	}
+	if postID == "" {
+		options := make([]choiceOption, len(results))
+		for i, result := range results {
+			options[i] = choiceOption{ID: result.PostID, Name: result.Name}
+		}
+		option, ok := pickOption(ctx.T, spoken, options)
+		if !ok {
+			return nil, newIntentError("search.result_not_found", nil)
+		}
+		postID = option.ID
+	}
+
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		return nil, newIntentError("reading.deleted", appErr)
+	}
+	users := newUserCache(p, ctx.T)
+	channel, appErr := p.API.GetChannel(post.ChannelId)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get channel")
+	}
+	now := time.Now().In(p.userLocation(ctx.UserID))
+	ctx.Conversation.LastPostID = post.Id
+	return newPrompt().SayPaused(
+		ctx.T("search.full_intro", vars{
+			"Channel": users.channelName(channel, ctx.UserID),
+			"When":    describeAgo(ctx.T, time.Unix(0, post.CreateAt*int64(time.Millisecond)), now),
+		}),
+		describePost(post, users),
+	).Response(), nil
+}
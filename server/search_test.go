@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchMessages(t *testing.T) {
+	me := &model.User{Id: model.NewId(), Username: "me", Timezone: model.StringMap{"useAutomaticTimezone": "false", "manualTimezone": "UTC"}}
+	carol := &model.User{Id: model.NewId(), Username: "carol", FirstName: "Carol", LastName: "Jones"}
+	team := &model.Team{Id: model.NewId()}
+	town := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, TeamId: team.Id, Name: "town-square", DisplayName: "Town Square"}
+	finance := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_PRIVATE, TeamId: team.Id, Name: "finance", DisplayName: "Finance"}
+	secret := &model.Channel{Id: model.NewId(), Type: model.CHANNEL_PRIVATE, TeamId: team.Id, Name: "secret", DisplayName: "Secret"}
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetTeamsForUser", me.Id).Return([]*model.Team{team}, nil)
+	api.On("GetUsersInTeam", team.Id, 0, usersPerPage).Return([]*model.User{me, carol}, nil)
+	api.On("GetChannelMembersForUser", team.Id, me.Id, 0, channelMembersPerPage).Return([]*model.ChannelMember{
+		{ChannelId: town.Id}, {ChannelId: finance.Id},
+	}, nil)
+	api.On("GetChannelsForTeamForUser", team.Id, me.Id, false).Return([]*model.Channel{town, finance}, nil)
+	for _, c := range []*model.Channel{town, finance, secret} {
+		api.On("GetChannel", c.Id).Return(c, nil)
+	}
+	for _, u := range []*model.User{me, carol} {
+		api.On("GetUser", u.Id).Return(u, nil)
+	}
+
+	now := model.GetMillis()
+	posts := []*model.Post{
+		newTestPost(town.Id, carol.Id, "the budget is approved", now-3*int64(time.Hour/time.Millisecond)),
+		newTestPost(finance.Id, carol.Id, "budget numbers for Q3 are in the sheet, please check them before the review", now-5*int64(time.Minute/time.Millisecond)),
+		newTestPost(secret.Id, carol.Id, "the secret budget", now),
+	}
+	var searched []*model.SearchParams
+	api.On("SearchPostsInTeam", team.Id, mock.Anything).Return(func(teamID string, params []*model.SearchParams) []*model.Post {
+		searched = append(searched, params[0])
+		return posts
+	}, nil)
+	for _, post := range posts {
+		api.On("GetPost", post.Id).Return(post, nil)
+	}
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	c := &conversation{UserID: me.Id}
+	dispatch := func(handle intentFunc, name string, params map[string]interface{}) *OutgoingResponse {
+		req := newIntentRequest(name, params)
+		req.Device = gDevice{Capabilities: &[]string{"SPEECH", capabilityRichResponse}}
+		response, err := handle(&IntentContext{Request: req, UserID: me.Id, Conversation: c})
+		if iErr, ok := err.(*intentError); ok {
+			return getResponseWithText(translateError(iErr))
+		}
+		require.NoError(t, err)
+		return response
+	}
+
+	response := dispatch(p.handleSearchMessages, "search_messages", nil)
+	assert.Equal(t, "What should I search for? You can name words, who wrote the message, a channel or when.", speech(t, response))
+
+	response = dispatch(p.handleSearchMessages, "search_messages", map[string]interface{}{"terms": "budget", "from": "carol", "when": "this week"})
+	require.Len(t, searched, 1)
+	assert.Equal(t, "budget", searched[0].Terms)
+	assert.Equal(t, []string{"carol"}, searched[0].FromUsers)
+	assert.NotEmpty(t, searched[0].AfterDate)
+	assert.Equal(t, time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02"), searched[0].BeforeDate)
+	assert.Equal(t, `I found 2 messages.
+Carol Jones in Finance, 5 minutes ago: 'budget numbers for Q3 are in the sheet, please check them before the review'.
+Carol Jones in Town Square, 3 hours ago: 'the budget is approved'.
+Say read the first one to hear a message in full.`, displayText(t, response))
+	assert.Equal(t, posts[1].Id, c.LastPostID)
+
+	require.NotNil(t, response.Prompt.Content.List)
+	assert.Equal(t, []gListItem{{Key: posts[1].Id}, {Key: posts[0].Id}}, response.Prompt.Content.List.Items)
+	require.Len(t, response.Session.TypeOverrides, 1)
+	assert.Equal(t, searchResultTypeName, *response.Session.TypeOverrides[0].Name)
+	assert.Equal(t, "Carol Jones in Town Square", response.Session.TypeOverrides[0].Synonym.Entries[1].Display.Title)
+
+	t.Run("in a channel", func(t *testing.T) {
+		searched = nil
+		dispatch(p.handleSearchMessages, "search_messages", map[string]interface{}{"terms": "budget", "channel": "finance"})
+		require.Len(t, searched, 1)
+		assert.Equal(t, []string{"finance"}, searched[0].InChannels)
+	})
+
+	t.Run("read a result", func(t *testing.T) {
+		response := dispatch(p.handleReadSearchResult, "read_search_result", map[string]interface{}{"result": posts[0].Id})
+		assert.Equal(t, "In Town Square, 3 hours ago:\nCarol Jones wrote 'the budget is approved'.", displayText(t, response))
+		assert.Equal(t, posts[0].Id, c.LastPostID)
+
+		response = dispatch(p.handleReadSearchResult, "read_search_result", map[string]interface{}{"result": "the first one"})
+		assert.Contains(t, displayText(t, response), "In Finance, 5 minutes ago:")
+
+		response = dispatch(p.handleReadSearchResult, "read_search_result", map[string]interface{}{"result": "the one in finance"})
+		assert.Contains(t, displayText(t, response), "In Finance, 5 minutes ago:")
+	})
+
+	t.Run("no results", func(t *testing.T) {
+		posts = nil
+		response := dispatch(p.handleSearchMessages, "search_messages", map[string]interface{}{"terms": "holidays"})
+		assert.Equal(t, "I couldn't find any messages.", speech(t, response))
+		response = dispatch(p.handleReadSearchResult, "read_search_result", map[string]interface{}{"result": "first"})
+		assert.Equal(t, "There are no search results to read. Ask me to find messages first.", speech(t, response))
+	})
+}
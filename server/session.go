@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	conversationKeyPrefix = "session_"
+
+	// conversationTTL bounds how long the state of an idle Assistant session is kept.
+	conversationTTL = 30 * time.Minute
+)
+
+// conversation is the state kept across the turns of an Assistant session, keyed by session.id.
+type conversation struct {
+	// UserID is the Mattermost user the session belongs to. State is discarded if another user
+	// shows up with the same session ID.
+	UserID string `json:"user_id"`
+
+	// Reading is the cursor of the unread messages being read, if any.
+	Reading *readingState `json:"reading,omitempty"`
+
+	// LastPostID is the post that was read out last, which "reply" answers.
+	LastPostID string `json:"last_post_id,omitempty"`
+
+	// PendingAction is a write intent waiting for the user to confirm it, if any.
+	PendingAction *pendingAction `json:"pending_action,omitempty"`
+
+	// Choice is the question asked to resolve an ambiguous parameter, if any.
+	Choice *pendingChoice `json:"choice,omitempty"`
+
+	// SearchResults are the posts found by the last search, which the user may hear in full.
+	SearchResults []searchResult `json:"search_results,omitempty"`
+
+	// TypeOverridesSent records that the session already knows the user's people and channels.
+	TypeOverridesSent bool `json:"type_overrides_sent,omitempty"`
+
+	// MarkReadNoticeSent records that the user was told the posts read out stay unread, as no
+	// access token is set.
+	MarkReadNoticeSent bool `json:"mark_read_notice_sent,omitempty"`
+}
+
+func conversationKey(sessionID string) string {
+	return conversationKeyPrefix + hashToken(sessionID)
+}
+
+// loadConversation restores the state of the request's session for the user. Requests without
+// a session ID get a fresh state that is never stored.
+func (p *Plugin) loadConversation(req *IncomingRequest, userID string) (*conversation, []byte, error) {
+	c := &conversation{UserID: userID}
+	if req.Session.ID == nil || *req.Session.ID == "" {
+		return c, nil, nil
+	}
+
+	data, appErr := p.API.KVGet(conversationKey(*req.Session.ID))
+	if appErr != nil {
+		return nil, nil, errors.Wrap(appErr, "failed to get conversation")
+	}
+	if data == nil {
+		return c, nil, nil
+	}
+
+	var stored conversation
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to decode conversation")
+	}
+	if stored.UserID != userID {
+		return c, nil, nil
+	}
+	return &stored, data, nil
+}
+
+// saveConversation stores the state of the request's session unless it is unchanged.
+func (p *Plugin) saveConversation(req *IncomingRequest, c *conversation, old []byte) error {
+	if req.Session.ID == nil || *req.Session.ID == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode conversation")
+	}
+	if bytes.Equal(data, old) {
+		return nil
+	}
+	if appErr := p.API.KVSetWithExpiry(conversationKey(*req.Session.ID), data, int64(conversationTTL/time.Second)); appErr != nil {
+		return errors.Wrap(appErr, "failed to set conversation")
+	}
+	return nil
+}
+
+// withConversation provides intents that require a user with the state of their session, and
+// stores it once they are done.
+func (p *Plugin) withConversation(h IntentHandler, next intentFunc) intentFunc {
+	return func(ctx *IntentContext) (*OutgoingResponse, error) {
+		if !h.RequiresUser() {
+			return next(ctx)
+		}
+
+		c, old, err := p.loadConversation(ctx.Request, ctx.UserID)
+		if err != nil {
+			return nil, err
+		}
+		ctx.Conversation = c
+
+		response, err := next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.saveConversation(ctx.Request, c, old); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+}
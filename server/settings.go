@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const userSettingsKeyPrefix = "settings_"
+
+// userSettings are the preferences each user can change with /assistant settings.
+type userSettings struct {
+	// MarkAsRead marks posts as read once they have been read out. It defaults to on.
+	MarkAsRead *bool `json:"mark_as_read,omitempty"`
+
+	// SkipConfirmation lists the write intents that go ahead without asking the user first.
+	SkipConfirmation []string `json:"skip_confirmation,omitempty"`
+}
+
+func (s *userSettings) markAsRead() bool {
+	return s.MarkAsRead == nil || *s.MarkAsRead
+}
+
+// confirms reports whether the user wants to confirm the intent before it writes anything.
+func (s *userSettings) confirms(intentName string) bool {
+	for _, name := range s.SkipConfirmation {
+		if name == intentName {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *userSettings) setConfirms(intentName string, enabled bool) {
+	skip := s.SkipConfirmation[:0]
+	for _, name := range s.SkipConfirmation {
+		if name != intentName {
+			skip = append(skip, name)
+		}
+	}
+	if !enabled {
+		skip = append(skip, intentName)
+	}
+	s.SkipConfirmation = skip
+}
+
+// confirmSettingName is the name of the setting turning confirmations of an intent on or off.
+func confirmSettingName(intentName string) string {
+	return "confirm-" + strings.Replace(intentName, "_", "-", -1)
+}
+
+func (p *Plugin) getUserSettings(userID string) (*userSettings, error) {
+	settings := &userSettings{}
+	if _, err := p.kvGetJSON(userSettingsKeyPrefix+userID, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (p *Plugin) saveUserSettings(userID string, settings *userSettings) error {
+	return p.kvSetJSON(userSettingsKeyPrefix+userID, settings, 0)
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// describeSettings lists the user's settings for /assistant settings, along with the
+// confirmation of each of the write intents.
+func describeSettings(settings *userSettings, writeIntents []string) string {
+	lines := []string{
+		"Your Google Assistant settings:",
+		fmt.Sprintf("* `mark-read`: %s. Mark messages as read once they have been read out.", onOff(settings.markAsRead())),
+	}
+	for _, intentName := range writeIntents {
+		lines = append(lines, fmt.Sprintf("* `%s`: %s. Ask before doing %s.",
+			confirmSettingName(intentName), onOff(settings.confirms(intentName)), strings.Replace(intentName, "_", " ", -1)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// updateSetting changes a single setting from its name and an on/off value.
+func updateSetting(settings *userSettings, writeIntents []string, name, value string) error {
+	var enabled bool
+	switch value {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		return errors.Errorf("`%s` must be either `on` or `off`", name)
+	}
+
+	if name == "mark-read" {
+		settings.MarkAsRead = &enabled
+		return nil
+	}
+	for _, intentName := range writeIntents {
+		if name == confirmSettingName(intentName) {
+			settings.setConfirms(intentName, enabled)
+			return nil
+		}
+	}
+	return errors.Errorf("unknown setting `%s`", name)
+}
+
+// executeSettingsCommand shows the user's settings, or changes one with
+// `/assistant settings <name> <on|off>`.
+func (p *Plugin) executeSettingsCommand(userID string, args []string) (*model.CommandResponse, *model.AppError) {
+	writeIntents := p.intents.WriteIntents()
+	settings, err := p.getUserSettings(userID)
+	if err != nil {
+		p.API.LogError("Cannot get settings", "err", err.Error())
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Failed to get your settings, please try again.",
+		}, nil
+	}
+
+	if len(args) == 0 {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         describeSettings(settings, writeIntents),
+		}, nil
+	}
+	if len(args) != 2 {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Usage: `/assistant settings <name> <on|off>`",
+		}, nil
+	}
+
+	if err := updateSetting(settings, writeIntents, args[0], args[1]); err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         fmt.Sprintf("Sorry, %s.", err.Error()),
+		}, nil
+	}
+	if err := p.saveUserSettings(userID, settings); err != nil {
+		p.API.LogError("Cannot save settings", "err", err.Error())
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			Text:         "Failed to save your settings, please try again.",
+		}, nil
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         describeSettings(settings, writeIntents),
+	}, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// signatureHeader carries the JWT Google attaches to every fulfillment request.
+	signatureHeader = "Google-Assistant-Signature"
+
+	googleIssuer   = "https://accounts.google.com"
+	defaultJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+	// defaultKeySetTTL is used when the key set response carries no max-age.
+	defaultKeySetTTL = time.Hour
+
+	// minKeySetRefresh limits how often an unknown key ID may trigger a refetch.
+	minKeySetRefresh = time.Minute
+)
+
+var maxAgeRegexp = regexp.MustCompile(`max-age=(\d+)`)
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// parseKeySet decodes the RSA keys of a JSON Web Key Set, indexed by key ID.
+func parseKeySet(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set jsonWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errors.Wrap(err, "failed to decode key set")
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid modulus for key %q", key.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid exponent for key %q", key.Kid)
+		}
+		keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("key set contains no RSA keys")
+	}
+
+	return keys, nil
+}
+
+// keySetCache holds the signing keys fetched from a remote JWKS endpoint.
+type keySetCache struct {
+	lock      sync.Mutex
+	url       string
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	expiresAt time.Time
+}
+
+// get returns the key with the given ID, fetching the key set from url when the cached copy is
+// stale, was fetched from another url or does not know the key.
+func (c *keySetCache) get(url, kid string) (*rsa.PublicKey, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	key, ok := c.keys[kid]
+	fresh := c.url == url && now.Before(c.expiresAt)
+	if ok && fresh {
+		return key, nil
+	}
+	if fresh && now.Sub(c.fetchedAt) < minKeySetRefresh {
+		return nil, errors.Errorf("unknown signing key %q", kid)
+	}
+
+	if err := c.fetch(url); err != nil {
+		return nil, err
+	}
+
+	key, ok = c.keys[kid]
+	if !ok {
+		return nil, errors.Errorf("unknown signing key %q", kid)
+	}
+
+	return key, nil
+}
+
+func (c *keySetCache) fetch(url string) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch signing keys")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("failed to fetch signing keys: %s", resp.Status)
+	}
+
+	var set json.RawMessage
+	if err = json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return errors.Wrap(err, "failed to decode signing keys")
+	}
+	keys, err := parseKeySet(set)
+	if err != nil {
+		return err
+	}
+
+	ttl := defaultKeySetTTL
+	if m := maxAgeRegexp.FindStringSubmatch(resp.Header.Get("Cache-Control")); m != nil {
+		if seconds, err := strconv.Atoi(m[1]); err == nil {
+			ttl = time.Duration(seconds) * time.Second
+		}
+	}
+
+	now := time.Now()
+	c.url = url
+	c.keys = keys
+	c.fetchedAt = now
+	c.expiresAt = now.Add(ttl)
+
+	return nil
+}
+
+// signingKey resolves the public key a fulfillment request was signed with. Keys configured
+// inline take precedence over the remote key set.
+func (p *Plugin) signingKey(conf *configuration, kid string) (*rsa.PublicKey, error) {
+	if conf.signingKeys != nil {
+		key, ok := conf.signingKeys[kid]
+		if !ok {
+			return nil, errors.Errorf("unknown signing key %q", kid)
+		}
+		return key, nil
+	}
+
+	url := conf.JWKSURL
+	if url == "" {
+		url = defaultJWKSURL
+	}
+
+	return p.keySet.get(url, kid)
+}
+
+// verifySignature checks that the request carries a valid Google-Assistant-Signature issued by
+// Google for the configured Actions project.
+func (p *Plugin) verifySignature(r *http.Request) error {
+	conf := p.getConfiguration()
+	if conf.ProjectID == "" {
+		return errors.New("no Actions project ID configured")
+	}
+
+	token := r.Header.Get(signatureHeader)
+	if token == "" {
+		return errors.New("missing signature")
+	}
+
+	claims := &jwt.StandardClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.signingKey(conf, kid)
+	})
+	if err != nil {
+		return errors.Wrap(err, "invalid signature")
+	}
+
+	if claims.ExpiresAt == 0 {
+		return errors.New("signature has no expiry")
+	}
+	if !claims.VerifyIssuer(googleIssuer, true) {
+		return errors.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if !claims.VerifyAudience(conf.ProjectID, true) {
+		return errors.Errorf("unexpected audience %q", claims.Audience)
+	}
+
+	return nil
+}
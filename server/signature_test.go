@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testProjectID = "mattermost-test"
+
+type testSigner struct {
+	kid  string
+	key  *rsa.PrivateKey
+	jwks string
+}
+
+func newTestSigner(t *testing.T, kid string) *testSigner {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	set := jsonWebKeySet{Keys: []jsonWebKey{{
+		Kty: "RSA",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	jwks, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	return &testSigner{kid: kid, key: key, jwks: string(jwks)}
+}
+
+func (s *testSigner) sign(t *testing.T, claims jwt.StandardClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func validClaims() jwt.StandardClaims {
+	return jwt.StandardClaims{
+		Issuer:    googleIssuer,
+		Audience:  testProjectID,
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func newSignedRequest(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	if token != "" {
+		r.Header.Set(signatureHeader, token)
+	}
+	return r
+}
+
+func TestVerifySignature(t *testing.T) {
+	signer := newTestSigner(t, "key-1")
+	keys, err := parseKeySet([]byte(signer.jwks))
+	require.NoError(t, err)
+
+	p := &Plugin{}
+	p.setConfiguration(&configuration{ProjectID: testProjectID, signingKeys: keys})
+
+	t.Run("valid", func(t *testing.T) {
+		assert.NoError(t, p.verifySignature(newSignedRequest(signer.sign(t, validClaims()))))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		assert.Error(t, p.verifySignature(newSignedRequest("")))
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		claims := validClaims()
+		claims.Audience = "someone-else"
+		assert.Error(t, p.verifySignature(newSignedRequest(signer.sign(t, claims))))
+	})
+
+	t.Run("wrong issuer", func(t *testing.T) {
+		claims := validClaims()
+		claims.Issuer = "https://example.com"
+		assert.Error(t, p.verifySignature(newSignedRequest(signer.sign(t, claims))))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		claims := validClaims()
+		claims.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+		assert.Error(t, p.verifySignature(newSignedRequest(signer.sign(t, claims))))
+	})
+
+	t.Run("no expiry", func(t *testing.T) {
+		claims := validClaims()
+		claims.ExpiresAt = 0
+		assert.Error(t, p.verifySignature(newSignedRequest(signer.sign(t, claims))))
+	})
+
+	t.Run("forged", func(t *testing.T) {
+		forger := newTestSigner(t, "key-1")
+		assert.Error(t, p.verifySignature(newSignedRequest(forger.sign(t, validClaims()))))
+	})
+
+	t.Run("no project configured", func(t *testing.T) {
+		unconfigured := &Plugin{}
+		assert.Error(t, unconfigured.verifySignature(newSignedRequest(signer.sign(t, validClaims()))))
+	})
+}
+
+func TestVerifySignatureRemoteKeySet(t *testing.T) {
+	signer := newTestSigner(t, "key-1")
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		fmt.Fprint(w, signer.jwks)
+	}))
+	defer server.Close()
+
+	p := &Plugin{}
+	p.setConfiguration(&configuration{ProjectID: testProjectID, JWKSURL: server.URL})
+
+	assert.NoError(t, p.verifySignature(newSignedRequest(signer.sign(t, validClaims()))))
+	assert.NoError(t, p.verifySignature(newSignedRequest(signer.sign(t, validClaims()))))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	unknown := newTestSigner(t, "key-2")
+	assert.Error(t, p.verifySignature(newSignedRequest(unknown.sign(t, validClaims()))))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches), "unknown keys should not refetch within the refresh interval")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/mattermost/go-i18n/i18n/bundle"
+)
+
+// sentencePause is the pause between the sentences of SSML speech, such as between messages.
+const sentencePause = `<break time="500ms"/>`
+
+var (
+	codeBlockPattern  = regexp.MustCompile("(?s)```([\\w+#-]*)[^\\n]*\\n?(.*?)(?:```|$)")
+	inlineCodePattern = regexp.MustCompile("`([^`]*)`")
+	imagePattern      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	linkPattern       = regexp.MustCompile(`\[([^\]]*)\]\(([^)]*)\)`)
+	autolinkPattern   = regexp.MustCompile(`<(https?://[^>\s]+)>`)
+	urlPattern        = regexp.MustCompile(`https?://[^\s<>()]+`)
+	mentionPattern    = regexp.MustCompile(`(^|[^\w@])@([a-zA-Z0-9][a-zA-Z0-9._-]*)`)
+	emojiPattern      = regexp.MustCompile(`(^|[^\w:]):([a-z0-9_+-]+):`)
+	strongPattern     = regexp.MustCompile(`\*\*|__|~~`)
+	emphasisPattern   = regexp.MustCompile(`(^|[^\w*])[*_]([^*_\s](?:[^*_\n]*[^*_\s])?)[*_]($|[^\w*])`)
+	blockPattern      = regexp.MustCompile(`(?m)^\s{0,3}(?:#{1,6}\s+|>\s?|[-*+]\s+|\d+[.)]\s+)`)
+	spacePattern      = regexp.MustCompile(`\s+`)
+)
+
+// emojiNames are the spoken names of emoji whose shortcode does not say them well.
+var emojiNames = map[string]string{
+	"+1":         "thumbs up",
+	"-1":         "thumbs down",
+	"thumbsup":   "thumbs up",
+	"thumbsdown": "thumbs down",
+	"100":        "hundred points",
+}
+
+// specialMentions are the translations of the spoken names of the mentions that notify a whole
+// channel.
+var specialMentions = map[string]string{
+	"all":     "speech.mention_all",
+	"channel": "speech.mention_channel",
+	"here":    "speech.mention_here",
+}
+
+// linkName describes a link by its domain, as URLs are no fun to listen to.
+func linkName(T bundle.TranslateFunc, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return T("speech.link")
+	}
+	return T("speech.link_to", vars{"Domain": strings.TrimPrefix(u.Hostname(), "www.")})
+}
+
+// codeSummary describes a code block rather than reading it.
+func codeSummary(T bundle.TranslateFunc, language, code string) string {
+	lines := len(strings.Split(strings.TrimRight(code, "\n"), "\n"))
+	if language == "" {
+		return " " + T("speech.code", lines) + " "
+	}
+	return " " + T("speech.code_language", lines, vars{"Language": language}) + " "
+}
+
+// plainMessage turns the markdown of a post into plain text that reads well aloud: formatting is
+// dropped, links are named by their domain, code blocks are summed up, emoji are named and
+// mentions are replaced by the display names of the users.
+func plainMessage(message string, users *userCache) string {
+	s := codeBlockPattern.ReplaceAllStringFunc(message, func(block string) string {
+		m := codeBlockPattern.FindStringSubmatch(block)
+		return codeSummary(users.T, m[1], m[2])
+	})
+	s = inlineCodePattern.ReplaceAllString(s, "$1")
+	s = imagePattern.ReplaceAllStringFunc(s, func(image string) string {
+		if alt := imagePattern.FindStringSubmatch(image)[1]; alt != "" {
+			return users.T("speech.image_of", vars{"Alt": alt})
+		}
+		return users.T("speech.image")
+	})
+	s = linkPattern.ReplaceAllStringFunc(s, func(link string) string {
+		m := linkPattern.FindStringSubmatch(link)
+		if strings.TrimSpace(m[1]) != "" {
+			return m[1]
+		}
+		return linkName(users.T, m[2])
+	})
+	s = autolinkPattern.ReplaceAllString(s, "$1")
+	s = urlPattern.ReplaceAllStringFunc(s, func(rawURL string) string {
+		return linkName(users.T, rawURL)
+	})
+	s = mentionPattern.ReplaceAllStringFunc(s, func(mention string) string {
+		m := mentionPattern.FindStringSubmatch(mention)
+		return m[1] + users.mentionName(m[2])
+	})
+	s = emojiPattern.ReplaceAllStringFunc(s, func(emoji string) string {
+		m := emojiPattern.FindStringSubmatch(emoji)
+		if name, ok := emojiNames[m[2]]; ok {
+			return m[1] + name
+		}
+		return m[1] + strings.Replace(m[2], "_", " ", -1)
+	})
+	s = blockPattern.ReplaceAllString(s, "")
+	s = strongPattern.ReplaceAllString(s, "")
+	// Matches share the characters around them, so neighboring emphasis takes a second pass.
+	for i := 0; i < 2; i++ {
+		s = emphasisPattern.ReplaceAllString(s, "$1$2$3")
+	}
+	return strings.TrimSpace(spacePattern.ReplaceAllString(s, " "))
+}
+
+var ssmlEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&apos;",
+)
+
+// escapeSSML escapes the characters SSML reserves.
+func escapeSSML(s string) string {
+	return ssmlEscaper.Replace(s)
+}
+
+// pausedSSML speaks plain text sentences with a pause between each.
+func pausedSSML(sentences []string) string {
+	escaped := make([]string, len(sentences))
+	for i, sentence := range sentences {
+		escaped[i] = escapeSSML(sentence)
+	}
+	return "<speak>" + strings.Join(escaped, sentencePause) + "</speak>"
+}
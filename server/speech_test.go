@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlainMessage(t *testing.T) {
+	alice := &model.User{Id: model.NewId(), Username: "alice.smith", FirstName: "Alice", LastName: "Smith"}
+	api := &plugintest.API{}
+	api.On("GetUserByUsername", alice.Username).Return(alice, nil)
+	api.On("GetUserByUsername", mock.Anything).Return(nil, &model.AppError{Message: "not found"})
+
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	for message, expected := range map[string]string{
+		"plain text": "plain text",
+		"**bold**, _italic_ and ~~struck~~ *words*":   "bold, italic and struck words",
+		"snake_case_name and 2 * 3 * 4":               "snake_case_name and 2 * 3 * 4",
+		"see [the docs](https://docs.mattermost.com)": "see the docs",
+		"go to https://www.example.com/a/b?c=d now":   "go to a link to example.com now",
+		"<https://github.com/mattermost>":             "a link to github.com",
+		"![diagram](https://example.com/d.png)":       "an image of diagram",
+		"run `make test` first":                       "run make test first",
+		"```go\nfunc main() {\n}\n```\nthoughts?":     "a go code snippet of 2 lines thoughts?",
+		"```\nls\n```":                              "a code snippet",
+		"ship it :+1: :white_check_mark:":           "ship it thumbs up white check mark",
+		"meet at 10:30:00":                          "meet at 10:30:00",
+		"ping @alice.smith.":                        "ping Alice Smith.",
+		"@here and @nobody, mail bob@example.com":   "everyone online and nobody, mail bob@example.com",
+		"# Title\n> quoted\n- one\n- two\n1. first": "Title quoted one two first",
+	} {
+		assert.Equal(t, expected, plainMessage(message, newUserCache(p, translator())), message)
+	}
+}
+
+func TestPausedSSML(t *testing.T) {
+	assert.Equal(t, `<speak>Tom &amp; Jerry say &quot;hi&quot; &lt;3`+sentencePause+`Bob wrote &apos;ok&apos;.</speak>`,
+		pausedSSML([]string{`Tom & Jerry say "hi" <3`, "Bob wrote 'ok'."}))
+}
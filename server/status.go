@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	restoreStatusTask     = "restore_status"
+	clearCustomStatusTask = "clear_custom_status"
+
+	// customStatusProp is the user prop the webapp reads the custom status from.
+	customStatusProp         = "customStatus"
+	defaultCustomStatusEmoji = "speech_balloon"
+)
+
+// spokenStatuses maps the ways a status may be said to the Mattermost status.
+var spokenStatuses = map[string]string{
+	"online":         model.STATUS_ONLINE,
+	"available":      model.STATUS_ONLINE,
+	"away":           model.STATUS_AWAY,
+	"dnd":            model.STATUS_DND,
+	"do not disturb": model.STATUS_DND,
+	"offline":        model.STATUS_OFFLINE,
+}
+
+// parseStatus returns the Mattermost status the user asked for, if it is one.
+func parseStatus(spoken string) (string, bool) {
+	status, ok := spokenStatuses[strings.Join(strings.Fields(strings.ToLower(spoken)), " ")]
+	return status, ok
+}
+
+// statusName returns how a Mattermost status is spoken, or the status itself if it has no
+// translation.
+func statusName(ctx *IntentContext, status string) string {
+	id := "status." + status
+	if name := ctx.T(id); name != id {
+		return name
+	}
+	return status
+}
+
+// untilParam returns the time given by the "until" parameter in the user's time zone, or the
+// zero time if there is none.
+func (p *Plugin) untilParam(ctx *IntentContext) (time.Time, error) {
+	if !ctx.HasParam("until") {
+		return time.Time{}, nil
+	}
+	spoken := ctx.Param("until")
+	until, ok := parseTime(spoken, time.Now().In(p.userLocation(ctx.UserID)))
+	if !ok {
+		return time.Time{}, newIntentError("time.not_understood", nil, vars{"Time": spoken})
+	}
+	return until, nil
+}
+
+// statusTaskID is the ID of the task restoring the status of the user. Task IDs are kept short
+// for their keys to fit the KV store.
+func statusTaskID(userID string) string {
+	return "rs_" + userID
+}
+
+// statusRestore is the data of the task restoring the status a user had before setting one
+// that expires.
+type statusRestore struct {
+	// Status is the status that expires, which is only replaced if the user kept it.
+	Status   string `json:"status"`
+	Previous string `json:"previous"`
+}
+
+// changeStatus sets the status of the user, until the time of the "until" parameter if any.
+func (p *Plugin) changeStatus(ctx *IntentContext, status string) (*OutgoingResponse, error) {
+	until, err := p.untilParam(ctx)
+	if err != nil {
+		return nil, err
+	}
+	oldStatus, appErr := p.API.GetUserStatus(ctx.UserID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get status")
+	}
+
+	statuses := vars{"Old": statusName(ctx, oldStatus.Status), "New": statusName(ctx, status)}
+	confirmID, doneID := "status.confirm", "status.changed"
+	if !until.IsZero() {
+		statuses["Until"] = describeTime(ctx.T, until, time.Now().In(until.Location()))
+		confirmID, doneID = "status.confirm_until", "status.changed_until"
+	}
+	if question := ctx.confirm(ctx.T(confirmID, statuses)); question != nil {
+		return question, nil
+	}
+
+	// Changing an expiring status again keeps the status to go back to.
+	previous := oldStatus.Status
+	task, err := p.getTask(statusTaskID(ctx.UserID))
+	if err != nil {
+		return nil, err
+	}
+	if task != nil {
+		var restore statusRestore
+		if json.Unmarshal(task.Data, &restore) == nil && restore.Status == oldStatus.Status {
+			previous = restore.Previous
+		}
+	}
+
+	if _, appErr := p.API.UpdateUserStatus(ctx.UserID, status); appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to update status")
+	}
+	if until.IsZero() {
+		err = p.unschedule(statusTaskID(ctx.UserID))
+	} else {
+		err = p.scheduleAt(statusTaskID(ctx.UserID), restoreStatusTask, ctx.UserID, until, statusRestore{Status: status, Previous: previous})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return getResponseWithText(ctx.T(doneID, statuses)), nil
+}
+
+// handleSetDND turns on Do Not Disturb, for a while if the user said until when.
+func (p *Plugin) handleSetDND(ctx *IntentContext) (*OutgoingResponse, error) {
+	return p.changeStatus(ctx, model.STATUS_DND)
+}
+
+// restoreStatus puts back the status a user had before their status expired, unless they
+// changed it since.
+func (p *Plugin) restoreStatus(task *scheduledTask) error {
+	var restore statusRestore
+	if err := json.Unmarshal(task.Data, &restore); err != nil {
+		return errors.Wrap(err, "failed to decode status")
+	}
+	current, appErr := p.API.GetUserStatus(task.UserID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get status")
+	}
+	if current.Status != restore.Status {
+		return nil
+	}
+	if _, appErr := p.API.UpdateUserStatus(task.UserID, restore.Previous); appErr != nil {
+		return errors.Wrap(appErr, "failed to update status")
+	}
+	return nil
+}
+
+// customStatus is a status message shown next to the user's name, stored the way the webapp
+// expects it in the user's props.
+type customStatus struct {
+	Emoji     string `json:"emoji"`
+	Text      string `json:"text"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+func getCustomStatus(u *model.User) *customStatus {
+	data, ok := u.Props[customStatusProp]
+	if !ok || data == "" {
+		return nil
+	}
+	var cs customStatus
+	if err := json.Unmarshal([]byte(data), &cs); err != nil {
+		return nil
+	}
+	return &cs
+}
+
+// setCustomStatus stores the custom status of the user, clearing it if cs is nil.
+func (p *Plugin) setCustomStatus(u *model.User, cs *customStatus) error {
+	if cs == nil {
+		delete(u.Props, customStatusProp)
+	} else {
+		data, err := json.Marshal(cs)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode custom status")
+		}
+		if u.Props == nil {
+			u.Props = model.StringMap{}
+		}
+		u.Props[customStatusProp] = string(data)
+	}
+	if _, appErr := p.API.UpdateUser(u); appErr != nil {
+		return errors.Wrap(appErr, "failed to update user")
+	}
+	return nil
+}
+
+// customStatusTaskID is the ID of the task clearing the custom status of the user.
+func customStatusTaskID(userID string) string {
+	return "ccs_" + userID
+}
+
+// emojiName turns a spoken emoji such as "palm tree" into its name, if Mattermost knows it.
+func emojiName(spoken string) (string, bool) {
+	name := strings.Join(strings.Fields(strings.ToLower(strings.Trim(spoken, ": "))), "_")
+	if _, ok := model.GetSystemEmojiId(name); !ok {
+		return "", false
+	}
+	return name, true
+}
+
+// handleSetCustomStatus sets the custom status text of the user, with an emoji and until a
+// given time if they said so.
+func (p *Plugin) handleSetCustomStatus(ctx *IntentContext) (*OutgoingResponse, error) {
+	cs := &customStatus{Emoji: defaultCustomStatusEmoji, Text: ctx.Param("text")}
+	if ctx.HasParam("emoji") {
+		emoji, ok := emojiName(ctx.Param("emoji"))
+		if !ok {
+			return nil, newIntentError("custom_status.unknown_emoji", nil, vars{"Emoji": ctx.Param("emoji")})
+		}
+		cs.Emoji = emoji
+	}
+	until, err := p.untilParam(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmID, doneID := "custom_status.confirm", "custom_status.set"
+	texts := vars{"Text": cs.Text}
+	if !until.IsZero() {
+		cs.ExpiresAt = until.UTC().Format(time.RFC3339)
+		texts["Until"] = describeTime(ctx.T, until, time.Now().In(until.Location()))
+		confirmID, doneID = "custom_status.confirm_until", "custom_status.set_until"
+	}
+	if question := ctx.confirm(ctx.T(confirmID, texts)); question != nil {
+		return question, nil
+	}
+
+	u, appErr := p.API.GetUser(ctx.UserID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get user")
+	}
+	if err := p.setCustomStatus(u, cs); err != nil {
+		return nil, err
+	}
+	if until.IsZero() {
+		err = p.unschedule(customStatusTaskID(ctx.UserID))
+	} else {
+		err = p.scheduleAt(customStatusTaskID(ctx.UserID), clearCustomStatusTask, ctx.UserID, until, cs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return getResponseWithText(ctx.T(doneID, texts)), nil
+}
+
+// handleClearCustomStatus removes the custom status of the user.
+func (p *Plugin) handleClearCustomStatus(ctx *IntentContext) (*OutgoingResponse, error) {
+	u, appErr := p.API.GetUser(ctx.UserID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get user")
+	}
+	if getCustomStatus(u) == nil {
+		return getResponseWithText(ctx.T("custom_status.none")), nil
+	}
+	if question := ctx.confirm(ctx.T("custom_status.confirm_clear")); question != nil {
+		return question, nil
+	}
+	if err := p.setCustomStatus(u, nil); err != nil {
+		return nil, err
+	}
+	if err := p.unschedule(customStatusTaskID(ctx.UserID)); err != nil {
+		return nil, err
+	}
+	return getResponseWithText(ctx.T("custom_status.cleared")), nil
+}
+
+// clearExpiredCustomStatus clears a custom status once it expired, unless the user changed it
+// since.
+func (p *Plugin) clearExpiredCustomStatus(task *scheduledTask) error {
+	var expired customStatus
+	if err := json.Unmarshal(task.Data, &expired); err != nil {
+		return errors.Wrap(err, "failed to decode custom status")
+	}
+	u, appErr := p.API.GetUser(task.UserID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get user")
+	}
+	if current := getCustomStatus(u); current == nil || *current != expired {
+		return nil
+	}
+	return p.setCustomStatus(u, nil)
+}
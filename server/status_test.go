@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStatusTestPlugin() (*Plugin, *model.User, *model.Status) {
+	u := &model.User{Id: model.NewId(), Timezone: model.StringMap{"useAutomaticTimezone": "false", "manualTimezone": "UTC"}}
+	status := &model.Status{UserId: u.Id, Status: model.STATUS_ONLINE}
+
+	api := &plugintest.API{}
+	newMemKV(api)
+	api.On("GetUser", u.Id).Return(u, nil)
+	api.On("GetUserStatus", u.Id).Return(status, nil)
+	api.On("UpdateUserStatus", u.Id, mock.Anything).Return(func(userID, s string) *model.Status {
+		status.Status = s
+		return status
+	}, nil)
+	api.On("UpdateUser", u).Return(u, nil)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.registerTasks()
+	return p, u, status
+}
+
+func TestHandleStatusChange(t *testing.T) {
+	p, u, status := newStatusTestPlugin()
+	change := func(params map[string]interface{}) (*OutgoingResponse, error) {
+		return p.handleStatusChange(&IntentContext{Request: newIntentRequest("change_status", params), UserID: u.Id, Conversation: &conversation{UserID: u.Id}})
+	}
+
+	t.Run("unknown status", func(t *testing.T) {
+		_, err := change(map[string]interface{}{"status": "sleeping"})
+		require.IsType(t, &intentError{}, err)
+		assert.Equal(t, "Sorry, I can only set your status to online, away, do not disturb or offline.", translateError(err))
+		assert.Equal(t, model.STATUS_ONLINE, status.Status)
+	})
+
+	t.Run("spoken status", func(t *testing.T) {
+		response, err := change(map[string]interface{}{"status": "Do not Disturb"})
+		require.NoError(t, err)
+		assert.Equal(t, "Changing status from online to do not disturb", speech(t, response))
+		assert.Equal(t, model.STATUS_DND, status.Status)
+	})
+
+	t.Run("unknown time", func(t *testing.T) {
+		_, err := change(map[string]interface{}{"status": "away", "until": "a while"})
+		require.IsType(t, &intentError{}, err)
+		assert.Equal(t, "Sorry, I didn't understand when 'a while' is.", translateError(err))
+	})
+}
+
+func TestHandleSetDND(t *testing.T) {
+	p, u, status := newStatusTestPlugin()
+	setDND := func(until string) string {
+		ctx := &IntentContext{Request: newIntentRequest("set_dnd", map[string]interface{}{"until": until}), UserID: u.Id, Conversation: &conversation{UserID: u.Id}}
+		response, err := p.handleSetDND(ctx)
+		require.NoError(t, err)
+		return speech(t, response)
+	}
+
+	assert.Contains(t, setDND("for 2 hours"), "Changing status from online to do not disturb until ")
+	assert.Equal(t, model.STATUS_DND, status.Status)
+
+	// Extending it still goes back to online afterwards.
+	setDND("for 3 hours")
+	p.runDueTasks(time.Now().Add(2*time.Hour + time.Minute))
+	assert.Equal(t, model.STATUS_DND, status.Status)
+	p.runDueTasks(time.Now().Add(3*time.Hour + time.Minute))
+	assert.Equal(t, model.STATUS_ONLINE, status.Status)
+
+	t.Run("status changed meanwhile is kept", func(t *testing.T) {
+		setDND("for an hour")
+		status.Status = model.STATUS_AWAY
+		p.runDueTasks(time.Now().Add(2 * time.Hour))
+		assert.Equal(t, model.STATUS_AWAY, status.Status)
+	})
+}
+
+func TestHandleCustomStatus(t *testing.T) {
+	p, u, _ := newStatusTestPlugin()
+	ctx := func(name string, params map[string]interface{}) *IntentContext {
+		return &IntentContext{Request: newIntentRequest(name, params), UserID: u.Id, Conversation: &conversation{UserID: u.Id}}
+	}
+
+	t.Run("unknown emoji", func(t *testing.T) {
+		_, err := p.handleSetCustomStatus(ctx("set_custom_status", map[string]interface{}{"text": "On vacation", "emoji": "no such thing"}))
+		require.IsType(t, &intentError{}, err)
+		assert.Nil(t, getCustomStatus(u))
+	})
+
+	t.Run("set and expire", func(t *testing.T) {
+		response, err := p.handleSetCustomStatus(ctx("set_custom_status", map[string]interface{}{"text": "On vacation", "emoji": "Palm Tree", "until": "for 2 hours"}))
+		require.NoError(t, err)
+		assert.Contains(t, speech(t, response), "Your custom status is now 'On vacation' until ")
+		cs := getCustomStatus(u)
+		require.NotNil(t, cs)
+		assert.Equal(t, "palm_tree", cs.Emoji)
+		assert.Equal(t, "On vacation", cs.Text)
+		assert.NotEmpty(t, cs.ExpiresAt)
+
+		p.runDueTasks(time.Now().Add(3 * time.Hour))
+		assert.Nil(t, getCustomStatus(u))
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		response, err := p.handleClearCustomStatus(ctx("clear_custom_status", nil))
+		require.NoError(t, err)
+		assert.Equal(t, "You have no custom status.", speech(t, response))
+
+		_, err = p.handleSetCustomStatus(ctx("set_custom_status", map[string]interface{}{"text": "Lunch", "until": "for an hour"}))
+		require.NoError(t, err)
+		assert.Equal(t, defaultCustomStatusEmoji, getCustomStatus(u).Emoji)
+
+		response, err = p.handleClearCustomStatus(ctx("clear_custom_status", nil))
+		require.NoError(t, err)
+		assert.Equal(t, "Custom status cleared.", speech(t, response))
+		assert.Nil(t, getCustomStatus(u))
+		task, err := p.getTask(customStatusTaskID(u.Id))
+		require.NoError(t, err)
+		assert.Nil(t, task)
+	})
+}
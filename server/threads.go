@@ -0,0 +1,622 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// Servers with collapsed reply threads, 5.29 and later, keep which threads each user follows
+// and how far they read them, and offer it through the REST API only. Older servers, or ones
+// with collapsed reply threads turned off, know nothing of followed threads: the plugin then
+// groups unread replies by their root post, takes threads the user took part in as followed,
+// and remembers what they followed, unfollowed and read by voice itself.
+
+// threadsKeyPrefix keys the threads a user followed, unfollowed or read by voice on servers
+// without the thread API.
+const threadsKeyPrefix = "threads_"
+
+// errNoThreadAPI is returned when the server does not offer the thread API.
+var errNoThreadAPI = errors.New("thread API not available")
+
+// threadPrefs is what the plugin remembers of a user's threads on servers without the thread
+// API, by root post ID.
+type threadPrefs struct {
+	// Following holds the threads the user followed or unfollowed by voice.
+	Following map[string]bool `json:"following,omitempty"`
+
+	// ReadAt holds when the last reply read out of each thread was created.
+	ReadAt map[string]int64 `json:"read_at,omitempty"`
+}
+
+// userThread is a followed thread as returned by the thread API.
+type userThread struct {
+	PostID       string `json:"id"`
+	LastReplyAt  int64  `json:"last_reply_at"`
+	LastViewedAt int64  `json:"last_viewed_at"`
+}
+
+type userThreads struct {
+	Threads []*userThread `json:"threads"`
+}
+
+// followedThread is a thread the user follows with replies they have not read.
+type followedThread struct {
+	Root    *model.Post
+	Replies []*model.Post
+
+	// Since is when the user last read the thread, the replies being the ones after it.
+	Since int64
+}
+
+// lastReplyAt returns when the thread was last replied to.
+func (t *followedThread) lastReplyAt() int64 {
+	return t.Replies[len(t.Replies)-1].CreateAt
+}
+
+func threadsKey(userID string) string {
+	return threadsKeyPrefix + userID
+}
+
+func (p *Plugin) getThreadPrefs(userID string) (*threadPrefs, error) {
+	prefs := &threadPrefs{}
+	if _, err := p.kvGetJSON(threadsKey(userID), prefs); err != nil {
+		return nil, err
+	}
+	if prefs.Following == nil {
+		prefs.Following = make(map[string]bool)
+	}
+	if prefs.ReadAt == nil {
+		prefs.ReadAt = make(map[string]int64)
+	}
+	return prefs, nil
+}
+
+// threadRoute returns the route of the user's threads in a team, or of one of them.
+func threadRoute(client *model.Client4, userID, teamID, rootID string) string {
+	route := client.GetUserRoute(userID) + "/teams/" + teamID + "/threads"
+	if rootID != "" {
+		route += "/" + rootID
+	}
+	return route
+}
+
+// threadAPIError converts a failed call of the thread API into an error, errNoThreadAPI when
+// the server does not know the route or has collapsed reply threads turned off.
+func threadAPIError(r *http.Response, appErr *model.AppError, action string) error {
+	status := 0
+	if r != nil {
+		status = r.StatusCode
+		r.Body.Close()
+	}
+	if appErr == nil {
+		return nil
+	}
+	if status == http.StatusNotFound || status == http.StatusNotImplemented {
+		return errNoThreadAPI
+	}
+	return errors.Wrap(appErr, action)
+}
+
+// threadTeamID returns the team of the thread API to address a thread of the channel by.
+// Direct and group messages belong to no team, and are listed with the threads of any.
+func (p *Plugin) threadTeamID(userID, channelID string) (string, error) {
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get channel")
+	}
+	if channel.TeamId != "" {
+		return channel.TeamId, nil
+	}
+	teams, appErr := p.API.GetTeamsForUser(userID)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get teams")
+	}
+	if len(teams) == 0 {
+		return "", errors.New("user is in no team")
+	}
+	return teams[0].Id, nil
+}
+
+// newReplies returns the root of the thread and the replies to it created after since by
+// someone other than the user, oldest first.
+func (p *Plugin) newReplies(userID, rootID string, since int64) (*model.Post, []*model.Post, error) {
+	pl, appErr := p.API.GetPostThread(rootID)
+	if appErr != nil {
+		return nil, nil, errors.Wrap(appErr, "failed to get thread")
+	}
+	root, ok := pl.Posts[rootID]
+	if !ok {
+		return nil, nil, errors.New("thread has no root post")
+	}
+	var replies []*model.Post
+	for _, post := range unreadPosts(pl, userID, since) {
+		if post.RootId == rootID {
+			replies = append(replies, post)
+		}
+	}
+	return root, replies, nil
+}
+
+// getFollowedThreads returns the threads the user follows that have unread replies, the most
+// recently replied to first, through the thread API if the server offers it.
+func (p *Plugin) getFollowedThreads(userID string) ([]*followedThread, error) {
+	var threads []*followedThread
+	client, err := p.newRESTClient()
+	if err == nil {
+		threads, err = p.getServerThreads(client, userID)
+	}
+	if err != nil {
+		if err != errNoThreadAPI && err != errNoAccessToken {
+			return nil, err
+		}
+		if threads, err = p.getThreadsByRoot(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(threads, func(i, j int) bool {
+		return threads[i].lastReplyAt() > threads[j].lastReplyAt()
+	})
+	return threads, nil
+}
+
+// getServerThreads asks the thread API for the followed threads with unread replies in every
+// team of the user.
+func (p *Plugin) getServerThreads(client *model.Client4, userID string) ([]*followedThread, error) {
+	teams, appErr := p.API.GetTeamsForUser(userID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get teams")
+	}
+
+	seen := make(map[string]bool)
+	var threads []*followedThread
+	for _, team := range teams {
+		r, appErr := client.DoApiGet(threadRoute(client, userID, team.Id, "")+"?unread=true", "")
+		if appErr != nil {
+			return nil, threadAPIError(r, appErr, "failed to get threads")
+		}
+		var list userThreads
+		err := json.NewDecoder(r.Body).Decode(&list)
+		r.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode threads")
+		}
+
+		// Threads of direct and group messages are listed in every team.
+		for _, thread := range list.Threads {
+			if seen[thread.PostID] || thread.LastReplyAt <= thread.LastViewedAt {
+				continue
+			}
+			seen[thread.PostID] = true
+			root, replies, err := p.newReplies(userID, thread.PostID, thread.LastViewedAt)
+			if err != nil {
+				return nil, err
+			}
+			if len(replies) > 0 && root.DeleteAt == 0 {
+				threads = append(threads, &followedThread{Root: root, Replies: replies, Since: thread.LastViewedAt})
+			}
+		}
+	}
+	return threads, nil
+}
+
+// getThreadsByRoot groups the unread replies of the user's channels by thread, keeping the
+// threads the user followed by voice or took part in, unless they unfollowed them.
+func (p *Plugin) getThreadsByRoot(userID string) ([]*followedThread, error) {
+	prefs, err := p.getThreadPrefs(userID)
+	if err != nil {
+		return nil, err
+	}
+	memberships, err := p.getMemberships(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var threads []*followedThread
+	for _, m := range memberships {
+		channel, cm := m.Channel, m.Member
+		if channel.TotalMsgCount <= cm.MsgCount {
+			continue
+		}
+		pl, appErr := p.API.GetPostsSince(channel.Id, cm.LastViewedAt)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to get posts")
+		}
+
+		var roots []string
+		seen := make(map[string]bool)
+		for _, post := range unreadPosts(pl, userID, cm.LastViewedAt) {
+			if post.RootId != "" && post.CreateAt > prefs.ReadAt[post.RootId] && !seen[post.RootId] {
+				seen[post.RootId] = true
+				roots = append(roots, post.RootId)
+			}
+		}
+		for _, rootID := range roots {
+			pl, appErr := p.API.GetPostThread(rootID)
+			if appErr != nil {
+				return nil, errors.Wrap(appErr, "failed to get thread")
+			}
+			following, ok := prefs.Following[rootID]
+			if !ok {
+				following = participated(pl, userID)
+			}
+			root := pl.Posts[rootID]
+			if !following || root == nil || root.DeleteAt != 0 {
+				continue
+			}
+
+			since := cm.LastViewedAt
+			if prefs.ReadAt[rootID] > since {
+				since = prefs.ReadAt[rootID]
+			}
+			var replies []*model.Post
+			for _, post := range unreadPosts(pl, userID, since) {
+				if post.RootId == rootID {
+					replies = append(replies, post)
+				}
+			}
+			threads = append(threads, &followedThread{Root: root, Replies: replies, Since: since})
+		}
+	}
+	return threads, nil
+}
+
+// participated reports whether the user started or replied to the thread.
+func participated(pl *model.PostList, userID string) bool {
+	for _, post := range pl.Posts {
+		if post.UserId == userID && post.DeleteAt == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// setThreadFollowing follows or unfollows the thread for the user, through the thread API if
+// the server offers it.
+func (p *Plugin) setThreadFollowing(userID string, root *model.Post, following bool) error {
+	client, err := p.newRESTClient()
+	if err == nil {
+		var teamID string
+		if teamID, err = p.threadTeamID(userID, root.ChannelId); err != nil {
+			return err
+		}
+		route := threadRoute(client, userID, teamID, root.Id) + "/following"
+		var r *http.Response
+		var appErr *model.AppError
+		if following {
+			r, appErr = client.DoApiPut(route, "")
+		} else {
+			r, appErr = client.DoApiDelete(route)
+		}
+		err = threadAPIError(r, appErr, "failed to follow thread")
+	}
+	if err != errNoThreadAPI && err != errNoAccessToken {
+		return err
+	}
+
+	prefs, err := p.getThreadPrefs(userID)
+	if err != nil {
+		return err
+	}
+	prefs.Following[root.Id] = following
+	return p.kvSetJSON(threadsKey(userID), prefs, 0)
+}
+
+// markThreadRead marks the thread read up to the reply created at the given time, through the
+// thread API if the server offers it.
+func (p *Plugin) markThreadRead(userID, channelID, rootID string, at int64) error {
+	client, err := p.newRESTClient()
+	if err == nil {
+		var teamID string
+		if teamID, err = p.threadTeamID(userID, channelID); err != nil {
+			return err
+		}
+		route := threadRoute(client, userID, teamID, rootID) + "/read/" + strconv.FormatInt(at, 10)
+		r, appErr := client.DoApiPut(route, "")
+		err = threadAPIError(r, appErr, "failed to mark thread read")
+	}
+	if err != errNoThreadAPI && err != errNoAccessToken {
+		return err
+	}
+
+	prefs, err := p.getThreadPrefs(userID)
+	if err != nil {
+		return err
+	}
+	if prefs.ReadAt[rootID] >= at {
+		return nil
+	}
+	prefs.ReadAt[rootID] = at
+	return p.kvSetJSON(threadsKey(userID), prefs, 0)
+}
+
+// threadLeadWords introduce what a thread is about when naming it, as in "the thread about the
+// release".
+var threadLeadWords = map[string]bool{"the": true, "thread": true, "about": true, "on": true, "of": true}
+
+// cleanThreadName strips the words introducing a spoken thread name.
+func cleanThreadName(spoken string) string {
+	words := strings.Fields(normalizeName(spoken))
+	for len(words) > 1 && threadLeadWords[words[0]] {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// threadTopic returns the first words of the root post of a thread, which name what it is
+// about.
+func threadTopic(root *model.Post, users *userCache) string {
+	return trimWords(plainMessage(root.Message, users), maxThreadTopicWords)
+}
+
+// lastThreadID returns the root of the thread of the post read out last, if any.
+func (p *Plugin) lastThreadID(ctx *IntentContext) string {
+	if ctx.Conversation.LastPostID == "" {
+		return ""
+	}
+	post, appErr := p.API.GetPost(ctx.Conversation.LastPostID)
+	if appErr != nil {
+		return ""
+	}
+	if post.RootId != "" {
+		return post.RootId
+	}
+	return post.Id
+}
+
+// resolveThread finds the thread named by the "thread" parameter among the followed threads
+// with unread replies and the thread of the post read out last, or takes the latter when none
+// is named. read_thread falls back to the most recent of the unread threads. It also returns
+// the thread's unread replies, if it has any.
+func (p *Plugin) resolveThread(ctx *IntentContext, intentName string) (*model.Post, *followedThread, *OutgoingResponse, error) {
+	threads, err := p.getFollowedThreads(ctx.UserID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rootID, chosen := ctx.Choice("thread")
+	switch {
+	case chosen:
+	case ctx.HasParam("thread"):
+		roots := make([]*model.Post, 0, len(threads)+1)
+		for _, thread := range threads {
+			roots = append(roots, thread.Root)
+		}
+		if lastID := p.lastThreadID(ctx); lastID != "" {
+			if root, appErr := p.API.GetPost(lastID); appErr == nil && root.DeleteAt == 0 {
+				roots = append(roots, root)
+			}
+		}
+
+		users := newUserCache(p, ctx.T)
+		spoken := cleanThreadName(ctx.Param("thread"))
+		seen := make(map[string]bool)
+		var candidates []match
+		for _, root := range roots {
+			if seen[root.Id] {
+				continue
+			}
+			seen[root.Id] = true
+			candidates = append(candidates, match{
+				ID:    root.Id,
+				Name:  ctx.T("thread.name", vars{"Topic": threadTopic(root, users)}),
+				Score: matchScore(spoken, plainMessage(root.Message, users)),
+			})
+		}
+		matches, confident := rankMatches(candidates)
+		if len(matches) == 0 {
+			return nil, nil, nil, newIntentError("thread.not_found", nil)
+		}
+		if !confident {
+			return nil, nil, ctx.askChoice(intentName, "thread", matches), nil
+		}
+		rootID = matches[0].ID
+	case ctx.Conversation.LastPostID != "":
+		rootID = p.lastThreadID(ctx)
+	case intentName == "read_thread" && len(threads) > 0:
+		rootID = threads[0].Root.Id
+	case intentName == "read_thread":
+		return nil, nil, nil, newIntentError("thread.none", nil)
+	default:
+		return nil, nil, nil, newIntentError("thread.which", nil)
+	}
+
+	root, appErr := p.API.GetPost(rootID)
+	if appErr != nil || root.DeleteAt != 0 || !p.API.HasPermissionToChannel(ctx.UserID, root.ChannelId, model.PERMISSION_READ_CHANNEL) {
+		return nil, nil, nil, newIntentError("thread.not_found", appErr)
+	}
+	for _, thread := range threads {
+		if thread.Root.Id == root.Id {
+			return root, thread, nil, nil
+		}
+	}
+	return root, nil, nil, nil
+}
+
+// threadChannelName returns how the channel of the thread is referred to when spoken.
+func (p *Plugin) threadChannelName(ctx *IntentContext, root *model.Post, users *userCache) (*model.Channel, string, error) {
+	channel, appErr := p.API.GetChannel(root.ChannelId)
+	if appErr != nil {
+		return nil, "", errors.Wrap(appErr, "failed to get channel")
+	}
+	return channel, users.channelName(channel, ctx.UserID), nil
+}
+
+// handleListThreads speaks the followed threads with unread replies, the most recently replied
+// to first.
+func (p *Plugin) handleListThreads(ctx *IntentContext) (*OutgoingResponse, error) {
+	threads, err := p.getFollowedThreads(ctx.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(threads) == 0 {
+		return getResponseWithText(ctx.T("thread.none")), nil
+	}
+
+	users := newUserCache(p, ctx.T)
+	messages := []string{ctx.T("thread.list", len(threads))}
+	for i, thread := range threads {
+		if i == maxBrowseItems {
+			break
+		}
+		_, name, err := p.threadChannelName(ctx, thread.Root, users)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, ctx.T("thread.item", len(thread.Replies), vars{"Topic": threadTopic(thread.Root, users), "Channel": name}))
+	}
+	messages = append(messages, ctx.T("thread.say_read"))
+	return newPrompt().SayPaused(messages...).Response(), nil
+}
+
+// handleReadThread reads out the unread replies of a thread, or its latest replies if the user
+// read them all already. The replies read out are marked read in the thread only.
+func (p *Plugin) handleReadThread(ctx *IntentContext) (*OutgoingResponse, error) {
+	root, thread, question, err := p.resolveThread(ctx, "read_thread")
+	if err != nil || question != nil {
+		return question, err
+	}
+
+	users := newUserCache(p, ctx.T)
+	channel, name, err := p.threadChannelName(ctx, root, users)
+	if err != nil {
+		return nil, err
+	}
+	topic := threadTopic(root, users)
+
+	perChannel, total := p.readCaps()
+	limit := total
+	var replies []*model.Post
+	if thread != nil {
+		replies = thread.Replies
+	} else {
+		if _, replies, err = p.newReplies("", root.Id, 0); err != nil {
+			return nil, err
+		}
+		limit = perChannel
+	}
+	if len(replies) == 0 {
+		ctx.Conversation.Reading = nil
+		return getResponseWithText(ctx.T("thread.no_replies", vars{"Topic": topic})), nil
+	}
+
+	state := &readingState{
+		Channels: []readingChannel{{ID: channel.Id, Name: name, Direct: channel.Type == model.CHANNEL_DIRECT}},
+		Thread:   root.Id,
+	}
+	if len(replies) > limit {
+		state.Channels[0].Skipped = len(replies) - limit
+		replies = replies[len(replies)-limit:]
+	}
+	for _, reply := range replies {
+		state.Items = append(state.Items, readingItem{PostID: reply.Id})
+	}
+	if thread == nil {
+		// Replies read before are not marked again.
+		state.Marked = len(state.Items)
+	}
+	ctx.Conversation.Reading = state
+
+	response, err := p.readPage(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	intro := ctx.T("thread.new", vars{"Topic": topic})
+	if thread == nil {
+		intro = ctx.T("thread.latest", vars{"Topic": topic})
+	}
+	response.Prompt.FirstSimple = getResponseWithText(intro).Prompt.LastSimple
+	return response, nil
+}
+
+// markThreadSpoken marks the thread being read as read up to the last reply read out between
+// pos and end, unless the user turned this off.
+func (p *Plugin) markThreadSpoken(ctx *IntentContext, posts map[int]*model.Post, pos, end int) {
+	state := ctx.Conversation.Reading
+	if pos < state.Marked {
+		pos = state.Marked
+	}
+	if pos >= end {
+		return
+	}
+	settings, err := p.getUserSettings(ctx.UserID)
+	if err != nil {
+		p.API.LogWarn("Cannot get settings", "err", err.Error())
+		return
+	}
+	if !settings.markAsRead() {
+		return
+	}
+
+	var last *model.Post
+	for i := pos; i < end; i++ {
+		if post, ok := posts[i]; ok {
+			last = post
+		}
+	}
+	state.Marked = end
+	if last == nil {
+		return
+	}
+	if err := p.markThreadRead(ctx.UserID, state.Channels[0].ID, state.Thread, last.CreateAt); err != nil {
+		p.API.LogWarn("Cannot mark thread as read", "root_id", state.Thread, "err", err.Error())
+	}
+}
+
+// handleReplyThread posts a reply as the user in a thread named by voice, or the thread of the
+// post read out last.
+func (p *Plugin) handleReplyThread(ctx *IntentContext) (*OutgoingResponse, error) {
+	root, _, question, err := p.resolveThread(ctx, "reply_thread")
+	if err != nil || question != nil {
+		return question, err
+	}
+	if !p.API.HasPermissionToChannel(ctx.UserID, root.ChannelId, model.PERMISSION_CREATE_POST) {
+		return nil, newIntentError("reply.no_permission", nil)
+	}
+
+	message := ctx.Param("message")
+	topic := threadTopic(root, newUserCache(p, ctx.T))
+	if question := ctx.confirm(ctx.T("thread.confirm_reply", vars{"Message": message, "Topic": topic})); question != nil {
+		return question, nil
+	}
+	if err := p.createUserPost(ctx.UserID, root.ChannelId, root.Id, message); err != nil {
+		return nil, err
+	}
+	return getResponseWithText(ctx.T("thread.replied", vars{"Topic": topic})), nil
+}
+
+func (p *Plugin) handleFollowThread(ctx *IntentContext) (*OutgoingResponse, error) {
+	return p.changeThreadFollowing(ctx, "follow_thread", true)
+}
+
+func (p *Plugin) handleUnfollowThread(ctx *IntentContext) (*OutgoingResponse, error) {
+	return p.changeThreadFollowing(ctx, "unfollow_thread", false)
+}
+
+// changeThreadFollowing follows or unfollows a thread named by voice, or the thread of the
+// post read out last.
+func (p *Plugin) changeThreadFollowing(ctx *IntentContext, intentName string, following bool) (*OutgoingResponse, error) {
+	root, _, question, err := p.resolveThread(ctx, intentName)
+	if err != nil || question != nil {
+		return question, err
+	}
+
+	topic := threadTopic(root, newUserCache(p, ctx.T))
+	confirmID, doneID := "thread.confirm_follow", "thread.followed"
+	if !following {
+		confirmID, doneID = "thread.confirm_unfollow", "thread.unfollowed"
+	}
+	if question := ctx.confirm(ctx.T(confirmID, vars{"Topic": topic})); question != nil {
+		return question, nil
+	}
+	if err := p.setThreadFollowing(ctx.UserID, root, following); err != nil {
+		return nil, err
+	}
+	return getResponseWithText(ctx.T(doneID, vars{"Topic": topic})), nil
+}
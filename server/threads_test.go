@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanThreadName(t *testing.T) {
+	assert.Equal(t, "release", cleanThreadName("the thread about the release"))
+	assert.Equal(t, "lunch plans", cleanThreadName("Lunch plans"))
+	assert.Equal(t, "thread", cleanThreadName("the thread"))
+}
+
+// threadsTest holds a channel with two threads: one the user started, with two new replies,
+// and one they never took part in, with a new reply from Bob.
+type threadsTest struct {
+	api            *plugintest.API
+	me, alice, bob *model.User
+	town           *model.Channel
+	release, lunch *model.Post
+	replies        []*model.Post
+	created        []*model.Post
+}
+
+func newThreadsTest() *threadsTest {
+	tt := &threadsTest{
+		api:   &plugintest.API{},
+		me:    &model.User{Id: model.NewId(), Username: "me"},
+		alice: &model.User{Id: model.NewId(), Username: "alice", FirstName: "Alice", LastName: "Smith"},
+		bob:   &model.User{Id: model.NewId(), Username: "bob", FirstName: "Bob", LastName: "Builder"},
+	}
+	team := &model.Team{Id: model.NewId()}
+	tt.town = &model.Channel{Id: model.NewId(), Type: model.CHANNEL_OPEN, TeamId: team.Id, Name: "town-square", DisplayName: "Town Square", TotalMsgCount: 6}
+
+	tt.release = newTestPost(tt.town.Id, tt.me.Id, "shall we move the release to next week because of the holidays?", 5)
+	tt.lunch = newTestPost(tt.town.Id, tt.alice.Id, "lunch plans for friday", 6)
+	seen := newTestPost(tt.town.Id, tt.alice.Id, "sounds good", 8)
+	seen.RootId = tt.release.Id
+	for i, text := range []string{"fine by me", "let's ask the team"} {
+		reply := newTestPost(tt.town.Id, tt.alice.Id, text, int64(20+i))
+		reply.RootId = tt.release.Id
+		tt.replies = append(tt.replies, reply)
+	}
+	pizza := newTestPost(tt.town.Id, tt.bob.Id, "pizza?", 30)
+	pizza.RootId = tt.lunch.Id
+
+	api := tt.api
+	newMemKV(api)
+	api.On("GetTeamsForUser", tt.me.Id).Return([]*model.Team{team}, nil)
+	api.On("GetChannelMembersForUser", team.Id, tt.me.Id, 0, channelMembersPerPage).Return([]*model.ChannelMember{
+		{ChannelId: tt.town.Id, LastViewedAt: 10, MsgCount: 2},
+	}, nil)
+	api.On("GetChannelsForTeamForUser", team.Id, tt.me.Id, false).Return([]*model.Channel{tt.town}, nil)
+	api.On("GetChannel", tt.town.Id).Return(tt.town, nil)
+	api.On("HasPermissionToChannel", tt.me.Id, tt.town.Id, mock.Anything).Return(true)
+	for _, u := range []*model.User{tt.me, tt.alice, tt.bob} {
+		api.On("GetUser", u.Id).Return(u, nil)
+	}
+	api.On("GetPostsSince", tt.town.Id, int64(10)).Return(newPostList(append(tt.replies, pizza)...), nil)
+	api.On("GetPostThread", tt.release.Id).Return(newPostList(tt.release, seen, tt.replies[0], tt.replies[1]), nil)
+	api.On("GetPostThread", tt.lunch.Id).Return(newPostList(tt.lunch, pizza), nil)
+	for _, post := range append([]*model.Post{tt.release, tt.lunch, seen, pizza}, tt.replies...) {
+		api.On("GetPost", post.Id).Return(post, nil)
+	}
+	api.On("CreatePost", mock.Anything).Return(func(post *model.Post) *model.Post {
+		tt.created = append(tt.created, post)
+		return post
+	}, nil)
+	return tt
+}
+
+func (tt *threadsTest) dispatch(t *testing.T, handle intentFunc, c *conversation, params map[string]interface{}) *OutgoingResponse {
+	response, err := handle(&IntentContext{Request: newIntentRequest("thread", params), UserID: tt.me.Id, Conversation: c})
+	if iErr, ok := err.(*intentError); ok {
+		return getResponseWithText(translateError(iErr))
+	}
+	require.NoError(t, err)
+	return response
+}
+
+func TestThreadsByRoot(t *testing.T) {
+	tt := newThreadsTest()
+	p := &Plugin{}
+	p.SetAPI(tt.api)
+	c := &conversation{UserID: tt.me.Id}
+
+	response := tt.dispatch(t, p.handleListThreads, c, nil)
+	assert.Equal(t, `1 thread you follow has new replies:
+2 new replies in the thread about 'shall we move the release to next week…' in Town Square.
+Say read the thread about, followed by its topic, to hear the replies.`, displayText(t, response))
+
+	response = tt.dispatch(t, p.handleFollowThread, c, map[string]interface{}{"thread": "lunch plans"})
+	assert.Equal(t, "Sorry, can't find that thread!", speech(t, response))
+
+	response = tt.dispatch(t, p.handleReadThread, c, map[string]interface{}{"thread": "the thread about the release"})
+	assert.Equal(t, "Here are the new replies in the thread about 'shall we move the release to next week…':", *response.Prompt.FirstSimple.Speech)
+	assert.Equal(t, `In Town Square:
+Alice Smith wrote 'fine by me'.
+Alice Smith wrote 'let's ask the team'.
+That's all the replies in this thread.`, displayText(t, response))
+	assert.Equal(t, tt.replies[1].Id, c.LastPostID)
+
+	response = tt.dispatch(t, p.handleListThreads, c, nil)
+	assert.Equal(t, "None of the threads you follow have new replies.", speech(t, response))
+
+	t.Run("read again", func(t *testing.T) {
+		response := tt.dispatch(t, p.handleReadThread, c, nil)
+		assert.Equal(t, "No new replies in the thread about 'shall we move the release to next week…', here are the latest:", *response.Prompt.FirstSimple.Speech)
+		assert.Contains(t, displayText(t, response), "Alice Smith wrote 'sounds good'.")
+	})
+
+	t.Run("follow and unfollow", func(t *testing.T) {
+		c := &conversation{UserID: tt.me.Id, LastPostID: tt.lunch.Id}
+		response := tt.dispatch(t, p.handleFollowThread, c, nil)
+		assert.Equal(t, "You now follow the thread about 'lunch plans for friday'.", speech(t, response))
+		response = tt.dispatch(t, p.handleListThreads, c, nil)
+		assert.Contains(t, displayText(t, response), "1 new reply in the thread about 'lunch plans for friday' in Town Square.")
+
+		response = tt.dispatch(t, p.handleUnfollowThread, c, map[string]interface{}{"thread": "lunch plans"})
+		assert.Equal(t, "You no longer follow the thread about 'lunch plans for friday'.", speech(t, response))
+		response = tt.dispatch(t, p.handleListThreads, c, nil)
+		assert.Equal(t, "None of the threads you follow have new replies.", speech(t, response))
+	})
+
+	t.Run("reply", func(t *testing.T) {
+		c := &conversation{UserID: tt.me.Id, LastPostID: tt.replies[0].Id}
+		response := tt.dispatch(t, p.handleReplyThread, c, map[string]interface{}{"message": "agreed"})
+		assert.Equal(t, "Replied in the thread about 'shall we move the release to next week…'.", speech(t, response))
+		require.Len(t, tt.created, 1)
+		assert.Equal(t, tt.release.Id, tt.created[0].RootId)
+		assert.Equal(t, tt.town.Id, tt.created[0].ChannelId)
+
+		response = tt.dispatch(t, p.handleReplyThread, &conversation{UserID: tt.me.Id}, map[string]interface{}{"message": "agreed"})
+		assert.Equal(t, "Which thread? Say what it is about, or read one of its messages first.", speech(t, response))
+	})
+}
+
+func TestThreadsThroughAPI(t *testing.T) {
+	tt := newThreadsTest()
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path[strings.Index(r.URL.Path, "/threads"):])
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(map[string]interface{}{"threads": []map[string]interface{}{
+				{"id": tt.lunch.Id, "last_reply_at": 30, "last_viewed_at": 25},
+			}})
+			return
+		}
+		w.Write([]byte(`{"status": "OK"}`))
+	}))
+	defer server.Close()
+	tt.api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewString(server.URL)}})
+
+	p := &Plugin{}
+	p.SetAPI(tt.api)
+	p.setConfiguration(&configuration{AccessToken: "token"})
+	c := &conversation{UserID: tt.me.Id}
+
+	response := tt.dispatch(t, p.handleListThreads, c, nil)
+	assert.Equal(t, `1 thread you follow has new replies:
+1 new reply in the thread about 'lunch plans for friday' in Town Square.
+Say read the thread about, followed by its topic, to hear the replies.`, displayText(t, response))
+
+	response = tt.dispatch(t, p.handleReadThread, c, nil)
+	assert.Contains(t, displayText(t, response), "Bob Builder wrote 'pizza?'.")
+	response = tt.dispatch(t, p.handleUnfollowThread, c, nil)
+	assert.Equal(t, "You no longer follow the thread about 'lunch plans for friday'.", speech(t, response))
+	assert.Equal(t, []string{
+		"GET /threads",
+		"GET /threads",
+		"PUT /threads/" + tt.lunch.Id + "/read/30",
+		"GET /threads",
+		"DELETE /threads/" + tt.lunch.Id + "/following",
+	}, calls)
+
+	t.Run("falls back without the API", func(t *testing.T) {
+		server.Config.Handler = http.NotFoundHandler()
+		response := tt.dispatch(t, p.handleListThreads, c, nil)
+		assert.Contains(t, displayText(t, response), "2 new replies in the thread about 'shall we move the release")
+	})
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/go-i18n/i18n/bundle"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// defaultHour is the hour of days named without a time, such as "tomorrow".
+const defaultHour = 9
+
+var (
+	clockPattern    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	timeWordPattern = regexp.MustCompile(`[^a-z0-9:.]+`)
+)
+
+// numberWords are the numbers spoken as words rather than recognized as digits.
+var numberWords = map[string]float64{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12, "fifteen": 15,
+	"twenty": 20, "thirty": 30, "forty": 40, "fifty": 50, "half": 0.5, "couple": 2, "few": 3,
+}
+
+var durationUnits = map[string]time.Duration{
+	"minute": time.Minute, "minutes": time.Minute, "min": time.Minute, "mins": time.Minute,
+	"hour": time.Hour, "hours": time.Hour, "hr": time.Hour, "hrs": time.Hour,
+	"day": 24 * time.Hour, "days": 24 * time.Hour,
+	"week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
+// dayParts are the hours and minutes meant by the parts of a day.
+var dayParts = map[string][2]int{
+	"morning":   {9, 0},
+	"noon":      {12, 0},
+	"midday":    {12, 0},
+	"lunch":     {12, 0},
+	"afternoon": {14, 0},
+	"eod":       {17, 0},
+	"evening":   {18, 0},
+	"tonight":   {20, 0},
+	"night":     {20, 0},
+	"midnight":  {24, 0},
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// timeFillers are words that do not change the meaning of a spoken time.
+var timeFillers = map[string]bool{
+	"until": true, "till": true, "til": true, "up": true, "to": true, "by": true, "at": true,
+	"on": true, "for": true, "in": true, "the": true, "this": true, "of": true, "o'clock": true,
+	"oclock": true, "and": true, "next": true,
+}
+
+// timeWords splits a spoken time into the lower case words that matter, dropping fillers and
+// punctuation but keeping "3pm", "3 p.m." and "15:30" whole.
+func timeWords(spoken string) []string {
+	s := strings.ToLower(spoken)
+	s = strings.NewReplacer("a.m.", "am", "p.m.", "pm", "o'clock", "").Replace(s)
+	s = timeWordPattern.ReplaceAllString(s, " ")
+	var words []string
+	for _, w := range strings.Fields(s) {
+		if w = strings.Trim(w, "."); w != "" && !timeFillers[w] {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// parseTime understands when something should happen or end, as said in English: durations
+// such as "for 2 hours" or "in an hour and a half", and times such as "until 3pm",
+// "tomorrow morning" or "on friday at noon". Times without a day are the next time the clock
+// shows them. now carries the location of the user. ok is false unless every word was
+// understood and the time lies ahead.
+func parseTime(spoken string, now time.Time) (t time.Time, ok bool) {
+	words := timeWords(spoken)
+	if len(words) == 0 {
+		return time.Time{}, false
+	}
+	if d, ok := parseDuration(words); ok {
+		t = now.Add(d).Truncate(time.Minute)
+	} else if t, ok = parseClockTime(words, now); !ok {
+		return time.Time{}, false
+	}
+	return t, t.After(now)
+}
+
+// parseDuration adds up spoken amounts of time, such as "2 hours and 30 minutes" or "an hour
+// and a half". A trailing amount without unit is counted in the unit before it.
+func parseDuration(words []string) (time.Duration, bool) {
+	var total, unit time.Duration
+	amount := 0.0
+	for i, w := range words {
+		if u, ok := durationUnits[w]; ok {
+			if amount == 0 {
+				return 0, false
+			}
+			total += time.Duration(amount * float64(u))
+			unit, amount = u, 0
+			continue
+		}
+		if n, ok := numberWords[w]; ok {
+			// "a" and "an" only count on their own, not in "half an hour" or "a few minutes".
+			if w == "a" || w == "an" {
+				if _, next := numberWords[nextWord(words, i)]; amount > 0 || next {
+					continue
+				}
+			}
+			// Numbers in a row add up, as in "twenty five" or "two and a half".
+			amount += n
+			continue
+		}
+		n, err := strconv.ParseFloat(w, 64)
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		amount += n
+	}
+	if amount > 0 {
+		if unit == 0 || amount >= 1 {
+			return 0, false
+		}
+		total += time.Duration(amount * float64(unit))
+	}
+	return total, total > 0
+}
+
+// parseClockTime understands a day, a time of the day or both.
+func parseClockTime(words []string, now time.Time) (time.Time, bool) {
+	days, hour, minute := -1, -1, 0
+	meridiem := ""
+	// onClock is set for hours said as numbers, which may be meant before or after noon.
+	onClock := false
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		switch {
+		case w == "today":
+			days = 0
+		case w == "tomorrow":
+			days = 1
+		case w == "week":
+			// "next week" starts on Monday.
+			days = daysUntil(now.Weekday(), time.Monday)
+		case w == "end" && nextWord(words, i) == "day":
+			hour, minute = 17, 0
+			i++
+		case w == "am" || w == "pm":
+			meridiem = w
+		default:
+			if wd, ok := weekdays[w]; ok {
+				days = daysUntil(now.Weekday(), wd)
+			} else if part, ok := dayParts[w]; ok {
+				if hour < 0 {
+					hour, minute = part[0], part[1]
+				}
+				if meridiem == "" && part[0] < 12 {
+					meridiem = "am"
+				} else if meridiem == "" {
+					meridiem = "pm"
+				}
+				if w == "tonight" && days < 0 {
+					days = 0
+				}
+			} else if m := clockPattern.FindStringSubmatch(w); m != nil {
+				hour, _ = strconv.Atoi(m[1])
+				minute, _ = strconv.Atoi(m[2])
+				onClock = true
+				if m[3] != "" {
+					meridiem = m[3]
+				}
+			} else if n, ok := numberWords[w]; ok && n >= 1 && n <= 12 && n == float64(int(n)) && w != "a" && w != "an" {
+				hour, minute, onClock = int(n), 0, true
+			} else {
+				return time.Time{}, false
+			}
+		}
+	}
+	if hour > 24 || minute > 59 {
+		return time.Time{}, false
+	}
+
+	switch {
+	case hour < 0 && days < 0:
+		return time.Time{}, false
+	case hour < 0:
+		hour = defaultHour
+	case meridiem == "pm" && hour < 12:
+		hour += 12
+	case meridiem == "am" && hour == 12:
+		hour = 0
+	case onClock && meridiem == "" && days > 0 && hour < 7:
+		// Nobody means 3 in the morning of another day.
+		hour += 12
+	}
+
+	day := days
+	if day < 0 {
+		day = 0
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day()+day, hour, minute, 0, 0, now.Location())
+	if days < 0 && !t.After(now) {
+		// Times without a day are the next time the clock shows them, which for times without
+		// am or pm may be later today.
+		if onClock && meridiem == "" && hour < 12 && t.Add(12*time.Hour).After(now) {
+			return t.Add(12 * time.Hour), true
+		}
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
+
+func nextWord(words []string, i int) string {
+	if i+1 < len(words) {
+		return words[i+1]
+	}
+	return ""
+}
+
+// daysUntil counts the days from one weekday to the next other, a week for the same weekday.
+func daysUntil(from, to time.Weekday) int {
+	days := (int(to) - int(from) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+	return days
+}
+
+// describeTime speaks a time relative to now, such as "5:00 PM" or "tomorrow at 9:00 AM".
+func describeTime(T bundle.TranslateFunc, t, now time.Time) string {
+	t = t.In(now.Location())
+	clock := t.Format(T("time.clock_layout"))
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch days := int(t.Sub(today).Hours() / 24); {
+	case days == 0:
+		return T("time.today", vars{"Time": clock})
+	case days == 1:
+		return T("time.tomorrow", vars{"Time": clock})
+	case days < 7:
+		return T("time.weekday", vars{"Day": T("time." + strings.ToLower(t.Weekday().String())), "Time": clock})
+	default:
+		return T("time.date", vars{"Date": t.Format(T("time.date_layout")), "Time": clock})
+	}
+}
+
+// parseDateRange understands a spoken period of the past, such as "today", "yesterday", "last
+// week", "this month", "on monday" or "in the past 3 days", as the days from start until end,
+// end excluded. now carries the location of the user.
+func parseDateRange(spoken string, now time.Time) (start, end time.Time, ok bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tomorrow := today.AddDate(0, 0, 1)
+	monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	firstOfMonth := today.AddDate(0, 0, 1-today.Day())
+
+	words := timeWords(spoken)
+	last := len(words) > 0 && words[0] == "last"
+	if len(words) > 0 && (words[0] == "last" || words[0] == "past") {
+		words = words[1:]
+	}
+	if len(words) != 1 {
+		// "the past 3 days" or "the last two weeks" count back from today.
+		d, ok := parseDuration(words)
+		if !ok || d < 24*time.Hour {
+			return time.Time{}, time.Time{}, false
+		}
+		return tomorrow.AddDate(0, 0, -int(d/(24*time.Hour))), tomorrow, true
+	}
+
+	switch w := words[0]; {
+	case w == "today":
+		return today, tomorrow, true
+	case w == "yesterday":
+		return today.AddDate(0, 0, -1), today, true
+	case w == "week" && last:
+		return monday.AddDate(0, 0, -7), monday, true
+	case w == "week":
+		return monday, tomorrow, true
+	case w == "month" && last:
+		return firstOfMonth.AddDate(0, -1, 0), firstOfMonth, true
+	case w == "month":
+		return firstOfMonth, tomorrow, true
+	}
+	wd, ok := weekdays[words[0]]
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	// Weekdays are the last one, or today.
+	day := today.AddDate(0, 0, -(int(today.Weekday())-int(wd)+7)%7)
+	if last && day.Equal(today) {
+		day = day.AddDate(0, 0, -7)
+	}
+	return day, day.AddDate(0, 0, 1), true
+}
+
+// describeAgo speaks how long ago something happened, such as "5 minutes ago" or "yesterday".
+func describeAgo(T bundle.TranslateFunc, t, now time.Time) string {
+	t = t.In(now.Location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch ago := now.Sub(t); {
+	case ago < time.Minute:
+		return T("time.just_now")
+	case ago < time.Hour:
+		return T("time.minutes_ago", int(ago/time.Minute))
+	case ago < 12*time.Hour || !t.Before(today):
+		return T("time.hours_ago", int(ago/time.Hour))
+	case !t.Before(today.AddDate(0, 0, -1)):
+		return T("time.yesterday")
+	case !t.Before(today.AddDate(0, 0, -6)):
+		return T("time.days_ago", int(today.Sub(t)/(24*time.Hour))+1)
+	default:
+		return T("time.on_date", vars{"Date": t.Format(T("time.date_layout"))})
+	}
+}
+
+// userLocation returns the time zone the user set in Mattermost, or the server's if they set
+// none.
+func (p *Plugin) userLocation(userID string) *time.Location {
+	u, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		p.API.LogWarn("Cannot get user time zone", "user_id", userID, "err", appErr.Error())
+		return time.Local
+	}
+	name := model.GetPreferredTimezone(u.Timezone)
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		p.API.LogWarn("Cannot load user time zone", "user_id", userID, "timezone", name, "err", err.Error())
+		return time.Local
+	}
+	return loc
+}
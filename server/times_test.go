@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	// A Wednesday afternoon.
+	now := time.Date(2020, time.June, 10, 14, 20, 30, 0, berlin)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2020, time.June, day, hour, minute, 0, 0, berlin)
+	}
+
+	for spoken, expected := range map[string]time.Time{
+		"for 2 hours":               at(10, 16, 20),
+		"for half an hour":          at(10, 14, 50),
+		"in an hour and a half":     at(10, 15, 50),
+		"for two and a half hours":  at(10, 16, 50),
+		"for 1 hour and 15 minutes": at(10, 15, 35),
+		"for twenty five minutes":   at(10, 14, 45),
+		"for a couple of days":      at(12, 14, 20),
+		"until 3pm":                 at(10, 15, 0),
+		"until 3:30 p.m.":           at(10, 15, 30),
+		"until 5":                   at(10, 17, 0),
+		"until 2":                   at(11, 2, 0),
+		"until 16:45":               at(10, 16, 45),
+		"until 9am":                 at(11, 9, 0),
+		"till noon":                 at(11, 12, 0),
+		"until this evening":        at(10, 18, 0),
+		"until the end of the day":  at(10, 17, 0),
+		"until tonight":             at(10, 20, 0),
+		"until midnight":            at(11, 0, 0),
+		"until tomorrow":            at(11, 9, 0),
+		"until tomorrow morning":    at(11, 9, 0),
+		"until tomorrow at 3":       at(11, 15, 0),
+		"tomorrow at eight o'clock": at(11, 8, 0),
+		"until friday":              at(12, 9, 0),
+		"on wednesday afternoon":    at(17, 14, 0),
+		"until next week":           at(15, 9, 0),
+		"until next monday at 10am": at(15, 10, 0),
+	} {
+		actual, ok := parseTime(spoken, now)
+		if assert.True(t, ok, spoken) {
+			assert.Equal(t, expected, actual, spoken)
+		}
+	}
+
+	for _, spoken := range []string{"", "for a while", "until later", "for hours", "until today", "until 25:00"} {
+		_, ok := parseTime(spoken, now)
+		assert.False(t, ok, spoken)
+	}
+}
+
+func TestDescribeTime(t *testing.T) {
+	now := time.Date(2020, time.June, 10, 14, 20, 0, 0, time.UTC)
+	T := translator("en")
+	assert.Equal(t, "today at 5:00 PM", describeTime(T, now.Add(160*time.Minute), now))
+	assert.Equal(t, "tomorrow at 9:00 AM", describeTime(T, time.Date(2020, time.June, 11, 9, 0, 0, 0, time.UTC), now))
+	assert.Equal(t, "Friday at 12:30 PM", describeTime(T, time.Date(2020, time.June, 12, 12, 30, 0, 0, time.UTC), now))
+	assert.Equal(t, "June 24 at 8:00 AM", describeTime(T, time.Date(2020, time.June, 24, 8, 0, 0, 0, time.UTC), now))
+	assert.Equal(t, "morgen um 09:00 Uhr", describeTime(translator("de"), time.Date(2020, time.June, 11, 9, 0, 0, 0, time.UTC), now))
+}
+
+func TestParseDateRange(t *testing.T) {
+	// Wednesday.
+	now := time.Date(2020, time.June, 10, 14, 20, 0, 0, time.UTC)
+	day := func(d int) time.Time {
+		return time.Date(2020, time.June, d, 0, 0, 0, 0, time.UTC)
+	}
+	for spoken, expected := range map[string][2]time.Time{
+		"today":              {day(10), day(11)},
+		"yesterday":          {day(9), day(10)},
+		"this week":          {day(8), day(11)},
+		"last week":          {day(1), day(8)},
+		"this month":         {day(1), day(11)},
+		"last month":         {time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC), day(1)},
+		"on monday":          {day(8), day(9)},
+		"wednesday":          {day(10), day(11)},
+		"last wednesday":     {day(3), day(4)},
+		"in the past 3 days": {day(8), day(11)},
+		"the last two weeks": {time.Date(2020, time.May, 28, 0, 0, 0, 0, time.UTC), day(11)},
+	} {
+		start, end, ok := parseDateRange(spoken, now)
+		require.True(t, ok, spoken)
+		assert.Equal(t, expected[0], start, spoken)
+		assert.Equal(t, expected[1], end, spoken)
+	}
+
+	for _, spoken := range []string{"", "someday", "in 2 hours", "next week please"} {
+		_, _, ok := parseDateRange(spoken, now)
+		assert.False(t, ok, spoken)
+	}
+}
+
+func TestDescribeAgo(t *testing.T) {
+	now := time.Date(2020, time.June, 10, 14, 20, 0, 0, time.UTC)
+	T := translator("en")
+	assert.Equal(t, "just now", describeAgo(T, now.Add(-10*time.Second), now))
+	assert.Equal(t, "1 minute ago", describeAgo(T, now.Add(-time.Minute), now))
+	assert.Equal(t, "3 hours ago", describeAgo(T, now.Add(-3*time.Hour), now))
+	assert.Equal(t, "yesterday", describeAgo(T, time.Date(2020, time.June, 9, 9, 0, 0, 0, time.UTC), now))
+	assert.Equal(t, "3 days ago", describeAgo(T, time.Date(2020, time.June, 7, 9, 0, 0, 0, time.UTC), now))
+	assert.Equal(t, "on June 1", describeAgo(T, time.Date(2020, time.June, 1, 9, 0, 0, 0, time.UTC), now))
+	assert.Equal(t, "vor 2 Stunden", describeAgo(translator("de"), now.Add(-2*time.Hour), now))
+}
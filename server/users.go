@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	usersPerPage = 200
+
+	// phoneticMatchScore is the score of a name whose words all sound like the spoken words.
+	phoneticMatchScore = 0.9
+)
+
+// phoneticScore rates a name by how it sounds: names whose words each sound like the spoken
+// word in the same position score phoneticMatchScore, others nothing.
+func phoneticScore(spoken, name string) float64 {
+	sw, nw := strings.Fields(normalizeName(spoken)), strings.Fields(normalizeName(name))
+	if len(sw) == 0 || len(sw) != len(nw) {
+		return 0
+	}
+	for i := range sw {
+		if !soundsAlike(sw[i], nw[i]) {
+			return 0
+		}
+	}
+	return phoneticMatchScore
+}
+
+// nameScore rates how well the spoken text matches a name, by spelling or by sound.
+func nameScore(spoken, name string) float64 {
+	score := matchScore(spoken, name)
+	if s := phoneticScore(spoken, name); s > score {
+		score = s
+	}
+	return score
+}
+
+// userNames returns the names a user may be called by.
+func userNames(u *model.User) []string {
+	names := []string{u.Username}
+	for _, name := range []string{u.FirstName, u.LastName, strings.TrimSpace(u.FirstName + " " + u.LastName), u.Nickname} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// getTeammates returns the active users sharing a team with the user, bots excluded.
+func (p *Plugin) getTeammates(userID string) ([]*model.User, error) {
+	teams, appErr := p.API.GetTeamsForUser(userID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get teams")
+	}
+
+	seen := make(map[string]bool)
+	var users []*model.User
+	for _, team := range teams {
+		for page := 0; ; page++ {
+			members, appErr := p.API.GetUsersInTeam(team.Id, page, usersPerPage)
+			if appErr != nil {
+				return nil, errors.Wrap(appErr, "failed to get users")
+			}
+			for _, u := range members {
+				if !seen[u.Id] && u.DeleteAt == 0 && !u.IsBot {
+					seen[u.Id] = true
+					users = append(users, u)
+				}
+			}
+			if len(members) < usersPerPage {
+				break
+			}
+		}
+	}
+	return users, nil
+}
+
+// findUsers matches a spoken name against the usernames, names and nicknames of the user's
+// teammates. Matches are named by their full name, along with their username when several
+// share it.
+func (p *Plugin) findUsers(userID, spoken string) ([]match, bool, error) {
+	users, err := p.getTeammates(userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var candidates []match
+	byID := make(map[string]*model.User)
+	for _, u := range users {
+		score := 0.0
+		for _, name := range userNames(u) {
+			if s := nameScore(spoken, name); s > score {
+				score = s
+			}
+		}
+		candidates = append(candidates, match{ID: u.Id, Name: u.GetDisplayName(model.SHOW_FULLNAME), Score: score})
+		byID[u.Id] = u
+	}
+
+	matches, confident := rankMatches(candidates)
+	names := make(map[string]int)
+	for _, m := range matches {
+		names[m.Name]++
+	}
+	for i, m := range matches {
+		if names[m.Name] > 1 {
+			matches[i].Name = fmt.Sprintf("%s, %s", m.Name, byID[m.ID].Username)
+		}
+	}
+	return matches, confident, nil
+}
+
+// resolveUserParam finds the user named by a parameter of the intent. When the name is
+// ambiguous, it returns the question asking which user was meant instead.
+func (p *Plugin) resolveUserParam(ctx *IntentContext, intentName, param string) (string, *OutgoingResponse, error) {
+	if id, ok := ctx.Choice(param); ok {
+		return id, nil, nil
+	}
+
+	matches, confident, err := p.findUsers(ctx.UserID, ctx.Param(param))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(matches) == 0 {
+		return "", nil, newIntentError("user.not_found", nil)
+	}
+	if !confident {
+		return "", ctx.askChoice(intentName, param, matches), nil
+	}
+	return matches[0].ID, nil, nil
+}